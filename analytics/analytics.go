@@ -0,0 +1,191 @@
+// Package analytics groups community activity into UTC days, Monday-based weeks or months.
+package analytics
+
+import (
+	"encoding/csv"
+	"errors"
+	"io"
+	"net/url"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// sizes of the buckets analytics are grouped into
+const (
+	IntervalDay   = "day"
+	IntervalWeek  = "week"
+	IntervalMonth = "month"
+)
+
+// how many buckets are returned when no range is given
+var DefaultPeriods = map[string]int{IntervalDay: 30, IntervalWeek: 12, IntervalMonth: 12}
+
+const MaxBuckets = 400
+
+var (
+	ErrInterval = errors.New("analytics: unknown interval")
+	ErrTo       = errors.New("analytics: invalid to")
+	ErrFrom     = errors.New("analytics: invalid from")
+	ErrTooLong  = errors.New("analytics: too many buckets")
+)
+
+type Bucket struct {
+	Start time.Time `json:"start"`
+	// members at the end of the bucket
+	Members       int `json:"members"`
+	Joins         int `json:"joins"`
+	Leaves        int `json:"leaves"`
+	Announcements int `json:"announcements"`
+	// events taking place in the bucket and the RSVPs they got
+	Events int `json:"events"`
+	RSVPs  int `json:"rsvps"`
+	// RSVPs per event as a share of the members at the time
+	RSVPRate float64 `json:"rsvpRate"`
+	// members who commented, chatted, reacted or voted
+	ActiveMembers int `json:"activeMembers"`
+}
+
+// Range reads ?interval=, ?from= and ?to= as RFC3339 times or ?periods= for the latest
+// buckets. Ranges are widened to whole buckets, which also keeps cache keys stable.
+func Range(now time.Time, query url.Values) (from time.Time, to time.Time, interval string, err error) {
+	interval = query.Get("interval")
+	if interval == "" {
+		interval = IntervalDay
+	}
+	if _, ok := DefaultPeriods[interval]; !ok {
+		return from, to, interval, ErrInterval
+	}
+
+	to = NextBucket(BucketStart(now, interval), interval)
+	if value := query.Get("to"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return from, to, interval, ErrTo
+		}
+		to = NextBucket(BucketStart(parsed.Add(-time.Nanosecond), interval), interval)
+	}
+	periods := DefaultPeriods[interval]
+	if value, err := strconv.Atoi(query.Get("periods")); err == nil && value > 0 {
+		periods = min(value, MaxBuckets)
+	}
+	from = to
+	for i := 0; i < periods; i++ {
+		from = BucketStart(from.Add(-time.Nanosecond), interval)
+	}
+	if value := query.Get("from"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil || !parsed.Before(to) {
+			return from, to, interval, ErrFrom
+		}
+		from = BucketStart(parsed, interval)
+	}
+
+	if len(Series(from, to, interval)) > MaxBuckets {
+		return from, to, interval, ErrTooLong
+	}
+	return from, to, interval, nil
+}
+
+// Series returns the empty buckets starting from up to to, it stops one past MaxBuckets
+func Series(from time.Time, to time.Time, interval string) []Bucket {
+	var series []Bucket
+	for start := from; start.Before(to) && len(series) <= MaxBuckets; start = NextBucket(start, interval) {
+		series = append(series, Bucket{Start: start})
+	}
+	return series
+}
+
+// FillMembers works back from the current member count through each bucket's joins and
+// leaves, after taking off laterNet, the net joins since the end of the series
+func FillMembers(series []Bucket, current int, laterNet int) {
+	members := current - laterNet
+	for i := len(series) - 1; i >= 0; i-- {
+		series[i].Members = max(members, 0)
+		members -= series[i].Joins - series[i].Leaves
+	}
+}
+
+// Totals adds up the series and sets each bucket's RSVP rate. The total rate weighs every
+// event by the members at the time, and its member count is the one at the end.
+func Totals(series []Bucket) Bucket {
+	var totals Bucket
+	var invited int
+	for i := range series {
+		b := &series[i]
+		b.RSVPRate = rsvpRate(b.RSVPs, b.Events*b.Members)
+		invited += b.Events * b.Members
+		totals.Joins += b.Joins
+		totals.Leaves += b.Leaves
+		totals.Announcements += b.Announcements
+		totals.Events += b.Events
+		totals.RSVPs += b.RSVPs
+	}
+	if len(series) > 0 {
+		totals.Start = series[0].Start
+		totals.Members = series[len(series)-1].Members
+	}
+	totals.RSVPRate = rsvpRate(totals.RSVPs, invited)
+	return totals
+}
+
+func rsvpRate(rsvps int, invited int) float64 {
+	if invited == 0 {
+		return 0
+	}
+	return float64(rsvps) / float64(invited)
+}
+
+// TruncateDate is the $dateTrunc expression matching BucketStart
+func TruncateDate(field string, interval string) bson.M {
+	trunc := bson.M{"date": field, "unit": interval, "timezone": "UTC"}
+	if interval == IntervalWeek {
+		trunc["startOfWeek"] = "monday"
+	}
+	return bson.M{"$dateTrunc": trunc}
+}
+
+// BucketStart returns the start of the UTC day, Monday-based week or month containing t
+func BucketStart(t time.Time, interval string) time.Time {
+	t = t.UTC()
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	switch interval {
+	case IntervalWeek:
+		return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+	case IntervalMonth:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	}
+	return day
+}
+
+func NextBucket(start time.Time, interval string) time.Time {
+	switch interval {
+	case IntervalWeek:
+		return start.AddDate(0, 0, 7)
+	case IntervalMonth:
+		return start.AddDate(0, 1, 0)
+	}
+	return start.AddDate(0, 0, 1)
+}
+
+// WriteCSV writes the series with a header row
+func WriteCSV(w io.Writer, series []Bucket) error {
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"start", "members", "joins", "leaves", "announcements", "events", "rsvps", "rsvp_rate", "active_members"})
+	for _, bucket := range series {
+		writer.Write([]string{
+			bucket.Start.Format(time.RFC3339),
+			strconv.Itoa(bucket.Members),
+			strconv.Itoa(bucket.Joins),
+			strconv.Itoa(bucket.Leaves),
+			strconv.Itoa(bucket.Announcements),
+			strconv.Itoa(bucket.Events),
+			strconv.Itoa(bucket.RSVPs),
+			strconv.FormatFloat(bucket.RSVPRate, 'f', 4, 64),
+			strconv.Itoa(bucket.ActiveMembers),
+		})
+	}
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,203 @@
+package analytics
+
+import (
+	"bytes"
+	"errors"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func date(value string) time.Time {
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestBucketStart(t *testing.T) {
+	tests := []struct {
+		at       string
+		interval string
+		want     string
+	}{
+		{"2026-03-18T15:04:05Z", IntervalDay, "2026-03-18T00:00:00Z"},
+		{"2026-03-18T00:00:00Z", IntervalDay, "2026-03-18T00:00:00Z"},
+		// still the 17th in UTC
+		{"2026-03-18T01:00:00+02:00", IntervalDay, "2026-03-17T00:00:00Z"},
+		// a Wednesday, a Monday and a Sunday
+		{"2026-03-18T15:04:05Z", IntervalWeek, "2026-03-16T00:00:00Z"},
+		{"2026-03-16T00:00:00Z", IntervalWeek, "2026-03-16T00:00:00Z"},
+		{"2026-03-22T23:59:59Z", IntervalWeek, "2026-03-16T00:00:00Z"},
+		{"2026-01-01T12:00:00Z", IntervalWeek, "2025-12-29T00:00:00Z"},
+		{"2026-03-18T15:04:05Z", IntervalMonth, "2026-03-01T00:00:00Z"},
+		{"2026-03-01T00:30:00+01:00", IntervalMonth, "2026-02-01T00:00:00Z"},
+		{"2026-03-18T15:04:05Z", "", "2026-03-18T00:00:00Z"},
+	}
+	for _, tt := range tests {
+		if got := BucketStart(date(tt.at), tt.interval); !got.Equal(date(tt.want)) || got.Location() != time.UTC {
+			t.Errorf("BucketStart(%s, %s) = %v, want %s", tt.at, tt.interval, got, tt.want)
+		}
+	}
+}
+
+func TestNextBucket(t *testing.T) {
+	tests := []struct {
+		start    string
+		interval string
+		want     string
+	}{
+		{"2026-03-18T00:00:00Z", IntervalDay, "2026-03-19T00:00:00Z"},
+		{"2026-02-28T00:00:00Z", IntervalDay, "2026-03-01T00:00:00Z"},
+		{"2026-12-28T00:00:00Z", IntervalWeek, "2027-01-04T00:00:00Z"},
+		{"2026-01-01T00:00:00Z", IntervalMonth, "2026-02-01T00:00:00Z"},
+		{"2026-12-01T00:00:00Z", IntervalMonth, "2027-01-01T00:00:00Z"},
+	}
+	for _, tt := range tests {
+		if got := NextBucket(date(tt.start), tt.interval); !got.Equal(date(tt.want)) {
+			t.Errorf("NextBucket(%s, %s) = %v, want %s", tt.start, tt.interval, got, tt.want)
+		}
+	}
+}
+
+func TestTruncateDate(t *testing.T) {
+	want := bson.M{"$dateTrunc": bson.M{"date": "$at", "unit": "week", "timezone": "UTC", "startOfWeek": "monday"}}
+	if got := TruncateDate("$at", IntervalWeek); !reflect.DeepEqual(got, want) {
+		t.Errorf("TruncateDate = %v, want %v", got, want)
+	}
+	if got := TruncateDate("$at", IntervalMonth)["$dateTrunc"].(bson.M); got["startOfWeek"] != nil || got["unit"] != "month" {
+		t.Errorf("TruncateDate(month) = %v", got)
+	}
+}
+
+func TestRange(t *testing.T) {
+	now := date("2026-03-18T15:04:05Z")
+
+	tests := []struct {
+		name     string
+		query    string
+		from, to string
+		interval string
+		buckets  int
+		err      error
+	}{
+		{"defaults", "", "2026-02-17T00:00:00Z", "2026-03-19T00:00:00Z", IntervalDay, 30, nil},
+		{"weeks", "interval=week", "2025-12-29T00:00:00Z", "2026-03-23T00:00:00Z", IntervalWeek, 12, nil},
+		{"periods", "interval=month&periods=2", "2026-02-01T00:00:00Z", "2026-04-01T00:00:00Z", IntervalMonth, 2, nil},
+		{"periods capped", "periods=100000", "2025-02-12T00:00:00Z", "2026-03-19T00:00:00Z", IntervalDay, MaxBuckets, nil},
+		{"invalid periods", "periods=-3", "2026-02-17T00:00:00Z", "2026-03-19T00:00:00Z", IntervalDay, 30, nil},
+		// a to on a bucket boundary doesn't pull in the next bucket
+		{"to on a boundary", "to=2026-03-01T00:00:00Z&periods=3", "2026-02-26T00:00:00Z", "2026-03-01T00:00:00Z", IntervalDay, 3, nil},
+		{"to inside a bucket", "to=2026-03-01T00:00:01Z&periods=3", "2026-02-27T00:00:00Z", "2026-03-02T00:00:00Z", IntervalDay, 3, nil},
+		{"from and to", "interval=week&from=2026-01-07T10:00:00Z&to=2026-01-20T00:00:00Z", "2026-01-05T00:00:00Z", "2026-01-26T00:00:00Z", IntervalWeek, 3, nil},
+		{"unknown interval", "interval=year", "", "", "year", 0, ErrInterval},
+		{"bad to", "to=yesterday", "", "", IntervalDay, 0, ErrTo},
+		{"bad from", "from=2026-13-01T00:00:00Z", "", "", IntervalDay, 0, ErrFrom},
+		{"from after to", "from=2026-04-01T00:00:00Z&to=2026-03-01T00:00:00Z", "", "", IntervalDay, 0, ErrFrom},
+		{"too long", "from=2020-01-01T00:00:00Z", "", "", IntervalDay, 0, ErrTooLong},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, _ := url.ParseQuery(tt.query)
+			from, to, interval, err := Range(now, query)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Range error = %v, want %v", err, tt.err)
+			}
+			if interval != tt.interval {
+				t.Errorf("interval = %s, want %s", interval, tt.interval)
+			}
+			if err != nil {
+				return
+			}
+			if !from.Equal(date(tt.from)) || !to.Equal(date(tt.to)) {
+				t.Errorf("Range = %v to %v, want %s to %s", from, to, tt.from, tt.to)
+			}
+			if got := len(Series(from, to, interval)); got != tt.buckets {
+				t.Errorf("%d buckets, want %d", got, tt.buckets)
+			}
+		})
+	}
+}
+
+func TestFillMembers(t *testing.T) {
+	tests := []struct {
+		name     string
+		changes  [][2]int
+		current  int
+		laterNet int
+		want     []int
+	}{
+		{"no changes", [][2]int{{0, 0}, {0, 0}}, 10, 0, []int{10, 10}},
+		{"growing", [][2]int{{5, 0}, {3, 1}, {4, 0}}, 20, 0, []int{14, 16, 20}},
+		{"joins since the range", [][2]int{{5, 0}, {3, 1}}, 20, 6, []int{12, 14}},
+		{"leaves since the range", [][2]int{{1, 0}}, 5, -3, []int{8}},
+		// members from before changes were recorded can't make the count negative
+		{"never below zero", [][2]int{{0, 0}, {10, 0}}, 4, 0, []int{0, 4}},
+		{"empty", nil, 4, 0, []int{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			series := make([]Bucket, len(tt.changes))
+			for i, change := range tt.changes {
+				series[i].Joins, series[i].Leaves = change[0], change[1]
+			}
+			FillMembers(series, tt.current, tt.laterNet)
+			got := make([]int, len(series))
+			for i := range series {
+				got[i] = series[i].Members
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("members = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTotals(t *testing.T) {
+	series := []Bucket{
+		{Start: date("2026-03-16T00:00:00Z"), Members: 10, Joins: 10, Events: 1, RSVPs: 5, Announcements: 2},
+		{Start: date("2026-03-17T00:00:00Z"), Members: 40, Joins: 31, Leaves: 1, Events: 2, RSVPs: 20},
+		{Start: date("2026-03-18T00:00:00Z"), Members: 40},
+	}
+	totals := Totals(series)
+
+	for i, want := range []float64{0.5, 0.25, 0} {
+		if series[i].RSVPRate != want {
+			t.Errorf("bucket %d rate = %v, want %v", i, series[i].RSVPRate, want)
+		}
+	}
+	want := Bucket{Start: series[0].Start, Members: 40, Joins: 41, Leaves: 1, Announcements: 2, Events: 3, RSVPs: 25, RSVPRate: 25.0 / 90}
+	if totals != want {
+		t.Errorf("Totals = %+v, want %+v", totals, want)
+	}
+	if empty := Totals(nil); empty != (Bucket{}) {
+		t.Errorf("Totals(nil) = %+v", empty)
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	series := []Bucket{
+		{Start: date("2026-03-16T00:00:00Z"), Members: 12, Joins: 3, Leaves: 1, Announcements: 2, Events: 1, RSVPs: 4, RSVPRate: 1.0 / 3, ActiveMembers: 7},
+		{Start: date("2026-03-23T00:00:00Z")},
+	}
+	var buf bytes.Buffer
+	if err := WriteCSV(&buf, series); err != nil {
+		t.Fatal(err)
+	}
+	want := "start,members,joins,leaves,announcements,events,rsvps,rsvp_rate,active_members\n" +
+		"2026-03-16T00:00:00Z,12,3,1,2,1,4,0.3333,7\n" +
+		"2026-03-23T00:00:00Z,0,0,0,0,0,0,0.0000,0\n"
+	if buf.String() != want {
+		t.Errorf("WriteCSV wrote\n%s\nwant\n%s", buf.String(), want)
+	}
+
+	buf.Reset()
+	WriteCSV(&buf, nil)
+	if buf.String() != "start,members,joins,leaves,announcements,events,rsvps,rsvp_rate,active_members\n" {
+		t.Errorf("WriteCSV(nil) wrote %q", buf.String())
+	}
+}
@@ -1,34 +1,68 @@
-package application
-
-import (
-	"context"
-	"fmt"
-	"net/http"
-)
-
-type App struct {
-	router http.Handler
-}
-
-func New() *App {
-	app := &App{
-		router: LoadRoutes(),
-	}
-
-	return app
-}
-
-func (a *App) Start(ctx context.Context) error {
-	server := &http.Server{
-		Addr:    "localhost:3000",
-		Handler: a.router,
-	}
-	err := server.ListenAndServe()
-	if err != nil {
-		fmt.Printf("failed to start: %v", err)
-	} else {
-		fmt.Print("server running")
-	}
-
-	return err
-}
+package application
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/zillalikestocode/community-api/configs"
+	"github.com/zillalikestocode/community-api/handler"
+	"github.com/zillalikestocode/community-api/jobs"
+)
+
+// how long in-flight requests and jobs get to finish on shutdown
+const shutdownTimeout = 30 * time.Second
+
+type App struct {
+	router http.Handler
+	jobs   *jobs.Pool
+}
+
+func New() *App {
+	pool := jobs.NewPool(configs.UseJobQueue(), configs.JobWorkers())
+	handler.RegisterJobs(pool)
+
+	app := &App{
+		router: LoadRoutes(),
+		jobs:   pool,
+	}
+
+	return app
+}
+
+// Start serves requests and runs background jobs until ctx is done, then drains both
+func (a *App) Start(ctx context.Context) error {
+	server := &http.Server{
+		Addr:    "localhost:3000",
+		Handler: a.router,
+	}
+
+	a.jobs.Start()
+
+	errCh := make(chan error, 1)
+	go func() {
+		fmt.Print("server running")
+		errCh <- server.ListenAndServe()
+	}()
+
+	var err error
+	select {
+	case err = <-errCh:
+		fmt.Printf("failed to start: %v", err)
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	if shutdownErr := server.Shutdown(shutdownCtx); shutdownErr != nil && !errors.Is(shutdownErr, http.ErrServerClosed) {
+		fmt.Printf("failed to shut down server: %v\n", shutdownErr)
+	}
+	if drainErr := a.jobs.Shutdown(shutdownCtx); drainErr != nil {
+		fmt.Printf("background jobs did not finish: %v\n", drainErr)
+	}
+
+	return err
+}
@@ -1,65 +1,227 @@
-package application
-
-import (
-	"github.com/go-chi/chi/v5"
-	"github.com/go-chi/chi/v5/middleware"
-	"github.com/go-chi/cors"
-	"github.com/go-chi/jwtauth/v5"
-	"github.com/zillalikestocode/community-api/configs"
-	"github.com/zillalikestocode/community-api/handler"
-)
-
-func LoadRoutes() *chi.Mux {
-	router := chi.NewRouter()
-	router.Use(middleware.Logger)
-	router.Use(cors.Handler(cors.Options{
-		// AllowedOrigins:   []string{"https://foo.com"}, // Use this to allow specific origin hosts
-		AllowedOrigins: []string{"https://*", "http://*"},
-		// AllowOriginFunc:  func(r *http.Request, origin string) bool { return true },
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
-		ExposedHeaders:   []string{"Link"},
-		AllowCredentials: false,
-		MaxAge:           300, // Maximum value not ignored by any of major browsers
-	}))
-
-	router.Route("/user", loadUserRoutes)
-	router.Route("/community", loadCommunityRoutes)
-
-	return router
-}
-
-func loadUserRoutes(router chi.Router) {
-	userHandler := &handler.User{}
-
-	// protected
-	router.With(jwtauth.Verifier(configs.UseJWT())).With(jwtauth.Authenticator(configs.UseJWT())).Group(func(router chi.Router) {
-		// router.Use(jwtauth.Verifier(configs.UseJWT()))
-		// router.Use(jwtauth.Authenticator(configs.UseJWT()))
-
-		router.Get("/", userHandler.Get)
-	})
-
-	router.Group(func(router chi.Router) {
-		router.Post("/create", userHandler.Create)
-		router.Post("/login", userHandler.Login)
-	})
-
-}
-
-func loadCommunityRoutes(router chi.Router) {
-	communityHandler := &handler.Community{}
-	router.With(jwtauth.Verifier(configs.UseJWT())).With(jwtauth.Authenticator(configs.UseJWT())).Group(func(router chi.Router) {
-
-		router.Post("/create", communityHandler.Create)
-		router.Get("/get-all", communityHandler.GetAll)
-		router.Get("/search", communityHandler.SearchCommunity)
-		router.Post("/join", communityHandler.Join)
-		router.Post("/leave", communityHandler.Leave)
-		router.Post("/announcement/create", communityHandler.CreateAnnouncement)
-		router.Post("/announcement/delete", communityHandler.DeleteAnnouncement)
-		router.Post("/event/create", communityHandler.CreateEvent)
-		router.Post("/event/delete", communityHandler.DeleteEvent)
-		router.Post("/event/update", communityHandler.UpdateEvent)
-	})
-}
+package application
+
+import (
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/cors"
+	"github.com/go-chi/jwtauth/v5"
+	"github.com/zillalikestocode/community-api/configs"
+	"github.com/zillalikestocode/community-api/handler"
+)
+
+func LoadRoutes() *chi.Mux {
+	router := chi.NewRouter()
+	router.Use(middleware.Logger)
+	router.Use(cors.Handler(cors.Options{
+		// AllowedOrigins:   []string{"https://foo.com"}, // Use this to allow specific origin hosts
+		AllowedOrigins: []string{"https://*", "http://*"},
+		// AllowOriginFunc:  func(r *http.Request, origin string) bool { return true },
+		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
+		ExposedHeaders:   []string{"Link"},
+		AllowCredentials: false,
+		MaxAge:           300, // Maximum value not ignored by any of major browsers
+	}))
+	router.Use(handler.CacheSessions)
+	router.Use(configs.UseRateLimiter(handler.ActiveSession).Handler("global", configs.RateLimit("RATE_LIMIT", 120)))
+
+	router.Route("/user", loadUserRoutes)
+	router.Route("/community", loadCommunityRoutes)
+	router.Route("/chat", loadChatRoutes)
+	router.Route("/messages", loadMessageRoutes)
+	router.Route("/notifications", loadNotificationRoutes)
+	router.Route("/comments", loadCommentRoutes)
+	router.Route("/polls", loadPollRoutes)
+	router.Route("/files", loadFileRoutes)
+	router.Route("/media", loadMediaRoutes)
+	router.Route("/cron", loadCronRoutes)
+
+	return router
+}
+
+func loadUserRoutes(router chi.Router) {
+	userHandler := &handler.User{}
+	limiter := configs.UseRateLimiter(handler.ActiveSession)
+
+	// protected
+	router.With(jwtauth.Verifier(configs.UseJWT())).With(jwtauth.Authenticator(configs.UseJWT())).With(handler.RequireSession).Group(func(router chi.Router) {
+		// router.Use(jwtauth.Verifier(configs.UseJWT()))
+		// router.Use(jwtauth.Authenticator(configs.UseJWT()))
+
+		router.Get("/", userHandler.Get)
+		router.Post("/verify/resend", userHandler.ResendVerification)
+		router.Post("/username", userHandler.SetUsername)
+		router.With(limiter.Handler("images.upload", configs.RateLimit("RATE_LIMIT_UPLOAD", 20))).Post("/avatar", userHandler.UploadAvatar)
+		router.Post("/avatar/delete", userHandler.DeleteAvatar)
+		router.With(limiter.Handler("images.upload", configs.RateLimit("RATE_LIMIT_UPLOAD", 20))).Post("/banner", userHandler.UploadBanner)
+		router.Post("/banner/delete", userHandler.DeleteBanner)
+		router.Post("/2fa/enroll", userHandler.EnrollTwoFactor)
+		router.Post("/2fa/confirm", userHandler.ConfirmTwoFactor)
+		router.Post("/2fa/disable", userHandler.DisableTwoFactor)
+	})
+
+	router.Group(func(router chi.Router) {
+		router.With(limiter.Handler("user.create", configs.RateLimit("RATE_LIMIT_CREATE", 10))).Post("/create", userHandler.Create)
+		router.Post("/login", userHandler.Login)
+		router.Post("/login/2fa", userHandler.LoginTwoFactor)
+		router.Post("/password/forgot", userHandler.ForgotPassword)
+		router.Post("/password/reset", userHandler.ResetPassword)
+		router.Post("/verify", userHandler.VerifyEmail)
+	})
+
+}
+
+func loadCommunityRoutes(router chi.Router) {
+	communityHandler := &handler.Community{}
+	webhookHandler := &handler.Webhook{}
+	limiter := configs.UseRateLimiter(handler.ActiveSession)
+	createLimit := limiter.Handler("community.create", configs.RateLimit("RATE_LIMIT_CREATE", 10))
+	uploadLimit := limiter.Handler("images.upload", configs.RateLimit("RATE_LIMIT_UPLOAD", 20))
+	router.With(jwtauth.Verifier(configs.UseJWT())).With(jwtauth.Authenticator(configs.UseJWT())).With(handler.RequireSession).Group(func(router chi.Router) {
+
+		router.With(createLimit).Post("/create", communityHandler.Create)
+		router.Get("/get-all", communityHandler.GetAll)
+		router.Post("/update", communityHandler.Update)
+		router.Get("/analytics", communityHandler.Analytics)
+		router.Get("/audit", communityHandler.AuditLog)
+		router.Get("/categories", communityHandler.Categories)
+		router.Get("/discover", communityHandler.Discover)
+		router.Get("/recommended", communityHandler.Recommended)
+		router.Get("/feed", communityHandler.Feed)
+		router.With(limiter.Handler("community.search", configs.RateLimit("RATE_LIMIT_SEARCH", 30))).Get("/search", communityHandler.SearchCommunity)
+		router.Post("/join", communityHandler.Join)
+		router.Post("/leave", communityHandler.Leave)
+		router.With(uploadLimit).Post("/avatar", communityHandler.UploadAvatar)
+		router.Post("/avatar/delete", communityHandler.DeleteAvatar)
+		router.With(uploadLimit).Post("/banner", communityHandler.UploadBanner)
+		router.Post("/banner/delete", communityHandler.DeleteBanner)
+		router.With(createLimit).Post("/announcement/create", communityHandler.CreateAnnouncement)
+		router.Post("/announcement/publish", communityHandler.PublishAnnouncement)
+		router.Post("/announcement/update", communityHandler.UpdateAnnouncement)
+		router.Get("/announcement/history", communityHandler.AnnouncementHistory)
+		router.Post("/announcement/pin", communityHandler.PinAnnouncement)
+		router.Post("/announcement/unpin", communityHandler.UnpinAnnouncement)
+		router.Post("/announcement/pins/reorder", communityHandler.ReorderPinnedAnnouncements)
+		router.Post("/announcement/delete", communityHandler.DeleteAnnouncement)
+		router.With(createLimit).Post("/event/create", communityHandler.CreateEvent)
+		router.Post("/event/delete", communityHandler.DeleteEvent)
+		router.Post("/event/update", communityHandler.UpdateEvent)
+		router.Post("/event/rsvp", communityHandler.RSVP)
+		router.Get("/event/nearby", communityHandler.NearbyEvents)
+		router.Get("/event/ticket", communityHandler.Ticket)
+		router.Post("/event/checkin", communityHandler.CheckIn)
+		router.Get("/event/attendance", communityHandler.Attendance)
+		router.Post("/event/rsvp/cancel", communityHandler.CancelRSVP)
+		router.Post("/webhook/create", webhookHandler.Create)
+		router.Get("/webhook/list", webhookHandler.List)
+		router.Post("/webhook/delete", webhookHandler.Delete)
+		router.Post("/webhook/enable", webhookHandler.Enable)
+		router.Get("/webhook/deliveries", webhookHandler.Deliveries)
+		router.Post("/webhook/redeliver", webhookHandler.Redeliver)
+	})
+
+	// EventSource can't set headers, so streams also accept the token as ?jwt=
+	router.With(jwtauth.Verify(configs.UseJWT(), jwtauth.TokenFromHeader, jwtauth.TokenFromQuery)).With(jwtauth.Authenticator(configs.UseJWT())).With(handler.RequireSession).Group(func(router chi.Router) {
+		router.Get("/stream", communityHandler.Stream)
+		router.Get("/stream/all", communityHandler.StreamAll)
+	})
+}
+
+func loadChatRoutes(router chi.Router) {
+	chatHandler := &handler.Chat{}
+	router.With(jwtauth.Verifier(configs.UseJWT())).With(jwtauth.Authenticator(configs.UseJWT())).With(handler.RequireSession).Group(func(router chi.Router) {
+		router.Post("/channel/create", chatHandler.CreateChannel)
+		router.Post("/channel/delete", chatHandler.DeleteChannel)
+		router.Get("/channel/list", chatHandler.ListChannels)
+		router.Get("/channel/messages", chatHandler.History)
+	})
+
+	// browsers can't set headers on websocket requests, so the token may be passed as ?jwt=
+	router.With(jwtauth.Verify(configs.UseJWT(), jwtauth.TokenFromHeader, jwtauth.TokenFromQuery)).With(jwtauth.Authenticator(configs.UseJWT())).With(handler.RequireSession).Get("/connect", chatHandler.Connect)
+}
+
+func loadMessageRoutes(router chi.Router) {
+	messageHandler := &handler.Message{}
+	router.With(jwtauth.Verifier(configs.UseJWT())).With(jwtauth.Authenticator(configs.UseJWT())).With(handler.RequireSession).Group(func(router chi.Router) {
+		router.Post("/conversation/create", messageHandler.CreateConversation)
+		router.Get("/conversations", messageHandler.ListConversations)
+		router.Get("/conversation", messageHandler.History)
+		router.Post("/send", messageHandler.Send)
+		router.Post("/read", messageHandler.MarkRead)
+		router.Post("/retention", messageHandler.SetRetention)
+		router.Post("/block", messageHandler.Block)
+		router.Post("/unblock", messageHandler.Unblock)
+		router.Get("/blocked", messageHandler.Blocked)
+	})
+}
+
+func loadNotificationRoutes(router chi.Router) {
+	notificationHandler := &handler.Notification{}
+	router.With(jwtauth.Verifier(configs.UseJWT())).With(jwtauth.Authenticator(configs.UseJWT())).With(handler.RequireSession).Group(func(router chi.Router) {
+		router.Get("/", notificationHandler.List)
+		router.Get("/unread-count", notificationHandler.UnreadCount)
+		router.Post("/read", notificationHandler.MarkRead)
+		router.Post("/read-all", notificationHandler.MarkAllRead)
+		router.Get("/preferences", notificationHandler.GetPreferences)
+		router.Post("/preferences", notificationHandler.UpdatePreferences)
+	})
+}
+
+func loadCommentRoutes(router chi.Router) {
+	commentHandler := &handler.Comment{}
+	limiter := configs.UseRateLimiter(handler.ActiveSession)
+	router.With(jwtauth.Verifier(configs.UseJWT())).With(jwtauth.Authenticator(configs.UseJWT())).With(handler.RequireSession).Group(func(router chi.Router) {
+		router.Get("/", commentHandler.List)
+		router.With(limiter.Handler("comments.create", configs.RateLimit("RATE_LIMIT_COMMENT", 30))).Post("/create", commentHandler.Create)
+		router.Post("/update", commentHandler.Update)
+		router.Post("/delete", commentHandler.Delete)
+		router.Post("/hide", commentHandler.Hide)
+		router.Post("/react", commentHandler.React)
+		router.Post("/unreact", commentHandler.Unreact)
+		router.Get("/reactions/mine", commentHandler.MyReactions)
+	})
+}
+
+func loadPollRoutes(router chi.Router) {
+	pollHandler := &handler.Poll{}
+	limiter := configs.UseRateLimiter(handler.ActiveSession)
+	router.With(jwtauth.Verifier(configs.UseJWT())).With(jwtauth.Authenticator(configs.UseJWT())).With(handler.RequireSession).Group(func(router chi.Router) {
+		router.Get("/", pollHandler.List)
+		router.With(limiter.Handler("polls.create", configs.RateLimit("RATE_LIMIT_CREATE", 10))).Post("/create", pollHandler.Create)
+		router.Post("/vote", pollHandler.Vote)
+		router.Post("/close", pollHandler.Close)
+		router.Post("/delete", pollHandler.Delete)
+		router.Get("/voters", pollHandler.Voters)
+	})
+}
+
+func loadFileRoutes(router chi.Router) {
+	fileHandler := &handler.File{}
+	limiter := configs.UseRateLimiter(handler.ActiveSession)
+	router.With(jwtauth.Verifier(configs.UseJWT())).With(jwtauth.Authenticator(configs.UseJWT())).With(handler.RequireSession).Group(func(router chi.Router) {
+		router.Get("/", fileHandler.List)
+		router.With(limiter.Handler("files.upload", configs.RateLimit("RATE_LIMIT_UPLOAD", 20))).Post("/upload", fileHandler.Upload)
+		router.Post("/delete", fileHandler.Delete)
+	})
+
+	// signed links
+	router.Get("/download", fileHandler.Download)
+}
+
+func loadMediaRoutes(router chi.Router) {
+	mediaHandler := &handler.Media{}
+
+	// avatars and banners are public
+	router.Get("/images/*", mediaHandler.Serve)
+}
+
+func loadCronRoutes(router chi.Router) {
+	cronHandler := &handler.Cron{}
+
+	// called by the Vercel scheduler, a server process does this work itself
+	router.With(handler.RequireCronSecret).Group(func(router chi.Router) {
+		router.Get("/setup", cronHandler.Setup)
+		router.Get("/reminders", cronHandler.Reminders)
+		router.Get("/jobs", cronHandler.Jobs)
+	})
+}
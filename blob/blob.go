@@ -0,0 +1,41 @@
+// Package blob stores uploaded files on the local filesystem or an S3 compatible
+// object store, and signs expiring download links for them.
+package blob
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"strconv"
+	"time"
+)
+
+var ErrNotFound = errors.New("blob not found")
+
+// Store keeps file contents by key, implementations must be safe for concurrent use
+type Store interface {
+	Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) error
+	// Open returns ErrNotFound when the key doesn't exist
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// Sign returns the signature for a download link to key that is valid until expires
+func Sign(secret []byte, key string, expires time.Time) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(key))
+	mac.Write([]byte("\n"))
+	mac.Write([]byte(strconv.FormatInt(expires.Unix(), 10)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks a signature produced by Sign and that the link hasn't expired
+func Verify(secret []byte, key string, expires int64, signature string) bool {
+	if time.Now().Unix() > expires {
+		return false
+	}
+	return hmac.Equal([]byte(signature), []byte(Sign(secret, key, time.Unix(expires, 0))))
+}
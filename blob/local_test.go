@@ -0,0 +1,117 @@
+package blob
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLocal(t *testing.T) {
+	store := &Local{Dir: t.TempDir()}
+	ctx := context.Background()
+
+	if err := store.Put(ctx, "communities/abc/file.txt", strings.NewReader("hello"), 5, "text/plain"); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	reader, err := store.Open(ctx, "communities/abc/file.txt")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	got, _ := io.ReadAll(reader)
+	reader.Close()
+	if string(got) != "hello" {
+		t.Errorf("Open read %q, want %q", got, "hello")
+	}
+
+	if err := store.Delete(ctx, "communities/abc/file.txt"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := store.Open(ctx, "communities/abc/file.txt"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Open after Delete = %v, want ErrNotFound", err)
+	}
+	if err := store.Delete(ctx, "communities/abc/file.txt"); err != nil {
+		t.Errorf("second Delete: %v", err)
+	}
+}
+
+func TestLocalPathTraversal(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "uploads")
+	store := &Local{Dir: dir}
+	ctx := context.Background()
+
+	// something outside the store a bad key could reach
+	outside := filepath.Join(root, "secret.txt")
+	if err := os.WriteFile(outside, []byte("secret"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	keys := []string{
+		"",
+		"/",
+		"..",
+		"../secret.txt",
+		"a/../../secret.txt",
+		"a/../..",
+		"..\\secret.txt",
+		"a/..",
+	}
+	for _, key := range keys {
+		t.Run(key, func(t *testing.T) {
+			if err := store.Put(ctx, key, strings.NewReader("overwritten"), 11, "text/plain"); err == nil {
+				t.Errorf("Put(%q) succeeded", key)
+			}
+			if reader, err := store.Open(ctx, key); err == nil {
+				reader.Close()
+				t.Errorf("Open(%q) succeeded", key)
+			}
+			if err := store.Delete(ctx, key); err == nil {
+				t.Errorf("Delete(%q) succeeded", key)
+			}
+		})
+	}
+
+	if got, err := os.ReadFile(outside); err != nil || string(got) != "secret" {
+		t.Errorf("file outside the store = %q, %v", got, err)
+	}
+
+	// a leading slash is relative to the store, not the filesystem root
+	path, err := store.path("/a/b.txt")
+	if err != nil || path != filepath.Join(dir, "a", "b.txt") {
+		t.Errorf("path(/a/b.txt) = %q, %v", path, err)
+	}
+}
+
+func TestSign(t *testing.T) {
+	secret := []byte("secret")
+	expires := time.Now().Add(time.Minute)
+	signature := Sign(secret, "file", expires)
+
+	tests := []struct {
+		name      string
+		secret    []byte
+		key       string
+		expires   int64
+		signature string
+		want      bool
+	}{
+		{"valid", secret, "file", expires.Unix(), signature, true},
+		{"other key", secret, "other", expires.Unix(), signature, false},
+		{"other secret", []byte("other"), "file", expires.Unix(), signature, false},
+		{"extended expiry", secret, "file", expires.Add(time.Hour).Unix(), signature, false},
+		{"expired", secret, "file", time.Now().Add(-time.Minute).Unix(), Sign(secret, "file", time.Now().Add(-time.Minute)), false},
+		{"empty signature", secret, "file", expires.Unix(), "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Verify(tt.secret, tt.key, tt.expires, tt.signature); got != tt.want {
+				t.Errorf("Verify = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,188 @@
+package blob
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// S3 stores blobs in a bucket of an S3 compatible service such as MinIO, signing
+// requests with AWS Signature Version 4
+type S3 struct {
+	// e.g. https://s3.eu-west-1.amazonaws.com or http://localhost:9000
+	Endpoint  string
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	// address the bucket as part of the path instead of the host, needed by most stand-ins
+	PathStyle bool
+	Client    *http.Client
+}
+
+// payload hashing is skipped so uploads can be streamed
+const unsignedPayload = "UNSIGNED-PAYLOAD"
+
+func (s *S3) Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) error {
+	req, err := s.request(ctx, http.MethodPut, key, body)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", contentType)
+
+	res, err := s.do(req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	return nil
+}
+
+func (s *S3) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	req, err := s.request(ctx, http.MethodGet, key, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := s.do(req)
+	if err != nil {
+		return nil, err
+	}
+	return res.Body, nil
+}
+
+func (s *S3) Delete(ctx context.Context, key string) error {
+	req, err := s.request(ctx, http.MethodDelete, key, nil)
+	if err != nil {
+		return err
+	}
+
+	res, err := s.do(req)
+	if err == ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	return nil
+}
+
+func (s *S3) request(ctx context.Context, method string, key string, body io.Reader) (*http.Request, error) {
+	endpoint, err := url.Parse(s.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	path := "/" + strings.TrimPrefix(key, "/")
+	if s.PathStyle {
+		path = "/" + s.Bucket + path
+	} else {
+		endpoint.Host = s.Bucket + "." + endpoint.Host
+	}
+	endpoint.Path = path
+	endpoint.RawPath = escapePath(path)
+
+	return http.NewRequestWithContext(ctx, method, endpoint.String(), body)
+}
+
+func (s *S3) do(req *http.Request) (*http.Response, error) {
+	s.sign(req, time.Now().UTC())
+
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode == http.StatusNotFound {
+		res.Body.Close()
+		return nil, ErrNotFound
+	}
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		message, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		res.Body.Close()
+		return nil, fmt.Errorf("s3 %s %s: %s: %s", req.Method, req.URL.Path, res.Status, strings.TrimSpace(string(message)))
+	}
+	return res, nil
+}
+
+// sign adds the Authorization header, see
+// https://docs.aws.amazon.com/AmazonS3/latest/API/sig-v4-header-based-auth.html
+func (s *S3) sign(req *http.Request, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", unsignedPayload)
+
+	signed := []string{"host", "x-amz-content-sha256", "x-amz-date"}
+	if req.Header.Get("Content-Type") != "" {
+		signed = []string{"content-type", "host", "x-amz-content-sha256", "x-amz-date"}
+	}
+
+	var headers strings.Builder
+	for _, name := range signed {
+		value := req.Header.Get(name)
+		if name == "host" {
+			value = req.URL.Host
+		}
+		headers.WriteString(name + ":" + strings.TrimSpace(value) + "\n")
+	}
+
+	canonical := strings.Join([]string{
+		req.Method,
+		escapePath(req.URL.Path),
+		req.URL.Query().Encode(),
+		headers.String(),
+		strings.Join(signed, ";"),
+		unsignedPayload,
+	}, "\n")
+
+	scope := day + "/" + s.Region + "/s3/aws4_request"
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hashHex([]byte(canonical))
+
+	key := hmacSHA256([]byte("AWS4"+s.SecretKey), day)
+	key = hmacSHA256(key, s.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, toSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+s.AccessKey+"/"+scope+", SignedHeaders="+strings.Join(signed, ";")+", Signature="+signature)
+}
+
+// escape everything but unreserved characters and slashes, as the signature requires
+func escapePath(path string) string {
+	var b strings.Builder
+	for i := 0; i < len(path); i++ {
+		c := path[i]
+		if c == '/' || c == '-' || c == '_' || c == '.' || c == '~' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func hashHex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
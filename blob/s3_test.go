@@ -0,0 +1,223 @@
+package blob
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const (
+	testAccessKey = "AKIDEXAMPLE"
+	testSecretKey = "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"
+	testRegion    = "eu-west-1"
+)
+
+type object struct {
+	body        []byte
+	contentType string
+}
+
+// fakeS3 is a bucket that only accepts requests carrying a valid Signature Version 4
+type fakeS3 struct {
+	t       *testing.T
+	mu      sync.Mutex
+	objects map[string]object
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := verifySignature(r); err != nil {
+		f.t.Errorf("%s %s: %v", r.Method, r.URL.Path, err)
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	key := r.Host + r.URL.Path
+	switch r.Method {
+	case http.MethodPut:
+		body, _ := io.ReadAll(r.Body)
+		f.objects[key] = object{body: body, contentType: r.Header.Get("Content-Type")}
+	case http.MethodGet:
+		obj, ok := f.objects[key]
+		if !ok {
+			http.Error(w, "NoSuchKey", http.StatusNotFound)
+			return
+		}
+		w.Write(obj.body)
+	case http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// verifySignature rebuilds the canonical request from what arrived on the wire, see
+// https://docs.aws.amazon.com/AmazonS3/latest/API/sig-v4-header-based-auth.html
+func verifySignature(r *http.Request) error {
+	auth := r.Header.Get("Authorization")
+	prefix := "AWS4-HMAC-SHA256 "
+	if !strings.HasPrefix(auth, prefix) {
+		return errors.New("missing AWS4-HMAC-SHA256 authorization")
+	}
+	fields := map[string]string{}
+	for _, part := range strings.Split(strings.TrimPrefix(auth, prefix), ", ") {
+		name, value, _ := strings.Cut(part, "=")
+		fields[name] = value
+	}
+
+	credential := strings.Split(fields["Credential"], "/")
+	if len(credential) != 5 || credential[0] != testAccessKey || credential[2] != testRegion || credential[3] != "s3" || credential[4] != "aws4_request" {
+		return errors.New("bad credential " + fields["Credential"])
+	}
+	day := credential[1]
+	amzDate := r.Header.Get("X-Amz-Date")
+	if !strings.HasPrefix(amzDate, day) {
+		return errors.New("x-amz-date doesn't match the credential scope")
+	}
+
+	signed := strings.Split(fields["SignedHeaders"], ";")
+	if !sort.StringsAreSorted(signed) {
+		return errors.New("signed headers aren't sorted")
+	}
+	for _, required := range []string{"host", "x-amz-content-sha256", "x-amz-date"} {
+		if !contains(signed, required) {
+			return errors.New(required + " isn't signed")
+		}
+	}
+	var headers strings.Builder
+	for _, name := range signed {
+		value := r.Header.Get(name)
+		if name == "host" {
+			value = r.Host
+		}
+		headers.WriteString(name + ":" + strings.TrimSpace(value) + "\n")
+	}
+
+	canonical := r.Method + "\n" +
+		r.URL.EscapedPath() + "\n" +
+		r.URL.RawQuery + "\n" +
+		headers.String() + "\n" +
+		fields["SignedHeaders"] + "\n" +
+		r.Header.Get("X-Amz-Content-Sha256")
+	canonicalHash := sha256.Sum256([]byte(canonical))
+	scope := strings.Join(credential[1:], "/")
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(canonicalHash[:])
+
+	key := []byte("AWS4" + testSecretKey)
+	for _, part := range []string{day, testRegion, "s3", "aws4_request"} {
+		key = mac(key, part)
+	}
+	if want := hex.EncodeToString(mac(key, toSign)); fields["Signature"] != want {
+		return errors.New("signature mismatch, canonical request:\n" + canonical)
+	}
+	return nil
+}
+
+func mac(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func TestS3(t *testing.T) {
+	fake := &fakeS3{t: t, objects: map[string]object{}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	// virtual hosted buckets live on a subdomain, send those to the test server too
+	client := server.Client()
+	client.Transport = &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, network, server.Listener.Addr().String())
+		},
+	}
+
+	for _, pathStyle := range []bool{true, false} {
+		name := "virtual hosted"
+		if pathStyle {
+			name = "path style"
+		}
+		t.Run(name, func(t *testing.T) {
+			store := &S3{
+				Endpoint:  server.URL,
+				Region:    testRegion,
+				Bucket:    "uploads",
+				AccessKey: testAccessKey,
+				SecretKey: testSecretKey,
+				PathStyle: pathStyle,
+				Client:    client,
+			}
+			ctx := context.Background()
+			key := "communities/abc/report (final)+v2.pdf"
+
+			body := "hello world"
+			if err := store.Put(ctx, key, strings.NewReader(body), int64(len(body)), "application/pdf"); err != nil {
+				t.Fatalf("Put: %v", err)
+			}
+
+			reader, err := store.Open(ctx, key)
+			if err != nil {
+				t.Fatalf("Open: %v", err)
+			}
+			got, _ := io.ReadAll(reader)
+			reader.Close()
+			if string(got) != body {
+				t.Errorf("Open read %q, want %q", got, body)
+			}
+
+			if err := store.Delete(ctx, key); err != nil {
+				t.Fatalf("Delete: %v", err)
+			}
+			if _, err := store.Open(ctx, key); !errors.Is(err, ErrNotFound) {
+				t.Errorf("Open after Delete = %v, want ErrNotFound", err)
+			}
+			// deleting a missing blob is not an error
+			if err := store.Delete(ctx, key); err != nil {
+				t.Errorf("second Delete: %v", err)
+			}
+		})
+	}
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	if len(fake.objects) != 0 {
+		t.Errorf("objects left behind: %v", fake.objects)
+	}
+}
+
+func TestS3WrongSecret(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := verifySignature(r); err != nil {
+			http.Error(w, "SignatureDoesNotMatch", http.StatusForbidden)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	store := &S3{Endpoint: server.URL, Region: testRegion, Bucket: "uploads", AccessKey: testAccessKey, SecretKey: "wrong", PathStyle: true, Client: server.Client()}
+	err := store.Put(context.Background(), "a.txt", strings.NewReader("a"), 1, "text/plain")
+	if err == nil || !strings.Contains(err.Error(), "SignatureDoesNotMatch") {
+		t.Errorf("Put with the wrong secret = %v, want a SignatureDoesNotMatch error", err)
+	}
+}
@@ -0,0 +1,67 @@
+package configs
+
+import (
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/zillalikestocode/community-api/blob"
+)
+
+var blobStore blob.Store = newBlobStore()
+
+func newBlobStore() blob.Store {
+	if os.Getenv("BLOB_DRIVER") == "s3" {
+		return &blob.S3{
+			Endpoint:  os.Getenv("S3_ENDPOINT"),
+			Region:    getEnv("S3_REGION", "us-east-1"),
+			Bucket:    os.Getenv("S3_BUCKET"),
+			AccessKey: os.Getenv("S3_ACCESS_KEY"),
+			SecretKey: os.Getenv("S3_SECRET_KEY"),
+			PathStyle: os.Getenv("S3_PATH_STYLE") == "true",
+			Client:    &http.Client{Timeout: 5 * time.Minute},
+		}
+	}
+
+	return &blob.Local{Dir: getEnv("BLOB_DIR", "uploads")}
+}
+
+// UseBlobStore returns the store selected by BLOB_DRIVER ("local" or "s3")
+func UseBlobStore() blob.Store {
+	return blobStore
+}
+
+// MaxUploadBytes is the largest file that can be uploaded, MAX_UPLOAD_BYTES defaults to 10MB
+func MaxUploadBytes() int64 {
+	return int64Env("MAX_UPLOAD_BYTES", 10<<20)
+}
+
+// CommunityStorageQuota is how many bytes of files a community can store, COMMUNITY_STORAGE_QUOTA defaults to 500MB
+func CommunityStorageQuota() int64 {
+	return int64Env("COMMUNITY_STORAGE_QUOTA", 500<<20)
+}
+
+var fileURLSecret = []byte(requireEnv("FILE_URL_SECRET"))
+
+// FileURLSecret signs download links, FILE_URL_SECRET is required
+func FileURLSecret() []byte {
+	return fileURLSecret
+}
+
+// FileURLTTL is how long a signed download link stays valid
+func FileURLTTL() time.Duration {
+	ttl, err := time.ParseDuration(getEnv("FILE_URL_TTL", "15m"))
+	if err != nil || ttl <= 0 {
+		return 15 * time.Minute
+	}
+	return ttl
+}
+
+func int64Env(key string, fallback int64) int64 {
+	value, err := strconv.ParseInt(getEnv(key, ""), 10, 64)
+	if err != nil || value <= 0 {
+		return fallback
+	}
+	return value
+}
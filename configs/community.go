@@ -0,0 +1,65 @@
+package configs
+
+import (
+	"strconv"
+	"time"
+)
+
+// MaxPinnedAnnouncements is how many announcements a community can pin, PINNED_ANNOUNCEMENTS_LIMIT defaults to 3
+func MaxPinnedAnnouncements() int {
+	limit, err := strconv.Atoi(getEnv("PINNED_ANNOUNCEMENTS_LIMIT", "3"))
+	if err != nil || limit < 0 {
+		return 3
+	}
+	return limit
+}
+
+var checkinSecret = []byte(requireEnv("CHECKIN_SECRET"))
+
+// CheckinSecret signs event check-in tickets, CHECKIN_SECRET is required
+func CheckinSecret() []byte {
+	return checkinSecret
+}
+
+// CheckinWindow is how long after an event starts its tickets still work, events have no end
+// time so this stands in for one. CHECKIN_WINDOW defaults to 12h.
+func CheckinWindow() time.Duration {
+	window, err := time.ParseDuration(getEnv("CHECKIN_WINDOW", "12h"))
+	if err != nil || window < 0 {
+		return 12 * time.Hour
+	}
+	return window
+}
+
+// AnalyticsCacheTTL is how long computed community analytics are reused, ANALYTICS_CACHE_TTL defaults to 5m
+func AnalyticsCacheTTL() time.Duration {
+	ttl, err := time.ParseDuration(getEnv("ANALYTICS_CACHE_TTL", "5m"))
+	if err != nil || ttl < 0 {
+		return 5 * time.Minute
+	}
+	return ttl
+}
+
+// TrendingTTL is how often the trending rankings used by discovery are recomputed, TRENDING_TTL defaults to 10m
+func TrendingTTL() time.Duration {
+	ttl, err := time.ParseDuration(getEnv("TRENDING_TTL", "10m"))
+	if err != nil || ttl < 0 {
+		return 10 * time.Minute
+	}
+	return ttl
+}
+
+// AuditRetention is how long audit log entries are kept, AUDIT_RETENTION defaults to a year and 0 keeps them forever
+func AuditRetention() time.Duration {
+	retention, err := time.ParseDuration(getEnv("AUDIT_RETENTION", "8760h"))
+	if err != nil || retention < 0 {
+		return 8760 * time.Hour
+	}
+	return retention
+}
+
+// CronSecret is the bearer token the /cron endpoints require, they are disabled while
+// CRON_SECRET is unset
+func CronSecret() string {
+	return getEnv("CRON_SECRET", "")
+}
@@ -0,0 +1,35 @@
+package configs
+
+import (
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/zillalikestocode/community-api/geo"
+)
+
+var geocoder geo.Geocoder = newGeocoder()
+
+func newGeocoder() geo.Geocoder {
+	if os.Getenv("GEOCODER") == "nominatim" {
+		nominatim := &geo.Nominatim{
+			BaseURL:   getEnv("NOMINATIM_URL", "https://nominatim.openstreetmap.org"),
+			UserAgent: getEnv("GEOCODER_USER_AGENT", "community-api (+"+AppURL()+")"),
+			Client:    &http.Client{Timeout: 10 * time.Second},
+		}
+		// the public server allows a request a second, and addresses repeat a lot
+		return &geo.Cached{
+			Geocoder:   &geo.Throttled{Geocoder: nominatim, Interval: time.Second},
+			TTL:        24 * time.Hour,
+			MaxEntries: 10000,
+		}
+	}
+
+	// nothing geocodes, events need explicit coordinates to show up nearby
+	return &geo.Static{}
+}
+
+// UseGeocoder returns the geocoder selected by GEOCODER ("static" or "nominatim")
+func UseGeocoder() geo.Geocoder {
+	return geocoder
+}
@@ -0,0 +1,32 @@
+package configs
+
+import (
+	"os"
+	"strconv"
+
+	"github.com/zillalikestocode/community-api/jobs"
+)
+
+var jobQueue jobs.Queue = newJobQueue()
+
+func newJobQueue() jobs.Queue {
+	if os.Getenv("JOB_QUEUE") == "memory" {
+		return jobs.NewMemoryQueue()
+	}
+	return jobs.NewMongoQueue(GetCollection(DB, "jobs"))
+}
+
+// UseJobQueue returns the background job queue, JOB_QUEUE=memory keeps jobs in process
+// instead of the "jobs" collection
+func UseJobQueue() jobs.Queue {
+	return jobQueue
+}
+
+// JobWorkers is how many jobs run at once on this instance, JOB_WORKERS defaults to 4
+func JobWorkers() int {
+	workers, err := strconv.Atoi(getEnv("JOB_WORKERS", "4"))
+	if err != nil || workers < 1 {
+		return 4
+	}
+	return workers
+}
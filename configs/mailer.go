@@ -0,0 +1,49 @@
+package configs
+
+import (
+	"os"
+
+	"github.com/zillalikestocode/community-api/mailer"
+)
+
+// UseMailer returns the mailer selected by MAILER_DRIVER ("smtp" or "log")
+func UseMailer() mailer.Mailer {
+	if os.Getenv("MAILER_DRIVER") == "smtp" {
+		return &mailer.SMTP{
+			Host:     os.Getenv("SMTP_HOST"),
+			Port:     getEnv("SMTP_PORT", "587"),
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     getEnv("MAIL_FROM", "no-reply@community-api.local"),
+		}
+	}
+
+	return &mailer.Log{Dir: os.Getenv("MAIL_DIR")}
+}
+
+// AppURL is the public base url used in links sent to users
+func AppURL() string {
+	return getEnv("APP_URL", "http://localhost:3000")
+}
+
+// RequireVerifiedEmail blocks creating or joining communities until the user verifies their email
+func RequireVerifiedEmail() bool {
+	return os.Getenv("REQUIRE_VERIFIED_EMAIL") == "true"
+}
+
+func getEnv(key string, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// requireEnv is for settings there is no safe default for, such as signing secrets. It
+// panics when the variable is unset or empty so a misconfigured server doesn't start.
+func requireEnv(key string) string {
+	value := os.Getenv(key)
+	if value == "" {
+		panic(key + " must be set")
+	}
+	return value
+}
@@ -0,0 +1,29 @@
+package configs
+
+import (
+	"strings"
+	"time"
+
+	"github.com/zillalikestocode/community-api/pubsub"
+)
+
+var broker pubsub.Broker = newBroker()
+
+func newBroker() pubsub.Broker {
+	hub := pubsub.NewHub()
+	// PUBSUB_HISTORY_AGE is how long a client has to reconnect without missing events
+	if age, err := time.ParseDuration(getEnv("PUBSUB_HISTORY_AGE", "2m")); err == nil && age > 0 {
+		hub.HistoryAge = age
+	}
+	// notifications are stored and typing is stale by the time anyone reconnects, so
+	// neither the per-user topics nor typing indicators are kept for resuming
+	hub.Ephemeral = func(topic string, eventType string) bool {
+		return strings.HasPrefix(topic, "user:") || eventType == "typing"
+	}
+	return hub
+}
+
+// UseBroker returns the broker community events are published on
+func UseBroker() pubsub.Broker {
+	return broker
+}
@@ -0,0 +1,33 @@
+package configs
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/zillalikestocode/community-api/ratelimit"
+)
+
+var rateLimitStore ratelimit.Store = ratelimit.NewMemoryStore()
+
+// UseRateLimiter returns the limiter shared by all routes, active tells live sessions
+// apart from challenge and revoked tokens
+func UseRateLimiter(active ratelimit.SessionFunc) *ratelimit.Limiter {
+	return &ratelimit.Limiter{Store: rateLimitStore, Key: ratelimit.KeyByUserOrIP(UseJWT(), active)}
+}
+
+// RateLimit reads a requests-per-minute quota from the env variable, e.g. RATE_LIMIT_SEARCH=30
+func RateLimit(key string, fallback int) ratelimit.Limit {
+	requests := fallback
+	if value := os.Getenv(key); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			fmt.Printf("ignoring invalid %s=%q\n", key, value)
+		} else {
+			requests = parsed
+		}
+	}
+
+	return ratelimit.Limit{Requests: requests, Period: time.Minute}
+}
@@ -0,0 +1,24 @@
+package configs
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ReminderOffsets reads how long before an event reminders go out, e.g. REMINDER_OFFSETS=24h,1h
+func ReminderOffsets() []time.Duration {
+	value := getEnv("REMINDER_OFFSETS", "24h,1h")
+
+	offsets := []time.Duration{}
+	for _, part := range strings.Split(value, ",") {
+		offset, err := time.ParseDuration(strings.TrimSpace(part))
+		if err != nil || offset <= 0 {
+			fmt.Printf("ignoring invalid reminder offset %q\n", part)
+			continue
+		}
+		offsets = append(offsets, offset)
+	}
+
+	return offsets
+}
@@ -0,0 +1,11 @@
+package configs
+
+import "github.com/zillalikestocode/community-api/throttle"
+
+var throttleStore throttle.Store = throttle.NewMemoryStore()
+
+// UseThrottleStore returns the store shared by the login and signup guards,
+// swap it for a shared implementation when running more than one instance
+func UseThrottleStore() throttle.Store {
+	return throttleStore
+}
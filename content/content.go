@@ -0,0 +1,109 @@
+// Package content renders user written Markdown to sanitized HTML and pulls out
+// the @mentions and #hashtags it contains.
+package content
+
+import (
+	"bytes"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// Rendered is Markdown source with its HTML and the mentions and hashtags found in it,
+// names are lower case and listed once in the order they first appear
+type Rendered struct {
+	Source   string
+	HTML     string
+	Mentions []string
+	Hashtags []string
+}
+
+var markdown = goldmark.New(
+	goldmark.WithParser(newParser()),
+	goldmark.WithExtensions(extension.Strikethrough, extension.Linkify, tags),
+	goldmark.WithRendererOptions(html.WithHardWraps()),
+)
+
+// the default parser without HTML blocks. An HTML block runs to the end of its line, so
+// "<script>...</script> hi @bob" would lose both the text and the mention. Inline HTML is
+// still parsed and left out when rendering.
+func newParser() parser.Parser {
+	htmlBlock := reflect.TypeOf(parser.NewHTMLBlockParser())
+	blocks := []util.PrioritizedValue{}
+	for _, p := range parser.DefaultBlockParsers() {
+		if reflect.TypeOf(p.Value) != htmlBlock {
+			blocks = append(blocks, p)
+		}
+	}
+
+	return parser.NewParser(
+		parser.WithBlockParsers(blocks...),
+		parser.WithInlineParsers(parser.DefaultInlineParsers()...),
+		parser.WithParagraphTransformers(parser.DefaultParagraphTransformers()...),
+	)
+}
+
+var policy = newPolicy()
+
+// only basic formatting, links and code survive, links get rel="nofollow"
+func newPolicy() *bluemonday.Policy {
+	p := bluemonday.NewPolicy()
+	p.AllowElements("p", "br", "strong", "em", "del", "code", "pre", "blockquote", "ul", "ol", "li", "hr", "h1", "h2", "h3", "h4", "h5", "h6")
+	p.AllowAttrs("start").Matching(bluemonday.Integer).OnElements("ol")
+	p.AllowAttrs("href").OnElements("a")
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^(mention|hashtag)$`)).OnElements("a")
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^language-[\w-]+$`)).OnElements("code")
+	p.AllowURLSchemes("http", "https", "mailto")
+	p.AllowRelativeURLs(true)
+	p.RequireParseableURLs(true)
+	p.RequireNoFollowOnLinks(true)
+	return p
+}
+
+// Render converts Markdown to sanitized HTML. Raw HTML in the source is dropped, and
+// mentions and hashtags are only taken from the text that is displayed, not from link
+// text or image descriptions.
+func Render(source string) Rendered {
+	src := []byte(source)
+	doc := markdown.Parser().Parse(text.NewReader(src))
+
+	var buf bytes.Buffer
+	if err := markdown.Renderer().Render(&buf, src, doc); err != nil {
+		// fall back to the escaped source rather than failing the write
+		buf.Reset()
+		buf.WriteString("<p>" + strings.ReplaceAll(bluemonday.StrictPolicy().Sanitize(source), "\n", "<br>") + "</p>")
+	}
+
+	rendered := Rendered{Source: source, HTML: policy.Sanitize(buf.String())}
+	ast.Walk(doc, func(node ast.Node, entering bool) (ast.WalkStatus, error) {
+		if t, ok := node.(*Tag); ok && entering {
+			if t.Sigil == MentionSigil {
+				rendered.Mentions = appendUnique(rendered.Mentions, t.Name)
+			} else {
+				rendered.Hashtags = appendUnique(rendered.Hashtags, t.Name)
+			}
+		}
+		return ast.WalkContinue, nil
+	})
+
+	return rendered
+}
+
+func appendUnique(names []string, name string) []string {
+	name = strings.ToLower(name)
+	for _, existing := range names {
+		if existing == name {
+			return names
+		}
+	}
+	return append(names, name)
+}
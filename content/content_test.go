@@ -0,0 +1,101 @@
+package content
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name     string
+		source   string
+		html     []string
+		notHTML  []string
+		mentions []string
+		hashtags []string
+	}{
+		{
+			name:     "tags",
+			source:   "hi @Bob and @bob, see #Go",
+			html:     []string{`<a class="mention" href="/u/bob" rel="nofollow">@Bob</a>`, `<a class="hashtag" href="/tags/go" rel="nofollow">#Go</a>`},
+			mentions: []string{"bob"},
+			hashtags: []string{"go"},
+		},
+		{
+			name:   "email addresses and issue numbers",
+			source: "mail bob@example.com about C# and #12",
+			html:   []string{`href="mailto:bob@example.com"`},
+		},
+		{
+			name:     "javascript link",
+			source:   "[click](javascript:alert(1)) @carol",
+			notHTML:  []string{"javascript", "<a href"},
+			mentions: []string{"carol"},
+		},
+		{
+			name:     "raw html",
+			source:   `<script>alert(1)</script> hi @Bob <img src=x onerror="alert(1)">`,
+			html:     []string{"hi ", `href="/u/bob"`},
+			notHTML:  []string{"<script", "<img", "onerror"},
+			mentions: []string{"bob"},
+		},
+		{
+			name:     "html block",
+			source:   "<div onclick=\"x()\">\n@dan\n</div>",
+			notHTML:  []string{"<div", "onclick"},
+			mentions: []string{"dan"},
+		},
+		{
+			name:     "image",
+			source:   "![@erin #pic](http://example.com/a.png) #after",
+			notHTML:  []string{"<img", "/u/erin", "/tags/pic"},
+			hashtags: []string{"after"},
+		},
+		{
+			name:    "mention inside a link",
+			source:  "[@bob](http://example.com) [see #go](/x)",
+			html:    []string{`<a href="http://example.com" rel="nofollow">@bob</a>`, `<a href="/x" rel="nofollow">see #go</a>`},
+			notHTML: []string{"/u/bob", "/tags/go"},
+		},
+		{
+			name:    "mention inside a linkified url",
+			source:  "http://example.com/@bob",
+			html:    []string{`<a href="http://example.com/@bob" rel="nofollow">http://example.com/@bob</a>`},
+			notHTML: []string{"/u/bob"},
+		},
+		{
+			name:    "mention inside an autolink",
+			source:  "<http://example.com/@bob>",
+			notHTML: []string{"/u/bob"},
+		},
+		{
+			name:     "code",
+			source:   "`@code` @real",
+			html:     []string{"<code>@code</code>"},
+			mentions: []string{"real"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rendered := Render(tt.source)
+			for _, want := range tt.html {
+				if !strings.Contains(rendered.HTML, want) {
+					t.Errorf("html %q doesn't contain %q", rendered.HTML, want)
+				}
+			}
+			for _, unwanted := range tt.notHTML {
+				if strings.Contains(rendered.HTML, unwanted) {
+					t.Errorf("html %q contains %q", rendered.HTML, unwanted)
+				}
+			}
+			if !slices.Equal(rendered.Mentions, tt.mentions) {
+				t.Errorf("mentions = %q, want %q", rendered.Mentions, tt.mentions)
+			}
+			if !slices.Equal(rendered.Hashtags, tt.hashtags) {
+				t.Errorf("hashtags = %q, want %q", rendered.Hashtags, tt.hashtags)
+			}
+		})
+	}
+}
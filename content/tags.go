@@ -0,0 +1,161 @@
+package content
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+const (
+	MentionSigil = '@'
+	HashtagSigil = '#'
+
+	maxTagLength = 32
+)
+
+// MentionPath and HashtagPath are where rendered mentions and hashtags link to
+const (
+	MentionPath = "/u/"
+	HashtagPath = "/tags/"
+)
+
+var KindTag = ast.NewNodeKind("Tag")
+
+// Tag is an @mention or #hashtag in the document
+type Tag struct {
+	ast.BaseInline
+	Sigil byte
+	Name  string
+
+	// where the tag is in the source, to put it back as text when it turns out to be in a link
+	segment text.Segment
+}
+
+func (n *Tag) Kind() ast.NodeKind {
+	return KindTag
+}
+
+func (n *Tag) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"Sigil": string(n.Sigil), "Name": n.Name}, nil)
+}
+
+type tagExtension struct{}
+
+var tags = &tagExtension{}
+
+func (e *tagExtension) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(
+		parser.WithInlineParsers(util.Prioritized(&tagParser{}, 600)),
+		parser.WithASTTransformers(util.Prioritized(&tagTransformer{}, 600)),
+	)
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(util.Prioritized(&tagRenderer{}, 600)))
+}
+
+type tagParser struct{}
+
+func (p *tagParser) Trigger() []byte {
+	return []byte{MentionSigil, HashtagSigil}
+}
+
+// a tag starts after a non word character and runs over letters, digits and underscores,
+// so email addresses and things like "C#" are left alone
+func (p *tagParser) Parse(parent ast.Node, block text.Reader, pc parser.Context) ast.Node {
+	if prev := block.PrecendingCharacter(); isTagRune(prev) {
+		return nil
+	}
+
+	line, segment := block.PeekLine()
+	runes := []rune(string(line[1:]))
+	n := 0
+	for n < len(runes) && isTagRune(runes[n]) {
+		n++
+	}
+	if n == 0 || n > maxTagLength {
+		return nil
+	}
+	name := string(runes[:n])
+
+	// "#1" is an issue style reference rather than a hashtag
+	if line[0] == HashtagSigil && isDigits(name) {
+		return nil
+	}
+
+	block.Advance(1 + len(name))
+	return &Tag{Sigil: line[0], Name: name, segment: segment.WithStop(segment.Start + 1 + len(name))}
+}
+
+type tagTransformer struct{}
+
+// links are parsed after the text inside them, so the tags in a link's text can only be
+// found once the document is complete. They go back to plain text so "[@bob](http://x)"
+// doesn't nest links or mention bob, and the same goes for image descriptions.
+func (t *tagTransformer) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	var linked []*Tag
+	ast.Walk(doc, func(node ast.Node, entering bool) (ast.WalkStatus, error) {
+		if tag, ok := node.(*Tag); ok && entering && inLink(tag) {
+			linked = append(linked, tag)
+		}
+		return ast.WalkContinue, nil
+	})
+
+	for _, tag := range linked {
+		tag.Parent().ReplaceChild(tag.Parent(), tag, ast.NewTextSegment(tag.segment))
+	}
+}
+
+func inLink(node ast.Node) bool {
+	for parent := node.Parent(); parent != nil; parent = parent.Parent() {
+		switch parent.Kind() {
+		case ast.KindLink, ast.KindAutoLink, ast.KindImage:
+			return true
+		}
+	}
+	return false
+}
+
+func isTagRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if !unicode.IsDigit(r) {
+			return false
+		}
+	}
+	return true
+}
+
+type tagRenderer struct{}
+
+func (r *tagRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(KindTag, r.render)
+}
+
+func (r *tagRenderer) render(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+
+	tag := node.(*Tag)
+	class, path := "mention", MentionPath
+	if tag.Sigil == HashtagSigil {
+		class, path = "hashtag", HashtagPath
+	}
+
+	name := util.EscapeHTML([]byte(tag.Name))
+	w.WriteString(`<a class="` + class + `" href="` + path)
+	w.Write(util.URLEscape([]byte(strings.ToLower(tag.Name)), false))
+	w.WriteString(`">`)
+	w.WriteByte(tag.Sigil)
+	w.Write(name)
+	w.WriteString(`</a>`)
+
+	return ast.WalkSkipChildren, nil
+}
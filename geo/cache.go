@@ -0,0 +1,99 @@
+package geo
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// Cached remembers what Geocoder answered for each normalized address, including that
+// nothing was found, so the same address isn't looked up again within TTL. Other errors
+// aren't kept.
+type Cached struct {
+	Geocoder Geocoder
+	TTL      time.Duration
+	// MaxEntries bounds the cache, expired entries are dropped first when it is full
+	MaxEntries int
+
+	mu      sync.Mutex
+	entries map[string]cachedResult
+}
+
+type cachedResult struct {
+	point Point
+	err   error
+	at    time.Time
+}
+
+func (c *Cached) Geocode(ctx context.Context, address string) (Point, error) {
+	key := Normalize(address)
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	c.mu.Unlock()
+	if ok && time.Since(entry.at) < c.TTL {
+		return entry.point, entry.err
+	}
+
+	point, err := c.Geocoder.Geocode(ctx, address)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return point, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil {
+		c.entries = map[string]cachedResult{}
+	}
+	if c.MaxEntries > 0 && len(c.entries) >= c.MaxEntries {
+		c.evict()
+	}
+	c.entries[key] = cachedResult{point: point, err: err, at: time.Now()}
+	return point, err
+}
+
+// drop expired entries, or an arbitrary half when none have expired
+func (c *Cached) evict() {
+	for key, entry := range c.entries {
+		if time.Since(entry.at) >= c.TTL {
+			delete(c.entries, key)
+		}
+	}
+	for key := range c.entries {
+		if len(c.entries) < c.MaxEntries/2 {
+			return
+		}
+		delete(c.entries, key)
+	}
+}
+
+// Throttled spaces calls to Geocoder at least Interval apart across the whole process,
+// callers wait their turn or until their context ends
+type Throttled struct {
+	Geocoder Geocoder
+	Interval time.Duration
+
+	mu   sync.Mutex
+	next time.Time
+}
+
+func (t *Throttled) Geocode(ctx context.Context, address string) (Point, error) {
+	t.mu.Lock()
+	at := time.Now()
+	if t.next.After(at) {
+		at = t.next
+	}
+	t.next = at.Add(t.Interval)
+	t.mu.Unlock()
+
+	if wait := time.Until(at); wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+			return Point{}, ctx.Err()
+		case <-timer.C:
+		}
+	}
+	return t.Geocoder.Geocode(ctx, address)
+}
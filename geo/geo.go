@@ -0,0 +1,62 @@
+// Package geo turns addresses into coordinates and measures distances between them.
+package geo
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strings"
+)
+
+var ErrNotFound = errors.New("address not found")
+
+// Point is a position in degrees
+type Point struct {
+	Lat float64 `json:"lat"`
+	Lng float64 `json:"lng"`
+}
+
+// Valid reports whether the point is within the range of latitudes and longitudes
+func (p Point) Valid() bool {
+	return p.Lat >= -90 && p.Lat <= 90 && p.Lng >= -180 && p.Lng <= 180
+}
+
+// Geocoder looks up the coordinates of a free-form address
+type Geocoder interface {
+	// Geocode returns ErrNotFound when nothing matches the address
+	Geocode(ctx context.Context, address string) (Point, error)
+}
+
+// Static geocodes from a fixed table of addresses, for tests and running without a geocoding service
+type Static struct {
+	Places map[string]Point
+}
+
+func (s *Static) Geocode(ctx context.Context, address string) (Point, error) {
+	for place, point := range s.Places {
+		if Normalize(place) == Normalize(address) {
+			return point, nil
+		}
+	}
+	return Point{}, ErrNotFound
+}
+
+// Normalize lowercases an address and collapses its whitespace and commas so lookups
+// don't depend on formatting
+func Normalize(address string) string {
+	return strings.Join(strings.FieldsFunc(strings.ToLower(address), func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t' || r == '\n'
+	}), " ")
+}
+
+const earthRadius = 6371008.8
+
+// Distance is the great-circle distance between a and b in meters
+func Distance(a Point, b Point) float64 {
+	lat1, lat2 := a.Lat*math.Pi/180, b.Lat*math.Pi/180
+	dLat := lat2 - lat1
+	dLng := (b.Lng - a.Lng) * math.Pi / 180
+
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * earthRadius * math.Asin(math.Min(1, math.Sqrt(h)))
+}
@@ -0,0 +1,269 @@
+package geo
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+var (
+	london = Point{Lat: 51.5074, Lng: -0.1278}
+	paris  = Point{Lat: 48.8566, Lng: 2.3522}
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct{ address, want string }{
+		{"10 Downing St, London", "10 downing st london"},
+		{"  10  DOWNING st,,London\n", "10 downing st london"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := Normalize(tt.address); got != tt.want {
+			t.Errorf("Normalize(%q) = %q, want %q", tt.address, got, tt.want)
+		}
+	}
+}
+
+func TestDistance(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b Point
+		want float64
+	}{
+		{"same point", london, london, 0},
+		{"london to paris", london, paris, 343_500},
+		{"quarter of the equator", Point{0, 0}, Point{0, 90}, math.Pi / 2 * earthRadius},
+		{"across the antimeridian", Point{0, 179.5}, Point{0, -179.5}, math.Pi / 180 * earthRadius},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// within 0.5%, the earth isn't a sphere anyway
+			if got := Distance(tt.a, tt.b); math.Abs(got-tt.want) > tt.want*0.005+1e-6 {
+				t.Errorf("Distance = %.0f, want %.0f", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStatic(t *testing.T) {
+	static := &Static{Places: map[string]Point{"London, UK": london}}
+	if point, err := static.Geocode(context.Background(), "  london uk "); err != nil || point != london {
+		t.Errorf("Geocode = %v, %v", point, err)
+	}
+	if _, err := static.Geocode(context.Background(), "Paris"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Geocode(Paris) error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestParseSearch(t *testing.T) {
+	static := &Static{Places: map[string]Point{"London, UK": london}}
+
+	tests := []struct {
+		name  string
+		query string
+		want  Search
+		err   error
+	}{
+		{"coordinates", "lat=48.8566&lng=2.3522", Search{Near: paris, Radius: DefaultRadius, Days: DefaultDays}, nil},
+		{"address", "address=london+uk", Search{Near: london, Radius: DefaultRadius, Days: DefaultDays}, nil},
+		{"coordinates win over the address", "lat=48.8566&lng=2.3522&address=london+uk", Search{Near: paris, Radius: DefaultRadius, Days: DefaultDays}, nil},
+		{"unknown address", "address=atlantis", Search{}, ErrNotFound},
+		{"nothing", "", Search{}, ErrNoLocation},
+		{"only lat", "lat=48.8566", Search{}, ErrNoLocation},
+		{"latitude out of range", "lat=91&lng=0", Search{}, ErrNoLocation},
+		{"longitude out of range", "lat=0&lng=-181", Search{}, ErrNoLocation},
+		{"nan", "lat=NaN&lng=0", Search{}, ErrNoLocation},
+		{"radius", "lat=0&lng=0&radius=2.5", Search{Radius: 2.5, Days: DefaultDays}, nil},
+		{"radius capped", "lat=0&lng=0&radius=10000", Search{Radius: MaxRadius, Days: DefaultDays}, nil},
+		{"infinite radius capped", "lat=0&lng=0&radius=Inf", Search{Radius: MaxRadius, Days: DefaultDays}, nil},
+		{"zero radius", "lat=0&lng=0&radius=0", Search{}, ErrInvalidRadius},
+		{"negative radius", "lat=0&lng=0&radius=-5", Search{}, ErrInvalidRadius},
+		{"nan radius", "lat=0&lng=0&radius=NaN", Search{}, ErrInvalidRadius},
+		{"text radius", "lat=0&lng=0&radius=far", Search{}, ErrInvalidRadius},
+		{"days", "lat=0&lng=0&days=7", Search{Radius: DefaultRadius, Days: 7}, nil},
+		{"days capped", "lat=0&lng=0&days=9999", Search{Radius: DefaultRadius, Days: MaxDays}, nil},
+		{"invalid days", "lat=0&lng=0&days=-1", Search{Radius: DefaultRadius, Days: DefaultDays}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, _ := url.ParseQuery(tt.query)
+			got, err := ParseSearch(context.Background(), static, query)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("error = %v, want %v", err, tt.err)
+			}
+			if got != tt.want {
+				t.Errorf("ParseSearch = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGeoNear(t *testing.T) {
+	search := Search{Near: london, Radius: 12.5, Days: 3}
+	query := bson.M{"events": bson.M{"$elemMatch": bson.M{"location.point": bson.M{"$exists": true}}}}
+
+	stage := search.GeoNear("events.location.point", query)["$geoNear"].(bson.M)
+	near := stage["near"].(bson.M)
+	// GeoJSON puts the longitude first
+	if coordinates := near["coordinates"].(bson.A); near["type"] != "Point" || coordinates[0] != london.Lng || coordinates[1] != london.Lat {
+		t.Errorf("near = %v, want a point at [%v, %v]", near, london.Lng, london.Lat)
+	}
+	if stage["maxDistance"] != 12500.0 {
+		t.Errorf("maxDistance = %v, want the radius in meters", stage["maxDistance"])
+	}
+	if stage["key"] != "events.location.point" || stage["spherical"] != true || stage["distanceField"] != "distance" {
+		t.Errorf("stage = %v", stage)
+	}
+	if stage["query"].(bson.M)["events"] == nil {
+		t.Errorf("query = %v, want the passed filter", stage["query"])
+	}
+
+	// the stage has to marshal for the driver
+	if _, err := bson.Marshal(bson.M{"pipeline": bson.A{search.GeoNear("events.location.point", query)}}); err != nil {
+		t.Errorf("marshal: %v", err)
+	}
+}
+
+func TestWithin(t *testing.T) {
+	search := Search{Near: london, Radius: 400}
+	if distance, ok := search.Within(paris); !ok || distance < 340_000 || distance > 346_000 {
+		t.Errorf("Within(paris) = %.0f, %v", distance, ok)
+	}
+	search.Radius = 300
+	if _, ok := search.Within(paris); ok {
+		t.Errorf("paris is within 300km of london")
+	}
+}
+
+// counts calls to a Static geocoder
+type counting struct {
+	Static
+	mu    sync.Mutex
+	calls int
+	err   error
+}
+
+func (c *counting) Geocode(ctx context.Context, address string) (Point, error) {
+	c.mu.Lock()
+	c.calls++
+	err := c.err
+	c.mu.Unlock()
+	if err != nil {
+		return Point{}, err
+	}
+	return c.Static.Geocode(ctx, address)
+}
+
+func TestCached(t *testing.T) {
+	inner := &counting{Static: Static{Places: map[string]Point{"London": london}}}
+	cached := &Cached{Geocoder: inner, TTL: time.Hour}
+	ctx := context.Background()
+
+	for _, address := range []string{"London", "london", " LONDON, "} {
+		if point, err := cached.Geocode(ctx, address); err != nil || point != london {
+			t.Fatalf("Geocode(%q) = %v, %v", address, point, err)
+		}
+	}
+	// not found is remembered too
+	for i := 0; i < 2; i++ {
+		if _, err := cached.Geocode(ctx, "Atlantis"); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("Geocode(Atlantis) error = %v", err)
+		}
+	}
+	if inner.calls != 2 {
+		t.Errorf("%d lookups, want 2", inner.calls)
+	}
+
+	// other errors are not
+	inner.err = errors.New("service unavailable")
+	cached.Geocode(ctx, "Paris")
+	cached.Geocode(ctx, "Paris")
+	if inner.calls != 4 {
+		t.Errorf("%d lookups after errors, want 4", inner.calls)
+	}
+
+	// expired entries are looked up again
+	inner.err = nil
+	cached.TTL = 0
+	cached.Geocode(ctx, "London")
+	if inner.calls != 5 {
+		t.Errorf("%d lookups after expiry, want 5", inner.calls)
+	}
+}
+
+func TestCachedMaxEntries(t *testing.T) {
+	cached := &Cached{Geocoder: &Static{}, TTL: time.Hour, MaxEntries: 10}
+	for i := 0; i < 100; i++ {
+		cached.Geocode(context.Background(), string(rune('a'+i%26))+string(rune('a'+i/26)))
+	}
+	if len(cached.entries) > 10 {
+		t.Errorf("%d entries, want at most 10", len(cached.entries))
+	}
+}
+
+func TestThrottled(t *testing.T) {
+	inner := &counting{Static: Static{Places: map[string]Point{"London": london}}}
+	throttled := &Throttled{Geocoder: inner, Interval: 50 * time.Millisecond}
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			throttled.Geocode(context.Background(), "London")
+		}()
+	}
+	wg.Wait()
+	// the first goes straight away, the other three wait a turn each
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Errorf("4 lookups took %v, want at least 150ms", elapsed)
+	}
+
+	// a caller that gives up doesn't wait for its turn
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	throttled.Interval = time.Hour
+	throttled.Geocode(context.Background(), "London")
+	if _, err := throttled.Geocode(ctx, "London"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("error = %v, want DeadlineExceeded", err)
+	}
+}
+
+func TestNominatim(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/search" || r.URL.Query().Get("format") != "jsonv2" || r.Header.Get("User-Agent") != "test-agent" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		switch r.URL.Query().Get("q") {
+		case "London":
+			w.Write([]byte(`[{"lat": "51.5074", "lon": "-0.1278", "display_name": "London"}]`))
+		case "busy":
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			w.Write([]byte(`[]`))
+		}
+	}))
+	defer server.Close()
+
+	nominatim := &Nominatim{BaseURL: server.URL + "/", UserAgent: "test-agent", Client: server.Client()}
+	ctx := context.Background()
+	if point, err := nominatim.Geocode(ctx, "London"); err != nil || point != london {
+		t.Errorf("Geocode(London) = %v, %v", point, err)
+	}
+	if _, err := nominatim.Geocode(ctx, "Atlantis"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Geocode(Atlantis) error = %v, want ErrNotFound", err)
+	}
+	if _, err := nominatim.Geocode(ctx, "busy"); err == nil || errors.Is(err, ErrNotFound) {
+		t.Errorf("Geocode(busy) error = %v, want a service error", err)
+	}
+}
@@ -0,0 +1,92 @@
+package geo
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/url"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const (
+	DefaultRadius = 25.0
+	MaxRadius     = 500.0
+	DefaultDays   = 30
+	MaxDays       = 365
+)
+
+var (
+	ErrNoLocation    = errors.New("pass lat and lng, or an address")
+	ErrInvalidRadius = errors.New("radius must be a number of km above 0")
+)
+
+// Search is a nearby search, Radius is in km and Days is how far ahead to look
+type Search struct {
+	Near   Point
+	Radius float64
+	Days   int
+}
+
+// ParseSearch reads ?lat= and ?lng=, or an ?address= to geocode, and the optional
+// ?radius= and ?days=. Radii and days past the maximum are capped.
+func ParseSearch(ctx context.Context, geocoder Geocoder, query url.Values) (Search, error) {
+	search := Search{Radius: DefaultRadius, Days: DefaultDays}
+
+	lat, latErr := strconv.ParseFloat(query.Get("lat"), 64)
+	lng, lngErr := strconv.ParseFloat(query.Get("lng"), 64)
+	switch {
+	case latErr == nil && lngErr == nil:
+		search.Near = Point{Lat: lat, Lng: lng}
+	case query.Get("address") != "":
+		point, err := geocoder.Geocode(ctx, query.Get("address"))
+		if err != nil {
+			return Search{}, err
+		}
+		search.Near = point
+	default:
+		return Search{}, ErrNoLocation
+	}
+	if !search.Near.Valid() {
+		return Search{}, ErrNoLocation
+	}
+
+	if value := query.Get("radius"); value != "" {
+		radius, err := strconv.ParseFloat(value, 64)
+		if err != nil || math.IsNaN(radius) || radius <= 0 {
+			return Search{}, ErrInvalidRadius
+		}
+		search.Radius = min(radius, MaxRadius)
+	}
+	if value, err := strconv.Atoi(query.Get("days")); err == nil && value > 0 {
+		search.Days = min(value, MaxDays)
+	}
+	return search, nil
+}
+
+// GeoNear is the $geoNear stage finding documents with a point at key within the radius,
+// closest first, that also match query. The distance in meters goes in "distance".
+func (s Search) GeoNear(key string, query bson.M) bson.M {
+	return bson.M{"$geoNear": bson.M{
+		"near":          bson.M{"type": "Point", "coordinates": bson.A{s.Near.Lng, s.Near.Lat}},
+		"key":           key,
+		"distanceField": "distance",
+		"maxDistance":   s.Radius * 1000,
+		"spherical":     true,
+		"query":         query,
+	}}
+}
+
+// Until is the end of the time window the search looks ahead to
+func (s Search) Until(now time.Time) time.Time {
+	return now.AddDate(0, 0, s.Days)
+}
+
+// Within returns how many meters point is from the searched point, and whether that is
+// inside the radius
+func (s Search) Within(point Point) (float64, bool) {
+	distance := Distance(s.Near, point)
+	return distance, distance <= s.Radius*1000
+}
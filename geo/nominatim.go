@@ -0,0 +1,59 @@
+package geo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Nominatim geocodes with an OpenStreetMap Nominatim server. The public server requires
+// an identifying UserAgent and allows about one request a second.
+type Nominatim struct {
+	BaseURL   string
+	UserAgent string
+	Client    *http.Client
+}
+
+func (n *Nominatim) Geocode(ctx context.Context, address string) (Point, error) {
+	query := url.Values{"q": {address}, "format": {"jsonv2"}, "limit": {"1"}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(n.BaseURL, "/")+"/search?"+query.Encode(), nil)
+	if err != nil {
+		return Point{}, err
+	}
+	req.Header.Set("User-Agent", n.UserAgent)
+	req.Header.Set("Accept", "application/json")
+
+	res, err := n.Client.Do(req)
+	if err != nil {
+		return Point{}, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return Point{}, fmt.Errorf("geocoder responded %d", res.StatusCode)
+	}
+
+	var places []struct {
+		Lat string `json:"lat"`
+		Lon string `json:"lon"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&places); err != nil {
+		return Point{}, err
+	}
+	if len(places) == 0 {
+		return Point{}, ErrNotFound
+	}
+
+	lat, err := strconv.ParseFloat(places[0].Lat, 64)
+	if err != nil {
+		return Point{}, err
+	}
+	lng, err := strconv.ParseFloat(places[0].Lon, 64)
+	if err != nil {
+		return Point{}, err
+	}
+	return Point{Lat: lat, Lng: lng}, nil
+}
@@ -0,0 +1,258 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-chi/jwtauth/v5"
+	"github.com/zillalikestocode/community-api/analytics"
+	"github.com/zillalikestocode/community-api/configs"
+	"github.com/zillalikestocode/community-api/models"
+	"github.com/zillalikestocode/community-api/responses"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type analyticsReport struct {
+	From     time.Time `json:"from"`
+	To       time.Time `json:"to"`
+	Interval string    `json:"interval"`
+	// current members
+	Members     int                `json:"members"`
+	Totals      analytics.Bucket   `json:"totals"`
+	Series      []analytics.Bucket `json:"series"`
+	GeneratedAt time.Time          `json:"generatedAt"`
+}
+
+// reports are cached per community and range for configs.AnalyticsCacheTTL
+var analyticsCache = struct {
+	sync.Mutex
+	entries map[string]analyticsReport
+}{entries: map[string]analyticsReport{}}
+
+// activity of a community over time, admins only. Pass ?interval= day, week or month and
+// either ?from= and ?to= as RFC3339 times or ?periods= for the latest buckets. ?format=csv
+// downloads the series.
+func (c *Community) Analytics(w http.ResponseWriter, r *http.Request) {
+	_, claims, _ := jwtauth.FromContext(r.Context())
+	query := r.URL.Query()
+	userId, _ := primitive.ObjectIDFromHex(claims["id"].(string))
+	communityId, _ := primitive.ObjectIDFromHex(query.Get("communityId"))
+
+	if !requireCommunityAdmin(w, communityId, userId) {
+		return
+	}
+
+	from, to, interval, err := analytics.Range(time.Now(), query)
+	if err != nil {
+		message := map[error]string{
+			analytics.ErrInterval: "interval must be day, week or month",
+			analytics.ErrTo:       "to must be an RFC3339 time",
+			analytics.ErrFrom:     "from must be an RFC3339 time before to",
+			analytics.ErrTooLong:  "Ranges can cover at most " + strconv.Itoa(analytics.MaxBuckets) + " " + interval + "s",
+		}[err]
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: message})
+		return
+	}
+
+	report, err := communityAnalytics(context.TODO(), communityId, from, to, interval)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusInternalServerError, Message: "Unable to compute analytics", Data: map[string]interface{}{"error": err.Error()}})
+		return
+	}
+
+	if query.Get("format") == "csv" {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="analytics-`+communityId.Hex()+`-`+interval+`.csv"`)
+		w.WriteHeader(http.StatusOK)
+		analytics.WriteCSV(w, report.Series)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusOK, Message: "Analytics fetched successfully", Data: map[string]interface{}{"result": report}})
+}
+
+// compute, or reuse a cached, report for whole buckets between from and to
+func communityAnalytics(ctx context.Context, communityId primitive.ObjectID, from time.Time, to time.Time, interval string) (analyticsReport, error) {
+	key := communityId.Hex() + "|" + interval + "|" + strconv.FormatInt(from.Unix(), 10) + "|" + strconv.FormatInt(to.Unix(), 10)
+	now := time.Now()
+
+	analyticsCache.Lock()
+	cached, ok := analyticsCache.entries[key]
+	analyticsCache.Unlock()
+	if ok && now.Sub(cached.GeneratedAt) < configs.AnalyticsCacheTTL() {
+		return cached, nil
+	}
+
+	report := analyticsReport{From: from, To: to, Interval: interval, Series: analytics.Series(from, to, interval), GeneratedAt: now}
+	series := map[int64]*analytics.Bucket{}
+	for i := range report.Series {
+		series[report.Series[i].Start.Unix()] = &report.Series[i]
+	}
+	bucket := func(start time.Time) *analytics.Bucket {
+		if b, ok := series[start.UTC().Unix()]; ok {
+			return b
+		}
+		// outside the range, counted nowhere
+		return &analytics.Bucket{}
+	}
+
+	span := bson.M{"$gte": primitive.NewDateTimeFromTime(from), "$lt": primitive.NewDateTimeFromTime(to)}
+
+	// joins and leaves, the ones since the range ended are needed to work out the members at the time
+	var changes []struct {
+		ID struct {
+			Bucket time.Time `bson:"bucket"`
+			Type   string    `bson:"type"`
+		} `bson:"_id"`
+		Count int `bson:"count"`
+	}
+	cursor, err := membershipCollection.Aggregate(ctx, []bson.M{
+		{"$match": bson.M{"communityId": communityId, "at": bson.M{"$gte": primitive.NewDateTimeFromTime(from)}}},
+		{"$group": bson.M{"_id": bson.M{"bucket": analytics.TruncateDate("$at", interval), "type": "$type"}, "count": bson.M{"$sum": 1}}},
+	})
+	if err != nil {
+		return report, err
+	}
+	if err := cursor.All(ctx, &changes); err != nil {
+		return report, err
+	}
+	laterNet := 0
+	for _, change := range changes {
+		joined := change.ID.Type == models.MembershipJoined
+		switch {
+		case !change.ID.Bucket.Before(to) && joined:
+			laterNet += change.Count
+		case !change.ID.Bucket.Before(to):
+			laterNet -= change.Count
+		case joined:
+			bucket(change.ID.Bucket).Joins += change.Count
+		default:
+			bucket(change.ID.Bucket).Leaves += change.Count
+		}
+	}
+
+	// announcements published and events held, from the community document
+	var content []struct {
+		Members       []struct{ Count int } `bson:"members"`
+		Announcements []struct {
+			ID    time.Time `bson:"_id"`
+			Count int       `bson:"count"`
+		} `bson:"announcements"`
+		Events []struct {
+			ID    time.Time `bson:"_id"`
+			Count int       `bson:"count"`
+			RSVPs int       `bson:"rsvps"`
+		} `bson:"events"`
+	}
+	cursor, err = communityCollection.Aggregate(ctx, []bson.M{
+		{"$match": bson.M{"_id": communityId}},
+		{"$facet": bson.M{
+			"members": bson.A{bson.M{"$project": bson.M{"count": bson.M{"$size": bson.M{"$ifNull": bson.A{"$members", bson.A{}}}}}}},
+			"announcements": bson.A{
+				bson.M{"$unwind": "$announcements"},
+				bson.M{"$match": bson.M{"announcements.draft": bson.M{"$ne": true}, "announcements.date": span}},
+				bson.M{"$group": bson.M{"_id": analytics.TruncateDate("$announcements.date", interval), "count": bson.M{"$sum": 1}}},
+			},
+			"events": bson.A{
+				bson.M{"$unwind": "$events"},
+				bson.M{"$match": bson.M{"events.date": span}},
+				bson.M{"$group": bson.M{
+					"_id":   analytics.TruncateDate("$events.date", interval),
+					"count": bson.M{"$sum": 1},
+					"rsvps": bson.M{"$sum": bson.M{"$size": bson.M{"$ifNull": bson.A{"$events.attendees", bson.A{}}}}},
+				}},
+			},
+		}},
+	})
+	if err != nil {
+		return report, err
+	}
+	if err := cursor.All(ctx, &content); err != nil {
+		return report, err
+	}
+	if len(content) > 0 {
+		if len(content[0].Members) > 0 {
+			report.Members = content[0].Members[0].Count
+		}
+		for _, group := range content[0].Announcements {
+			bucket(group.ID).Announcements += group.Count
+		}
+		for _, group := range content[0].Events {
+			b := bucket(group.ID)
+			b.Events += group.Count
+			b.RSVPs += group.RSVPs
+		}
+	}
+
+	// distinct members taking part, per bucket and over the whole range
+	var active []struct {
+		Series []struct {
+			ID    time.Time `bson:"_id"`
+			Count int       `bson:"count"`
+		} `bson:"series"`
+		Total []struct {
+			Count int `bson:"count"`
+		} `bson:"total"`
+	}
+	participation := func(userField string, dateField string) []bson.M {
+		return []bson.M{
+			{"$match": bson.M{"communityId": communityId, dateField: span}},
+			{"$project": bson.M{"_id": 0, "userId": "$" + userField, "at": "$" + dateField}},
+		}
+	}
+	pipeline := participation("author.id", "createdAt")
+	pipeline = append(pipeline,
+		bson.M{"$unionWith": bson.M{"coll": messageCollection.Name(), "pipeline": participation("author.id", "createdAt")}},
+		bson.M{"$unionWith": bson.M{"coll": reactionCollection.Name(), "pipeline": participation("userId", "createdAt")}},
+		bson.M{"$unionWith": bson.M{"coll": pollVoteCollection.Name(), "pipeline": participation("userId", "createdAt")}},
+		bson.M{"$facet": bson.M{
+			"series": bson.A{
+				bson.M{"$group": bson.M{"_id": bson.M{"bucket": analytics.TruncateDate("$at", interval), "userId": "$userId"}}},
+				bson.M{"$group": bson.M{"_id": "$_id.bucket", "count": bson.M{"$sum": 1}}},
+			},
+			"total": bson.A{
+				bson.M{"$group": bson.M{"_id": "$userId"}},
+				bson.M{"$count": "count"},
+			},
+		}},
+	)
+	cursor, err = commentCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return report, err
+	}
+	if err := cursor.All(ctx, &active); err != nil {
+		return report, err
+	}
+	if len(active) > 0 {
+		for _, group := range active[0].Series {
+			bucket(group.ID).ActiveMembers += group.Count
+		}
+		if len(active[0].Total) > 0 {
+			report.Totals.ActiveMembers = active[0].Total[0].Count
+		}
+	}
+
+	analytics.FillMembers(report.Series, report.Members, laterNet)
+	activeMembers := report.Totals.ActiveMembers
+	report.Totals = analytics.Totals(report.Series)
+	report.Totals.ActiveMembers = activeMembers
+
+	analyticsCache.Lock()
+	for cachedKey, entry := range analyticsCache.entries {
+		if now.Sub(entry.GeneratedAt) >= configs.AnalyticsCacheTTL() {
+			delete(analyticsCache.entries, cachedKey)
+		}
+	}
+	analyticsCache.entries[key] = report
+	analyticsCache.Unlock()
+
+	return report, nil
+}
@@ -0,0 +1,187 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/zillalikestocode/community-api/configs"
+	"github.com/zillalikestocode/community-api/jobs"
+	"github.com/zillalikestocode/community-api/models"
+	"github.com/zillalikestocode/community-api/responses"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var announcementEditCollection *mongo.Collection = configs.GetCollection(configs.ConnectDB(), "announcement_edits")
+
+type announcementPayload struct {
+	CommunityId    primitive.ObjectID `json:"communityId"`
+	AnnouncementId primitive.ObjectID `json:"announcementId"`
+}
+
+// published and not yet expired
+func announcementLive(announcement models.Announcement, now time.Time) bool {
+	return !announcement.Draft && !announcement.Date.Time().After(now) && (announcement.ExpireAt == nil || announcement.ExpireAt.Time().After(now))
+}
+
+// the announcements a user can see with pinned ones first, admins also see drafts,
+// scheduled and expired ones
+func visibleAnnouncements(community models.Community, userId primitive.ObjectID) []models.Announcement {
+	admin := isAdmin(community, userId)
+	now := time.Now()
+
+	pinned := []models.Announcement{}
+	visible := []models.Announcement{}
+	for _, announcement := range community.Announcements {
+		if !admin && !announcementLive(announcement, now) {
+			continue
+		}
+		if slices.Contains(community.PinnedAnnouncements, announcement.ID) {
+			announcement.Pinned = true
+			pinned = append(pinned, announcement)
+		} else {
+			visible = append(visible, announcement)
+		}
+	}
+
+	slices.SortStableFunc(pinned, func(a, b models.Announcement) int {
+		return slices.Index(community.PinnedAnnouncements, a.ID) - slices.Index(community.PinnedAnnouncements, b.ID)
+	})
+	return append(pinned, visible...)
+}
+
+// set the avatars of the creators of the communities' announcements
+func withCreatorAvatars(ctx context.Context, communities []models.Community) {
+	var creators []*models.Author
+	for i := range communities {
+		for j := range communities[i].Announcements {
+			creators = append(creators, &communities[i].Announcements[j].Creator)
+		}
+	}
+	withAvatars(ctx, creators...)
+}
+
+func findAnnouncement(community models.Community, announcementId primitive.ObjectID) (models.Announcement, bool) {
+	for _, announcement := range community.Announcements {
+		if announcement.ID == announcementId {
+			return announcement, true
+		}
+	}
+	return models.Announcement{}, false
+}
+
+// drafts are for admins only, an author who is no longer one can't reach theirs
+func canManageAnnouncement(community models.Community, announcement models.Announcement, userId primitive.ObjectID) bool {
+	return isAdmin(community, userId) || (announcement.Creator.ID == userId && !announcement.Draft)
+}
+
+// publish now when the announcement is due, otherwise queue the publisher for its publish time
+func scheduleAnnouncement(ctx context.Context, communityId primitive.ObjectID, announcement models.Announcement) {
+	if announcement.Draft {
+		return
+	}
+
+	payload := announcementPayload{CommunityId: communityId, AnnouncementId: announcement.ID}
+	if delay := time.Until(announcement.Date.Time()); delay > 0 {
+		enqueue(ctx, JobPublishAnnouncement, payload, jobs.Delay(delay))
+		return
+	}
+	publishAnnouncement(ctx, payload)
+}
+
+func runPublishAnnouncement(ctx context.Context, job *jobs.Job) error {
+	var payload announcementPayload
+	if err := job.Decode(&payload); err != nil {
+		return err
+	}
+	return publishAnnouncement(ctx, payload)
+}
+
+// send the announcement.created event once. The scheduled flag is cleared atomically so a
+// job that runs twice, or one left over from before a reschedule, doesn't notify again.
+func publishAnnouncement(ctx context.Context, payload announcementPayload) error {
+	var community models.Community
+	due := bson.M{
+		"id":        payload.AnnouncementId,
+		"scheduled": true,
+		"draft":     bson.M{"$ne": true},
+		"date":      bson.M{"$lte": primitive.NewDateTimeFromTime(time.Now())},
+	}
+
+	filters := options.ArrayFilters{Filters: []interface{}{bson.M{"a.id": payload.AnnouncementId}}}
+	err := communityCollection.FindOneAndUpdate(ctx,
+		bson.M{"_id": payload.CommunityId, "announcements": bson.M{"$elemMatch": due}},
+		bson.M{"$unset": bson.M{"announcements.$[a].scheduled": ""}},
+		options.FindOneAndUpdate().SetArrayFilters(filters).SetReturnDocument(options.After),
+	).Decode(&community)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		// already published, still a draft, or not due yet
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, announcement := range community.Announcements {
+		if announcement.ID == payload.AnnouncementId {
+			emit(ctx, community.ID, announcement.Creator.ID, EventAnnouncementCreated, map[string]interface{}{"announcement": announcement})
+			notifyMentions(ctx, community, announcement.Creator.ID, announcement.Creator.Name, announcement.Mentions, announcement.Message, map[string]interface{}{"announcementId": announcement.ID})
+			return nil
+		}
+	}
+
+	fmt.Printf("announcement %s not found when publishing\n", payload.AnnouncementId.Hex())
+	return nil
+}
+
+// find an announcement the user may manage, writes the response when it can't be found or they aren't allowed
+func findManagedAnnouncement(w http.ResponseWriter, communityId primitive.ObjectID, announcementId primitive.ObjectID, userId primitive.ObjectID) (models.Community, models.Announcement, bool) {
+	var community models.Community
+	if err := communityCollection.FindOne(context.TODO(), bson.M{"_id": communityId}).Decode(&community); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "Unable to find community", Data: map[string]interface{}{"error": err.Error()}})
+		return community, models.Announcement{}, false
+	}
+
+	announcement, ok := findAnnouncement(community, announcementId)
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "Unable to find announcement"})
+		return community, announcement, false
+	}
+	if !canManageAnnouncement(community, announcement, userId) {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusForbidden, Message: "Only admins and the author can change this announcement"})
+		return community, announcement, false
+	}
+	return community, announcement, true
+}
+
+func sameTime(a *primitive.DateTime, b *primitive.DateTime) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// remove the history, comments, reactions and files of a deleted announcement
+func runPurgeAnnouncement(ctx context.Context, job *jobs.Job) error {
+	var payload purgePayload
+	if err := job.Decode(&payload); err != nil {
+		return err
+	}
+	if _, err := announcementEditCollection.DeleteMany(ctx, bson.M{"announcementId": payload.ID}); err != nil {
+		return err
+	}
+	if err := purgeDiscussion(ctx, payload.ID); err != nil {
+		return err
+	}
+	return purgeFiles(ctx, payload.ID)
+}
@@ -0,0 +1,193 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/jwtauth/v5"
+	"github.com/zillalikestocode/community-api/configs"
+	"github.com/zillalikestocode/community-api/models"
+	"github.com/zillalikestocode/community-api/responses"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var auditCollection *mongo.Collection = configs.GetCollection(configs.ConnectDB(), "audit_log")
+
+// append an entry to the community's audit log. before and after are snapshots of the
+// resource, nil when it didn't exist. Failures are logged so they never block the action itself.
+func audit(ctx context.Context, communityId primitive.ObjectID, actorId primitive.ObjectID, action string, resourceType string, resourceId primitive.ObjectID, before interface{}, after interface{}) {
+	entry := models.AuditEntry{
+		ID:           primitive.NewObjectID(),
+		CommunityID:  communityId,
+		ActorID:      actorId,
+		Action:       action,
+		ResourceType: resourceType,
+		ResourceID:   resourceId,
+		Before:       snapshot(before),
+		After:        snapshot(after),
+		CreatedAt:    primitive.NewDateTimeFromTime(time.Now()),
+	}
+
+	if _, err := auditCollection.InsertOne(ctx, entry); err != nil {
+		fmt.Printf("unable to record %s %s %s in the audit log: %v\n", action, resourceType, resourceId.Hex(), err)
+	}
+}
+
+// copy a model into a plain document so the entry keeps its state at the time of the action
+func snapshot(value interface{}) bson.M {
+	if value == nil {
+		return nil
+	}
+	data, err := bson.Marshal(value)
+	if err != nil {
+		fmt.Printf("unable to snapshot %T for the audit log: %v\n", value, err)
+		return nil
+	}
+	var document bson.M
+	bson.Unmarshal(data, &document)
+	return document
+}
+
+// page through a community's audit log, newest first, admins only. Filter with ?action=,
+// ?resourceType=, ?resourceId=, ?actorId= and RFC3339 ?from= / ?to=, pass the last id as ?before= for older entries
+func (c *Community) AuditLog(w http.ResponseWriter, r *http.Request) {
+	_, claims, _ := jwtauth.FromContext(r.Context())
+	var result []models.AuditEntry
+	query := r.URL.Query()
+	userId, _ := primitive.ObjectIDFromHex(claims["id"].(string))
+	communityId, _ := primitive.ObjectIDFromHex(query.Get("communityId"))
+
+	if !requireCommunityAdmin(w, communityId, userId) {
+		return
+	}
+
+	limit := historyPageSize
+	if value, err := strconv.Atoi(query.Get("limit")); err == nil && value > 0 && value <= historyMaxPageSize {
+		limit = value
+	}
+
+	filter := bson.M{"communityId": communityId}
+	if action := query.Get("action"); action != "" {
+		filter["action"] = action
+	}
+	if resourceType := query.Get("resourceType"); resourceType != "" {
+		filter["resourceType"] = resourceType
+	}
+	for param, field := range map[string]string{"resourceId": "resourceId", "actorId": "actorId"} {
+		if query.Get(param) == "" {
+			continue
+		}
+		id, err := primitive.ObjectIDFromHex(query.Get(param))
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: param + " must be an id"})
+			return
+		}
+		filter[field] = id
+	}
+	createdAt := bson.M{}
+	for param, operator := range map[string]string{"from": "$gte", "to": "$lt"} {
+		if query.Get(param) == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, query.Get(param))
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: param + " must be an RFC3339 time"})
+			return
+		}
+		createdAt[operator] = primitive.NewDateTimeFromTime(parsed)
+	}
+	if len(createdAt) > 0 {
+		filter["createdAt"] = createdAt
+	}
+	if before, err := primitive.ObjectIDFromHex(query.Get("before")); err == nil {
+		filter["_id"] = bson.M{"$lt": before}
+	}
+
+	cursor, _ := auditCollection.Find(context.TODO(), filter, options.Find().SetSort(bson.M{"_id": -1}).SetLimit(int64(limit)))
+	if err := cursor.All(context.TODO(), &result); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "A server error has occured", Data: map[string]interface{}{"error": err.Error()}})
+		return
+	}
+
+	actorIds := []primitive.ObjectID{}
+	for _, entry := range result {
+		actorIds = append(actorIds, entry.ActorID)
+	}
+	var actors []models.User
+	if len(actorIds) > 0 {
+		cursor, _ = userCollection.Find(context.TODO(), bson.M{"_id": bson.M{"$in": actorIds}}, options.Find().SetProjection(bson.M{"name": 1, "avatar": 1}))
+		cursor.All(context.TODO(), &actors)
+	}
+	names := map[primitive.ObjectID]models.User{}
+	for _, actor := range actors {
+		names[actor.ID] = userImages(actor)
+	}
+	for i := range result {
+		result[i].ActorName = names[result[i].ActorID].Name
+		result[i].ActorAvatar = names[result[i].ActorID].Avatar
+	}
+
+	var next interface{}
+	if len(result) == limit {
+		next = result[len(result)-1].ID
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusOK, Message: "Audit log fetched successfully", Data: map[string]interface{}{"result": result, "before": next}})
+}
+
+// name of the TTL index that enforces AUDIT_RETENTION
+const auditRetentionIndex = "createdAt_1"
+
+// keep the TTL index on createdAt in line with configs.AuditRetention. An existing index is
+// changed with collMod rather than rebuilt, and a retention of 0 drops it to keep entries forever.
+func ensureAuditRetention(ctx context.Context) error {
+	retention := int32(min(configs.AuditRetention()/time.Second, math.MaxInt32))
+	if retention <= 0 {
+		if _, err := auditCollection.Indexes().DropOne(ctx, auditRetentionIndex); err != nil && !isIndexNotFound(err) {
+			return err
+		}
+		return nil
+	}
+
+	var indexes []struct {
+		Name               string `bson:"name"`
+		ExpireAfterSeconds *int32 `bson:"expireAfterSeconds"`
+	}
+	cursor, err := auditCollection.Indexes().List(ctx)
+	if err != nil {
+		return err
+	}
+	if err := cursor.All(ctx, &indexes); err != nil {
+		return err
+	}
+	for _, index := range indexes {
+		if index.Name != auditRetentionIndex {
+			continue
+		}
+		if index.ExpireAfterSeconds != nil && *index.ExpireAfterSeconds == retention {
+			return nil
+		}
+		return auditCollection.Database().RunCommand(ctx, bson.D{
+			{Key: "collMod", Value: auditCollection.Name()},
+			{Key: "index", Value: bson.M{"name": auditRetentionIndex, "expireAfterSeconds": retention}},
+		}).Err()
+	}
+
+	_, err = auditCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "createdAt", Value: 1}},
+		Options: options.Index().SetName(auditRetentionIndex).SetExpireAfterSeconds(retention),
+	})
+	return err
+}
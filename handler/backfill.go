@@ -0,0 +1,12 @@
+package handler
+
+import "context"
+
+// Backfill fills in fields that were added after documents were created, it is safe to
+// call on every start
+func Backfill(ctx context.Context) error {
+	if err := backfillUsernames(ctx); err != nil {
+		return err
+	}
+	return backfillJoinedAt(ctx)
+}
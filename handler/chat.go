@@ -0,0 +1,199 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/jwtauth/v5"
+	"github.com/zillalikestocode/community-api/configs"
+	"github.com/zillalikestocode/community-api/models"
+	"github.com/zillalikestocode/community-api/responses"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type Chat struct {
+}
+
+var channelCollection *mongo.Collection = configs.GetCollection(configs.ConnectDB(), "channels")
+var messageCollection *mongo.Collection = configs.GetCollection(configs.ConnectDB(), "messages")
+
+const (
+	historyPageSize    = 50
+	historyMaxPageSize = 100
+	maxMessageLength   = 4000
+)
+
+// create a chat channel, admins only
+func (c *Chat) CreateChannel(w http.ResponseWriter, r *http.Request) {
+	_, claims, _ := jwtauth.FromContext(r.Context())
+	var body struct {
+		CommunityId string `json:"communityId"`
+		Name        string `json:"name"`
+		Description string `json:"description"`
+		AdminsOnly  bool   `json:"adminsOnly"`
+	}
+	var community models.Community
+	userId, _ := primitive.ObjectIDFromHex(claims["id"].(string))
+
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || strings.TrimSpace(body.Name) == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "Please pass the required details"})
+		return
+	}
+
+	communityId, _ := primitive.ObjectIDFromHex(body.CommunityId)
+	if err := communityCollection.FindOne(context.TODO(), bson.M{"_id": communityId}).Decode(&community); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "Unable to find community", Data: map[string]interface{}{"error": err.Error(), "id": communityId}})
+		return
+	}
+
+	if !isAdmin(community, userId) {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusForbidden, Message: "Only community admins can create channels"})
+		return
+	}
+
+	channel := models.Channel{
+		ID:          primitive.NewObjectID(),
+		CommunityID: communityId,
+		Name:        strings.TrimSpace(body.Name),
+		Description: body.Description,
+		AdminsOnly:  body.AdminsOnly,
+		CreatedBy:   userId,
+		CreatedAt:   primitive.NewDateTimeFromTime(time.Now()),
+	}
+	if _, err := channelCollection.InsertOne(context.TODO(), channel); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "An error occured while creating the channel", Data: map[string]interface{}{"error": err.Error()}})
+		return
+	}
+
+	audit(context.TODO(), communityId, userId, models.AuditCreate, models.AuditChannel, channel.ID, nil, channel)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusCreated, Message: "Channel created", Data: map[string]interface{}{"channel": channel}})
+}
+
+// delete a chat channel and its history, admins only
+func (c *Chat) DeleteChannel(w http.ResponseWriter, r *http.Request) {
+	_, claims, _ := jwtauth.FromContext(r.Context())
+	var body struct {
+		ChannelId string `json:"channelId"`
+	}
+	json.NewDecoder(r.Body).Decode(&body)
+	userId, _ := primitive.ObjectIDFromHex(claims["id"].(string))
+	channelId, _ := primitive.ObjectIDFromHex(body.ChannelId)
+
+	channel, community, err := findChannel(context.TODO(), channelId)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "Unable to find channel", Data: map[string]interface{}{"error": err.Error()}})
+		return
+	}
+
+	if !isAdmin(community, userId) {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusForbidden, Message: "Only community admins can delete channels"})
+		return
+	}
+
+	channelCollection.DeleteOne(context.TODO(), bson.M{"_id": channel.ID})
+	audit(context.TODO(), community.ID, userId, models.AuditDelete, models.AuditChannel, channel.ID, channel, nil)
+	enqueue(context.TODO(), JobPurgeChannel, purgePayload{ID: channel.ID})
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusOK, Message: "Channel deleted"})
+}
+
+// list the channels of a community
+func (c *Chat) ListChannels(w http.ResponseWriter, r *http.Request) {
+	_, claims, _ := jwtauth.FromContext(r.Context())
+	var community models.Community
+	var result []models.Channel
+	userId, _ := primitive.ObjectIDFromHex(claims["id"].(string))
+	communityId, _ := primitive.ObjectIDFromHex(r.URL.Query().Get("communityId"))
+
+	if err := communityCollection.FindOne(context.TODO(), bson.M{"_id": communityId}).Decode(&community); err != nil || !isMember(community, userId) {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusForbidden, Message: "You are not a member of this community"})
+		return
+	}
+
+	cursor, _ := channelCollection.Find(context.TODO(), bson.M{"communityId": communityId}, options.Find().SetSort(bson.M{"name": 1}))
+	if err := cursor.All(context.TODO(), &result); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "A server error has occured", Data: map[string]interface{}{"error": err.Error()}})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusOK, Message: "Channels fetched successfully", Data: map[string]interface{}{"result": result}})
+}
+
+// page through channel history, newest first, pass the last id as ?before= for older messages
+func (c *Chat) History(w http.ResponseWriter, r *http.Request) {
+	_, claims, _ := jwtauth.FromContext(r.Context())
+	var result []models.ChatMessage
+	userId, _ := primitive.ObjectIDFromHex(claims["id"].(string))
+	channelId, _ := primitive.ObjectIDFromHex(r.URL.Query().Get("channelId"))
+
+	channel, community, err := findChannel(context.TODO(), channelId)
+	if err != nil || !isMember(community, userId) {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusForbidden, Message: "You are not a member of this community"})
+		return
+	}
+
+	limit := historyPageSize
+	if value, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && value > 0 && value <= historyMaxPageSize {
+		limit = value
+	}
+
+	filter := bson.M{"channelId": channel.ID, "deleted": bson.M{"$ne": true}}
+	if before, err := primitive.ObjectIDFromHex(r.URL.Query().Get("before")); err == nil {
+		filter["_id"] = bson.M{"$lt": before}
+	}
+
+	cursor, _ := messageCollection.Find(context.TODO(), filter, options.Find().SetSort(bson.M{"_id": -1}).SetLimit(int64(limit)))
+	if err := cursor.All(context.TODO(), &result); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "A server error has occured", Data: map[string]interface{}{"error": err.Error()}})
+		return
+	}
+	authors := make([]*models.Author, 0, len(result))
+	for i := range result {
+		authors = append(authors, &result[i].Author)
+	}
+	withAvatars(context.TODO(), authors...)
+
+	var next interface{}
+	if len(result) == limit {
+		next = result[len(result)-1].ID
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusOK, Message: "Messages fetched successfully", Data: map[string]interface{}{"result": result, "before": next}})
+}
+
+func findChannel(ctx context.Context, channelId primitive.ObjectID) (models.Channel, models.Community, error) {
+	var channel models.Channel
+	var community models.Community
+
+	if err := channelCollection.FindOne(ctx, bson.M{"_id": channelId}).Decode(&channel); err != nil {
+		return channel, community, err
+	}
+	err := communityCollection.FindOne(ctx, bson.M{"_id": channel.CommunityID}).Decode(&community)
+
+	return channel, community, err
+}
+
+func channelTopic(channelId primitive.ObjectID) string {
+	return "channel:" + channelId.Hex()
+}
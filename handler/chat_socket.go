@@ -0,0 +1,314 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/jwtauth/v5"
+	"github.com/gorilla/websocket"
+	"github.com/zillalikestocode/community-api/configs"
+	"github.com/zillalikestocode/community-api/content"
+	"github.com/zillalikestocode/community-api/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// chat message types sent to channel subscribers
+const (
+	EventMessageCreated = "message.created"
+	EventMessageUpdated = "message.updated"
+	EventMessageDeleted = "message.deleted"
+	EventTyping         = "typing"
+)
+
+const (
+	socketPongWait     = 60 * time.Second
+	socketPingInterval = 30 * time.Second
+	socketWriteWait    = 10 * time.Second
+	socketMaxFrame     = 16 * 1024
+	typingInterval     = 3 * time.Second
+)
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	// origins are already open through cors and the socket is authenticated by token
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// frames sent by the client
+type chatFrame struct {
+	Type      string `json:"type"`
+	ChannelId string `json:"channelId,omitempty"`
+	MessageId string `json:"messageId,omitempty"`
+	Body      string `json:"body,omitempty"`
+}
+
+type chatSession struct {
+	ctx      context.Context
+	conn     *websocket.Conn
+	user     models.User
+	writeMu  sync.Mutex
+	channels map[primitive.ObjectID]context.CancelFunc
+	typingAt map[primitive.ObjectID]time.Time
+}
+
+// upgrade to a websocket carrying every channel the client joins
+func (c *Chat) Connect(w http.ResponseWriter, r *http.Request) {
+	_, claims, _ := jwtauth.FromContext(r.Context())
+	var user models.User
+	userId, _ := primitive.ObjectIDFromHex(claims["id"].(string))
+
+	if err := userCollection.FindOne(context.TODO(), bson.M{"_id": userId}).Decode(&user); err != nil {
+		http.Error(w, "user not found", http.StatusUnauthorized)
+		return
+	}
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	defer conn.Close()
+
+	session := &chatSession{
+		ctx:      ctx,
+		conn:     conn,
+		user:     user,
+		channels: map[primitive.ObjectID]context.CancelFunc{},
+		typingAt: map[primitive.ObjectID]time.Time{},
+	}
+
+	conn.SetReadLimit(socketMaxFrame)
+	conn.SetReadDeadline(time.Now().Add(socketPongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(socketPongWait))
+	})
+	go session.ping()
+
+	for {
+		var frame chatFrame
+		if err := conn.ReadJSON(&frame); err != nil {
+			return
+		}
+		session.handle(frame)
+	}
+}
+
+func (s *chatSession) handle(frame chatFrame) {
+	switch frame.Type {
+	case "join":
+		s.join(frame)
+	case "leave":
+		channelId, _ := primitive.ObjectIDFromHex(frame.ChannelId)
+		if stop, ok := s.channels[channelId]; ok {
+			stop()
+			delete(s.channels, channelId)
+		}
+		s.write(map[string]interface{}{"type": "left", "channelId": channelId})
+	case "send":
+		s.send(frame)
+	case "edit":
+		s.edit(frame)
+	case "delete":
+		s.remove(frame)
+	case "typing":
+		s.typing(frame)
+	default:
+		s.fail("Unknown frame type")
+	}
+}
+
+func (s *chatSession) join(frame chatFrame) {
+	channelId, _ := primitive.ObjectIDFromHex(frame.ChannelId)
+	if _, ok := s.channels[channelId]; ok {
+		return
+	}
+
+	channel, community, err := findChannel(s.ctx, channelId)
+	if err != nil || !isMember(community, s.user.ID) {
+		s.fail("You can't join this channel")
+		return
+	}
+
+	ctx, stop := context.WithCancel(s.ctx)
+	messages, err := configs.UseBroker().Subscribe(ctx, []string{channelTopic(channel.ID)}, "")
+	if err != nil {
+		stop()
+		s.fail("Unable to join channel")
+		return
+	}
+	s.channels[channel.ID] = stop
+
+	go func() {
+		for msg := range messages {
+			s.write(map[string]interface{}{"type": msg.Type, "channelId": channel.ID, "data": msg.Data})
+		}
+	}()
+
+	s.write(map[string]interface{}{"type": "joined", "channelId": channel.ID, "canPost": canPost(channel, community, s.user.ID)})
+}
+
+func (s *chatSession) send(frame chatFrame) {
+	channelId, _ := primitive.ObjectIDFromHex(frame.ChannelId)
+	body := strings.TrimSpace(frame.Body)
+	if body == "" || len(body) > maxMessageLength {
+		s.fail("Message must be between 1 and 4000 characters")
+		return
+	}
+
+	// membership is checked again on every post in case the user left or was removed
+	channel, community, err := findChannel(s.ctx, channelId)
+	if err != nil || !canPost(channel, community, s.user.ID) {
+		s.fail("You can't post in this channel")
+		return
+	}
+
+	mentions, err := resolveMentions(s.ctx, community, s.user.ID, content.Render(body).Mentions)
+	if err != nil {
+		s.fail(mentionError(err))
+		return
+	}
+
+	message := models.ChatMessage{
+		ID:          primitive.NewObjectID(),
+		ChannelID:   channel.ID,
+		CommunityID: channel.CommunityID,
+		Body:        body,
+		Mentions:    mentions,
+		CreatedAt:   primitive.NewDateTimeFromTime(time.Now()),
+	}
+	message.Author.ID = s.user.ID
+	message.Author.Name = s.user.Name
+	message.Author.Avatar = userImages(s.user).Avatar
+
+	if _, err := messageCollection.InsertOne(s.ctx, message); err != nil {
+		s.fail("Unable to send message")
+		return
+	}
+
+	configs.UseBroker().Publish(s.ctx, channelTopic(channel.ID), EventMessageCreated, message)
+	go notifyMentions(context.Background(), community, s.user.ID, s.user.Name, message.Mentions, message.Body, map[string]interface{}{"channelId": channel.ID, "messageId": message.ID})
+}
+
+func (s *chatSession) edit(frame chatFrame) {
+	messageId, _ := primitive.ObjectIDFromHex(frame.MessageId)
+	body := strings.TrimSpace(frame.Body)
+	if body == "" || len(body) > maxMessageLength {
+		s.fail("Message must be between 1 and 4000 characters")
+		return
+	}
+
+	var message models.ChatMessage
+	if err := messageCollection.FindOne(s.ctx, bson.M{"_id": messageId, "deleted": bson.M{"$ne": true}}).Decode(&message); err != nil || message.Author.ID != s.user.ID {
+		s.fail("You can only edit your own messages")
+		return
+	}
+
+	_, community, err := findChannel(s.ctx, message.ChannelID)
+	if err != nil {
+		s.fail("Unable to edit message")
+		return
+	}
+	mentions, err := resolveMentions(s.ctx, community, s.user.ID, content.Render(body).Mentions)
+	if err != nil {
+		s.fail(mentionError(err))
+		return
+	}
+
+	now := primitive.NewDateTimeFromTime(time.Now())
+	if _, err := messageCollection.UpdateOne(s.ctx, bson.M{"_id": messageId}, bson.M{"$set": bson.M{"body": body, "mentionRefs": mentions, "editedAt": now}}); err != nil {
+		s.fail("Unable to edit message")
+		return
+	}
+	previousMentions := message.Mentions
+	message.Author.Avatar = userImages(s.user).Avatar
+	message.Body = body
+	message.Mentions = mentions
+	message.EditedAt = &now
+
+	configs.UseBroker().Publish(s.ctx, channelTopic(message.ChannelID), EventMessageUpdated, message)
+	go notifyMentions(context.Background(), community, s.user.ID, s.user.Name, addedMentions(previousMentions, mentions), message.Body, map[string]interface{}{"channelId": message.ChannelID, "messageId": message.ID})
+}
+
+func (s *chatSession) remove(frame chatFrame) {
+	messageId, _ := primitive.ObjectIDFromHex(frame.MessageId)
+
+	var message models.ChatMessage
+	if err := messageCollection.FindOne(s.ctx, bson.M{"_id": messageId, "deleted": bson.M{"$ne": true}}).Decode(&message); err != nil {
+		s.fail("Unable to find message")
+		return
+	}
+
+	// authors can delete their own messages, admins can delete anyone's
+	if message.Author.ID != s.user.ID {
+		_, community, err := findChannel(s.ctx, message.ChannelID)
+		if err != nil || !isAdmin(community, s.user.ID) {
+			s.fail("You can't delete this message")
+			return
+		}
+	}
+
+	if _, err := messageCollection.UpdateOne(s.ctx, bson.M{"_id": messageId}, bson.M{"$set": bson.M{"deleted": true, "body": ""}, "$unset": bson.M{"mentionRefs": ""}}); err != nil {
+		s.fail("Unable to delete message")
+		return
+	}
+
+	configs.UseBroker().Publish(s.ctx, channelTopic(message.ChannelID), EventMessageDeleted, map[string]interface{}{"messageId": messageId})
+}
+
+func (s *chatSession) typing(frame chatFrame) {
+	channelId, _ := primitive.ObjectIDFromHex(frame.ChannelId)
+	if _, ok := s.channels[channelId]; !ok {
+		return
+	}
+	if time.Since(s.typingAt[channelId]) < typingInterval {
+		return
+	}
+	s.typingAt[channelId] = time.Now()
+
+	configs.UseBroker().Publish(s.ctx, channelTopic(channelId), EventTyping, map[string]interface{}{"user": map[string]interface{}{"id": s.user.ID, "name": s.user.Name, "avatar": userImages(s.user).Avatar}})
+}
+
+func (s *chatSession) ping() {
+	ticker := time.NewTicker(socketPingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+			s.writeMu.Lock()
+			err := s.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(socketWriteWait))
+			s.writeMu.Unlock()
+			if err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (s *chatSession) write(v interface{}) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	s.conn.SetWriteDeadline(time.Now().Add(socketWriteWait))
+	s.conn.WriteJSON(v)
+}
+
+func (s *chatSession) fail(message string) {
+	s.write(map[string]interface{}{"type": "error", "message": message})
+}
+
+func canPost(channel models.Channel, community models.Community, userId primitive.ObjectID) bool {
+	if channel.AdminsOnly {
+		return isAdmin(community, userId)
+	}
+	return isMember(community, userId)
+}
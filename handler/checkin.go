@@ -0,0 +1,269 @@
+package handler
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-chi/jwtauth/v5"
+	"github.com/skip2/go-qrcode"
+	"github.com/zillalikestocode/community-api/configs"
+	"github.com/zillalikestocode/community-api/models"
+	"github.com/zillalikestocode/community-api/responses"
+	"github.com/zillalikestocode/community-api/ticket"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var checkInCollection *mongo.Collection = configs.GetCollection(configs.ConnectDB(), "checkins")
+
+// pixels per side of ticket QR codes
+const ticketQRSize = 512
+
+// the caller's check-in ticket for an event they RSVP'd to, as a QR code PNG or with
+// ?format=json as the token
+func (c *Community) Ticket(w http.ResponseWriter, r *http.Request) {
+	_, claims, _ := jwtauth.FromContext(r.Context())
+	var community models.Community
+	query := r.URL.Query()
+	userId, _ := primitive.ObjectIDFromHex(claims["id"].(string))
+	communityId, _ := primitive.ObjectIDFromHex(query.Get("communityId"))
+	eventId, _ := primitive.ObjectIDFromHex(query.Get("eventId"))
+
+	communityCollection.FindOne(context.TODO(), bson.M{"_id": communityId}).Decode(&community)
+	event, ok := findEvent(community, eventId)
+	if !ok || !isMember(community, userId) || !slices.Contains(event.Attendees, userId) {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusForbidden, Message: "RSVP to the event to get a ticket"})
+		return
+	}
+
+	expires := ticketExpiry(event)
+	if !time.Now().Before(expires) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "This event has ended"})
+		return
+	}
+
+	token := ticket.Sign(configs.CheckinSecret(), ticket.Ticket{EventID: event.ID, UserID: userId, Expires: expires})
+	if query.Get("format") == "json" {
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusOK, Message: "Ticket fetched successfully", Data: map[string]interface{}{"token": token, "eventId": eventId}})
+		return
+	}
+
+	png, err := qrcode.Encode(token, qrcode.Medium, ticketQRSize)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusInternalServerError, Message: "Unable to render ticket", Data: map[string]interface{}{"error": err.Error()}})
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "private, no-store")
+	w.WriteHeader(http.StatusOK)
+	w.Write(png)
+}
+
+// check a member in with the token from their ticket, admins only
+func (c *Community) CheckIn(w http.ResponseWriter, r *http.Request) {
+	_, claims, _ := jwtauth.FromContext(r.Context())
+	var body struct {
+		CommunityId string `json:"communityId"`
+		EventId     string `json:"eventId"`
+		Token       string `json:"token"`
+	}
+	var community models.Community
+	var user models.User
+	json.NewDecoder(r.Body).Decode(&body)
+	adminId, _ := primitive.ObjectIDFromHex(claims["id"].(string))
+	communityId, _ := primitive.ObjectIDFromHex(body.CommunityId)
+	eventId, _ := primitive.ObjectIDFromHex(body.EventId)
+
+	if err := communityCollection.FindOne(context.TODO(), bson.M{"_id": communityId}).Decode(&community); err != nil || !isAdmin(community, adminId) {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusForbidden, Message: "Only community admins can do this"})
+		return
+	}
+	event, ok := findEvent(community, eventId)
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "Unable to find event"})
+		return
+	}
+
+	checkInTicket, err := ticket.Verify(configs.CheckinSecret(), body.Token, event.ID, time.Now())
+	switch {
+	case errors.Is(err, ticket.ErrWrongEvent):
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "This ticket is for a different event", Data: map[string]interface{}{"ticketEventId": checkInTicket.EventID}})
+		return
+	case errors.Is(err, ticket.ErrExpired):
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "This ticket has expired", Data: map[string]interface{}{"expiredAt": checkInTicket.Expires}})
+		return
+	case err != nil:
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "This ticket is not valid"})
+		return
+	}
+	userId := checkInTicket.UserID
+	// tickets stop working when the member cancels their RSVP or leaves
+	if !isMember(community, userId) || !slices.Contains(event.Attendees, userId) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "This member is no longer attending the event"})
+		return
+	}
+
+	checkIn := models.CheckIn{
+		ID:          primitive.NewObjectID(),
+		CommunityID: community.ID,
+		EventID:     event.ID,
+		UserID:      userId,
+		CheckedInBy: adminId,
+		CheckedInAt: primitive.NewDateTimeFromTime(time.Now()),
+	}
+	userCollection.FindOne(context.TODO(), bson.M{"_id": userId}, options.FindOne().SetProjection(bson.M{"name": 1, "username": 1, "avatar": 1})).Decode(&user)
+	member := map[string]interface{}{"id": userId, "name": user.Name, "username": user.Username, "avatar": userImages(user).Avatar}
+
+	// the unique index on event and user rejects a second scan of the same ticket
+	if _, err := checkInCollection.InsertOne(context.TODO(), checkIn); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			var existing models.CheckIn
+			checkInCollection.FindOne(context.TODO(), bson.M{"eventId": event.ID, "userId": userId}).Decode(&existing)
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusConflict, Message: "This member has already checked in", Data: map[string]interface{}{"member": member, "checkIn": existing}})
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusInternalServerError, Message: "Unable to check in", Data: map[string]interface{}{"error": err.Error()}})
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusCreated, Message: "Checked in", Data: map[string]interface{}{"member": member, "checkIn": checkIn}})
+}
+
+// who RSVP'd to an event and whether they checked in, admins only. Pass ?format=csv to download it.
+func (c *Community) Attendance(w http.ResponseWriter, r *http.Request) {
+	_, claims, _ := jwtauth.FromContext(r.Context())
+	var community models.Community
+	var checkIns []models.CheckIn
+	var users []models.User
+	query := r.URL.Query()
+	userId, _ := primitive.ObjectIDFromHex(claims["id"].(string))
+	communityId, _ := primitive.ObjectIDFromHex(query.Get("communityId"))
+	eventId, _ := primitive.ObjectIDFromHex(query.Get("eventId"))
+
+	if err := communityCollection.FindOne(context.TODO(), bson.M{"_id": communityId}).Decode(&community); err != nil || !isAdmin(community, userId) {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusForbidden, Message: "Only community admins can do this"})
+		return
+	}
+	event, ok := findEvent(community, eventId)
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "Unable to find event"})
+		return
+	}
+
+	cursor, _ := checkInCollection.Find(context.TODO(), bson.M{"eventId": event.ID})
+	if err := cursor.All(context.TODO(), &checkIns); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "A server error has occured", Data: map[string]interface{}{"error": err.Error()}})
+		return
+	}
+
+	// members who checked in without an RSVP still on file, e.g. they cancelled afterwards, are listed too
+	userIds := slices.Clone(event.Attendees)
+	checkedIn := map[primitive.ObjectID]models.CheckIn{}
+	for _, checkIn := range checkIns {
+		checkedIn[checkIn.UserID] = checkIn
+		if !slices.Contains(userIds, checkIn.UserID) {
+			userIds = append(userIds, checkIn.UserID)
+		}
+	}
+
+	cursor, _ = userCollection.Find(context.TODO(), bson.M{"_id": bson.M{"$in": userIds}}, options.Find().SetProjection(bson.M{"name": 1, "username": 1, "avatar": 1}))
+	cursor.All(context.TODO(), &users)
+	names := map[primitive.ObjectID]models.User{}
+	for _, user := range users {
+		names[user.ID] = userImages(user)
+	}
+
+	type attendee struct {
+		ID          primitive.ObjectID  `json:"id"`
+		Name        string              `json:"name"`
+		Username    string              `json:"username,omitempty"`
+		Avatar      *models.Image       `json:"avatar,omitempty"`
+		RSVP        bool                `json:"rsvp"`
+		CheckedIn   bool                `json:"checkedIn"`
+		CheckedInAt *primitive.DateTime `json:"checkedInAt,omitempty"`
+	}
+	result := make([]attendee, 0, len(userIds))
+	for _, id := range userIds {
+		row := attendee{ID: id, Name: names[id].Name, Username: names[id].Username, Avatar: names[id].Avatar, RSVP: slices.Contains(event.Attendees, id)}
+		if checkIn, ok := checkedIn[id]; ok {
+			row.CheckedIn = true
+			row.CheckedInAt = &checkIn.CheckedInAt
+		}
+		result = append(result, row)
+	}
+	slices.SortFunc(result, func(a, b attendee) int { return strings.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name)) })
+
+	if query.Get("format") == "csv" {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="attendance-`+event.ID.Hex()+`.csv"`)
+		w.WriteHeader(http.StatusOK)
+		writer := csv.NewWriter(w)
+		writer.Write([]string{"id", "name", "username", "rsvp", "checked_in", "checked_in_at"})
+		for _, row := range result {
+			checkedInAt := ""
+			if row.CheckedInAt != nil {
+				checkedInAt = row.CheckedInAt.Time().UTC().Format(time.RFC3339)
+			}
+			writer.Write([]string{row.ID.Hex(), csvSafe(row.Name), row.Username, boolString(row.RSVP), boolString(row.CheckedIn), checkedInAt})
+		}
+		writer.Flush()
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusOK, Message: "Attendance fetched successfully", Data: map[string]interface{}{"result": result, "rsvps": len(event.Attendees), "checkedIn": len(checkIns)}})
+}
+
+func findEvent(community models.Community, eventId primitive.ObjectID) (models.Event, bool) {
+	for _, event := range community.Events {
+		if event.ID == eventId {
+			return event, true
+		}
+	}
+	return models.Event{}, false
+}
+
+// tickets expire when the event ends and only work for members still attending it
+func ticketExpiry(event models.Event) time.Time {
+	return event.Date.Time().Add(configs.CheckinWindow())
+}
+
+func boolString(value bool) string {
+	if value {
+		return "yes"
+	}
+	return "no"
+}
+
+// stop spreadsheet apps from treating a user supplied value as a formula
+func csvSafe(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
@@ -0,0 +1,526 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/go-chi/jwtauth/v5"
+	"github.com/zillalikestocode/community-api/configs"
+	"github.com/zillalikestocode/community-api/content"
+	"github.com/zillalikestocode/community-api/models"
+	"github.com/zillalikestocode/community-api/responses"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type Comment struct {
+}
+
+var commentCollection *mongo.Collection = configs.GetCollection(configs.ConnectDB(), "comments")
+var reactionCollection *mongo.Collection = configs.GetCollection(configs.ConnectDB(), "reactions")
+
+const (
+	maxCommentLength = 2000
+	maxEmojiLength   = 8
+)
+
+// comment on an announcement or event, pass parentId to reply to another comment
+func (c *Comment) Create(w http.ResponseWriter, r *http.Request) {
+	_, claims, _ := jwtauth.FromContext(r.Context())
+	var body struct {
+		CommunityId string `json:"communityId"`
+		TargetType  string `json:"targetType"`
+		TargetId    string `json:"targetId"`
+		ParentId    string `json:"parentId"`
+		Body        string `json:"body"`
+	}
+	var user models.User
+	userId, _ := primitive.ObjectIDFromHex(claims["id"].(string))
+
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "Please pass the required details", Data: map[string]interface{}{"error": err.Error()}})
+		return
+	}
+	body.Body = strings.TrimSpace(body.Body)
+	if body.Body == "" || utf8.RuneCountInString(body.Body) > maxCommentLength {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "Comments must be between 1 and " + strconv.Itoa(maxCommentLength) + " characters"})
+		return
+	}
+
+	communityId, _ := primitive.ObjectIDFromHex(body.CommunityId)
+	targetId, _ := primitive.ObjectIDFromHex(body.TargetId)
+	if body.TargetType == models.TargetComment {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "Reply to a comment with parentId"})
+		return
+	}
+	community, ok := findTarget(w, communityId, body.TargetType, targetId, userId)
+	if !ok {
+		return
+	}
+
+	rendered := content.Render(body.Body)
+	mentions, ok := mentionsFor(w, community, userId, rendered.Mentions)
+	if !ok {
+		return
+	}
+
+	comment := models.Comment{
+		ID:          primitive.NewObjectID(),
+		CommunityID: community.ID,
+		TargetType:  body.TargetType,
+		TargetID:    targetId,
+		Body:        rendered.Source,
+		BodyHTML:    rendered.HTML,
+		Mentions:    mentions,
+		CreatedAt:   primitive.NewDateTimeFromTime(time.Now()),
+	}
+
+	if body.ParentId != "" {
+		var parent models.Comment
+		parentId, _ := primitive.ObjectIDFromHex(body.ParentId)
+		if err := commentCollection.FindOne(context.TODO(), bson.M{"_id": parentId, "targetId": targetId, "deleted": bson.M{"$ne": true}}).Decode(&parent); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "Unable to find the comment you are replying to"})
+			return
+		}
+		comment.ParentID = &parent.ID
+	}
+
+	userCollection.FindOne(context.TODO(), bson.M{"_id": userId}).Decode(&user)
+	comment.Author.ID = userId
+	comment.Author.Name = user.Name
+	comment.Author.Avatar = userImages(user).Avatar
+
+	if _, err := commentCollection.InsertOne(context.TODO(), comment); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusInternalServerError, Message: "Unable to save comment", Data: map[string]interface{}{"error": err.Error()}})
+		return
+	}
+	bumpCommentCount(context.TODO(), comment, 1)
+
+	emit(context.TODO(), community.ID, userId, EventCommentCreated, map[string]interface{}{"comment": comment})
+	go notifyMentions(context.Background(), community, userId, user.Name, comment.Mentions, comment.Body, map[string]interface{}{"commentId": comment.ID, "targetType": comment.TargetType, "targetId": comment.TargetID})
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusCreated, Message: "Comment added", Data: map[string]interface{}{"comment": comment}})
+}
+
+// page through the comments on an announcement or event, oldest first. Pass parentId for the
+// replies to a comment and the last id as ?after= for the next page.
+func (c *Comment) List(w http.ResponseWriter, r *http.Request) {
+	_, claims, _ := jwtauth.FromContext(r.Context())
+	var result []models.Comment
+	query := r.URL.Query()
+	userId, _ := primitive.ObjectIDFromHex(claims["id"].(string))
+	communityId, _ := primitive.ObjectIDFromHex(query.Get("communityId"))
+	targetId, _ := primitive.ObjectIDFromHex(query.Get("targetId"))
+
+	community, ok := findTarget(w, communityId, query.Get("targetType"), targetId, userId)
+	if !ok {
+		return
+	}
+
+	limit := historyPageSize
+	if value, err := strconv.Atoi(query.Get("limit")); err == nil && value > 0 && value <= historyMaxPageSize {
+		limit = value
+	}
+
+	filter := bson.M{"targetId": targetId, "parentId": bson.M{"$exists": false}}
+	if parentId, err := primitive.ObjectIDFromHex(query.Get("parentId")); err == nil {
+		filter["parentId"] = parentId
+	}
+	if after, err := primitive.ObjectIDFromHex(query.Get("after")); err == nil {
+		filter["_id"] = bson.M{"$gt": after}
+	}
+
+	cursor, _ := commentCollection.Find(context.TODO(), filter, options.Find().SetSort(bson.M{"_id": 1}).SetLimit(int64(limit)))
+	if err := cursor.All(context.TODO(), &result); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "A server error has occured", Data: map[string]interface{}{"error": err.Error()}})
+		return
+	}
+
+	moderator := isAdmin(community, userId)
+	authors := make([]*models.Author, 0, len(result))
+	for i := range result {
+		result[i] = redactComment(result[i], userId, moderator)
+		authors = append(authors, &result[i].Author)
+	}
+	withAvatars(context.TODO(), authors...)
+
+	var next interface{}
+	if len(result) == limit {
+		next = result[len(result)-1].ID
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusOK, Message: "Comments fetched successfully", Data: map[string]interface{}{"result": result, "after": next}})
+}
+
+// edit your own comment
+func (c *Comment) Update(w http.ResponseWriter, r *http.Request) {
+	_, claims, _ := jwtauth.FromContext(r.Context())
+	var body struct {
+		CommentId string `json:"commentId"`
+		Body      string `json:"body"`
+	}
+	var comment models.Comment
+	var community models.Community
+	json.NewDecoder(r.Body).Decode(&body)
+	userId, _ := primitive.ObjectIDFromHex(claims["id"].(string))
+	commentId, _ := primitive.ObjectIDFromHex(body.CommentId)
+
+	body.Body = strings.TrimSpace(body.Body)
+	if body.Body == "" || utf8.RuneCountInString(body.Body) > maxCommentLength {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "Comments must be between 1 and " + strconv.Itoa(maxCommentLength) + " characters"})
+		return
+	}
+
+	filter := bson.M{"_id": commentId, "author.id": userId, "deleted": bson.M{"$ne": true}}
+	if err := commentCollection.FindOne(context.TODO(), filter).Decode(&comment); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "Unable to find your comment"})
+		return
+	}
+	communityCollection.FindOne(context.TODO(), bson.M{"_id": comment.CommunityID}).Decode(&community)
+
+	rendered := content.Render(body.Body)
+	mentions, ok := mentionsFor(w, community, userId, rendered.Mentions)
+	if !ok {
+		return
+	}
+	previousMentions := comment.Mentions
+
+	now := primitive.NewDateTimeFromTime(time.Now())
+	err := commentCollection.FindOneAndUpdate(context.TODO(), filter, bson.M{"$set": bson.M{"body": rendered.Source, "bodyHtml": rendered.HTML, "mentionRefs": mentions, "editedAt": now}}, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&comment)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "Unable to find your comment"})
+		return
+	}
+
+	emit(context.TODO(), comment.CommunityID, userId, EventCommentUpdated, map[string]interface{}{"comment": redactComment(comment, primitive.NilObjectID, false)})
+	go notifyMentions(context.Background(), community, userId, comment.Author.Name, addedMentions(previousMentions, comment.Mentions), comment.Body, map[string]interface{}{"commentId": comment.ID, "targetType": comment.TargetType, "targetId": comment.TargetID})
+
+	withAvatars(context.TODO(), &comment.Author)
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusOK, Message: "Comment updated", Data: map[string]interface{}{"comment": comment}})
+}
+
+// delete your own comment, replies stay in place under a "deleted" placeholder
+func (c *Comment) Delete(w http.ResponseWriter, r *http.Request) {
+	_, claims, _ := jwtauth.FromContext(r.Context())
+	var body struct {
+		CommentId string `json:"commentId"`
+	}
+	var comment models.Comment
+	json.NewDecoder(r.Body).Decode(&body)
+	userId, _ := primitive.ObjectIDFromHex(claims["id"].(string))
+	commentId, _ := primitive.ObjectIDFromHex(body.CommentId)
+
+	filter := bson.M{"_id": commentId, "author.id": userId, "deleted": bson.M{"$ne": true}}
+	err := commentCollection.FindOneAndUpdate(context.TODO(), filter, bson.M{"$set": bson.M{"deleted": true, "body": "", "bodyHtml": ""}, "$unset": bson.M{"mentionRefs": ""}}).Decode(&comment)
+	if err == nil {
+		bumpCommentCount(context.TODO(), comment, -1)
+		emit(context.TODO(), comment.CommunityID, userId, EventCommentDeleted, map[string]interface{}{"commentId": comment.ID, "targetId": comment.TargetID})
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusOK, Message: "Comment deleted"})
+}
+
+// hide or unhide a comment, community admins only
+func (c *Comment) Hide(w http.ResponseWriter, r *http.Request) {
+	_, claims, _ := jwtauth.FromContext(r.Context())
+	var body struct {
+		CommentId string `json:"commentId"`
+		Hidden    bool   `json:"hidden"`
+	}
+	var comment models.Comment
+	json.NewDecoder(r.Body).Decode(&body)
+	userId, _ := primitive.ObjectIDFromHex(claims["id"].(string))
+	commentId, _ := primitive.ObjectIDFromHex(body.CommentId)
+
+	if err := commentCollection.FindOne(context.TODO(), bson.M{"_id": commentId}).Decode(&comment); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "Unable to find comment", Data: map[string]interface{}{"error": err.Error()}})
+		return
+	}
+	if !requireCommunityAdmin(w, comment.CommunityID, userId) {
+		return
+	}
+
+	update := bson.M{"$set": bson.M{"hidden": true, "hiddenBy": userId}}
+	action := models.AuditHide
+	if !body.Hidden {
+		update = bson.M{"$unset": bson.M{"hidden": "", "hiddenBy": ""}}
+		action = models.AuditUnhide
+	}
+	commentCollection.UpdateOne(context.TODO(), bson.M{"_id": comment.ID}, update)
+	audit(context.TODO(), comment.CommunityID, userId, action, models.AuditComment, comment.ID, comment, bson.M{"hidden": body.Hidden})
+
+	emit(context.TODO(), comment.CommunityID, userId, EventCommentModerated, map[string]interface{}{"commentId": comment.ID, "targetId": comment.TargetID, "hidden": body.Hidden})
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusOK, Message: "Comment updated", Data: map[string]interface{}{"hidden": body.Hidden}})
+}
+
+// react to an announcement, event or comment with an emoji
+func (c *Comment) React(w http.ResponseWriter, r *http.Request) {
+	_, claims, _ := jwtauth.FromContext(r.Context())
+	var body struct {
+		CommunityId string `json:"communityId"`
+		TargetType  string `json:"targetType"`
+		TargetId    string `json:"targetId"`
+		Emoji       string `json:"emoji"`
+	}
+	json.NewDecoder(r.Body).Decode(&body)
+	userId, _ := primitive.ObjectIDFromHex(claims["id"].(string))
+	communityId, _ := primitive.ObjectIDFromHex(body.CommunityId)
+	targetId, _ := primitive.ObjectIDFromHex(body.TargetId)
+
+	if !validEmoji(body.Emoji) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "Please pass a single emoji"})
+		return
+	}
+	community, ok := findTarget(w, communityId, body.TargetType, targetId, userId)
+	if !ok {
+		return
+	}
+
+	reaction := models.Reaction{
+		ID:          primitive.NewObjectID(),
+		CommunityID: community.ID,
+		TargetType:  body.TargetType,
+		TargetID:    targetId,
+		UserID:      userId,
+		Emoji:       body.Emoji,
+		CreatedAt:   primitive.NewDateTimeFromTime(time.Now()),
+	}
+	// the unique index on targetId, userId and emoji makes repeated reactions a no-op
+	_, err := reactionCollection.InsertOne(context.TODO(), reaction)
+	if err != nil && !mongo.IsDuplicateKeyError(err) {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusInternalServerError, Message: "Unable to save reaction", Data: map[string]interface{}{"error": err.Error()}})
+		return
+	}
+	if err == nil {
+		bumpReaction(context.TODO(), community.ID, body.TargetType, targetId, body.Emoji, 1)
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusOK, Message: "Reaction added"})
+}
+
+// remove your reaction
+func (c *Comment) Unreact(w http.ResponseWriter, r *http.Request) {
+	_, claims, _ := jwtauth.FromContext(r.Context())
+	var body struct {
+		TargetId string `json:"targetId"`
+		Emoji    string `json:"emoji"`
+	}
+	var reaction models.Reaction
+	json.NewDecoder(r.Body).Decode(&body)
+	userId, _ := primitive.ObjectIDFromHex(claims["id"].(string))
+	targetId, _ := primitive.ObjectIDFromHex(body.TargetId)
+
+	err := reactionCollection.FindOneAndDelete(context.TODO(), bson.M{"targetId": targetId, "userId": userId, "emoji": body.Emoji}).Decode(&reaction)
+	if err == nil {
+		bumpReaction(context.TODO(), reaction.CommunityID, reaction.TargetType, reaction.TargetID, reaction.Emoji, -1)
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusOK, Message: "Reaction removed"})
+}
+
+// the emojis the user reacted with on each of the given targets, e.g. ?targetIds=a,b
+func (c *Comment) MyReactions(w http.ResponseWriter, r *http.Request) {
+	_, claims, _ := jwtauth.FromContext(r.Context())
+	var reactions []models.Reaction
+	userId, _ := primitive.ObjectIDFromHex(claims["id"].(string))
+
+	targetIds := []primitive.ObjectID{}
+	for _, id := range strings.Split(r.URL.Query().Get("targetIds"), ",") {
+		if targetId, err := primitive.ObjectIDFromHex(strings.TrimSpace(id)); err == nil && len(targetIds) < historyMaxPageSize {
+			targetIds = append(targetIds, targetId)
+		}
+	}
+
+	cursor, _ := reactionCollection.Find(context.TODO(), bson.M{"userId": userId, "targetId": bson.M{"$in": targetIds}})
+	if err := cursor.All(context.TODO(), &reactions); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "A server error has occured", Data: map[string]interface{}{"error": err.Error()}})
+		return
+	}
+
+	result := map[string][]string{}
+	for _, reaction := range reactions {
+		result[reaction.TargetID.Hex()] = append(result[reaction.TargetID.Hex()], reaction.Emoji)
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusOK, Message: "Reactions fetched successfully", Data: map[string]interface{}{"result": result}})
+}
+
+// check the target exists and the user is a member who can see it, writes the response when not
+func findTarget(w http.ResponseWriter, communityId primitive.ObjectID, targetType string, targetId primitive.ObjectID, userId primitive.ObjectID) (models.Community, bool) {
+	var community models.Community
+
+	if targetType == models.TargetComment {
+		var comment models.Comment
+		if err := commentCollection.FindOne(context.TODO(), bson.M{"_id": targetId, "deleted": bson.M{"$ne": true}}).Decode(&comment); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "Unable to find comment"})
+			return community, false
+		}
+		communityId = comment.CommunityID
+	}
+
+	if err := communityCollection.FindOne(context.TODO(), bson.M{"_id": communityId}).Decode(&community); err != nil || !isMember(community, userId) {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusForbidden, Message: "You are not a member of this community"})
+		return community, false
+	}
+
+	found := false
+	switch targetType {
+	case models.TargetAnnouncement:
+		found = slices.ContainsFunc(visibleAnnouncements(community, userId), func(a models.Announcement) bool { return a.ID == targetId })
+	case models.TargetEvent:
+		found = slices.ContainsFunc(community.Events, func(e models.Event) bool { return e.ID == targetId })
+	case models.TargetComment:
+		found = true
+	}
+	if !found {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "Unable to find the " + targetType + " you are commenting on", Data: map[string]interface{}{"targetTypes": []string{models.TargetAnnouncement, models.TargetEvent, models.TargetComment}}})
+		return community, false
+	}
+	return community, true
+}
+
+// blank out the body of deleted comments, and of hidden ones for everyone but moderators and the author
+func redactComment(comment models.Comment, userId primitive.ObjectID, moderator bool) models.Comment {
+	if comment.Deleted || (comment.Hidden && !moderator && comment.Author.ID != userId) {
+		comment.Body = ""
+		comment.BodyHTML = ""
+		comment.Mentions = nil
+	}
+	if !moderator {
+		comment.HiddenBy = nil
+	}
+	return comment
+}
+
+// keep the comment count on the announcement or event, and the reply count on the parent, in step
+func bumpCommentCount(ctx context.Context, comment models.Comment, delta int) {
+	if comment.ParentID != nil {
+		commentCollection.UpdateOne(ctx, bson.M{"_id": *comment.ParentID}, bson.M{"$inc": bson.M{"replyCount": delta}})
+	}
+
+	field := embeddedField(comment.TargetType)
+	if field == "" {
+		return
+	}
+	filters := options.ArrayFilters{Filters: []interface{}{bson.M{"t.id": comment.TargetID}}}
+	communityCollection.UpdateOne(ctx, bson.M{"_id": comment.CommunityID}, bson.M{"$inc": bson.M{field + ".$[t].commentCount": delta}}, options.Update().SetArrayFilters(filters))
+}
+
+// adjust the reaction count for an emoji on the target, dropping it once it reaches zero
+func bumpReaction(ctx context.Context, communityId primitive.ObjectID, targetType string, targetId primitive.ObjectID, emoji string, delta int) {
+	if targetType == models.TargetComment {
+		commentCollection.UpdateOne(ctx, bson.M{"_id": targetId}, bson.M{"$inc": bson.M{"reactions." + emoji: delta}})
+		commentCollection.UpdateOne(ctx, bson.M{"_id": targetId, "reactions." + emoji: bson.M{"$lte": 0}}, bson.M{"$unset": bson.M{"reactions." + emoji: ""}})
+		return
+	}
+
+	field := embeddedField(targetType)
+	if field == "" {
+		return
+	}
+	filters := options.ArrayFilters{Filters: []interface{}{bson.M{"t.id": targetId}}}
+	communityCollection.UpdateOne(ctx, bson.M{"_id": communityId}, bson.M{"$inc": bson.M{field + ".$[t].reactions." + emoji: delta}}, options.Update().SetArrayFilters(filters))
+
+	filters = options.ArrayFilters{Filters: []interface{}{bson.M{"t.id": targetId, "t.reactions." + emoji: bson.M{"$lte": 0}}}}
+	communityCollection.UpdateOne(ctx, bson.M{"_id": communityId}, bson.M{"$unset": bson.M{field + ".$[t].reactions." + emoji: ""}}, options.Update().SetArrayFilters(filters))
+}
+
+// the community array announcements and events are embedded in
+func embeddedField(targetType string) string {
+	switch targetType {
+	case models.TargetAnnouncement:
+		return "announcements"
+	case models.TargetEvent:
+		return "events"
+	}
+	return ""
+}
+
+// the characters that combine symbols into a single emoji: the zero width joiner, the
+// emoji variation selector, skin tones and the tags used in subdivision flags. Keycaps
+// start with a digit, "#" or "*" rather than a symbol so they aren't accepted.
+var emojiModifiers = &unicode.RangeTable{
+	R16: []unicode.Range16{
+		{Lo: 0x200d, Hi: 0x200d, Stride: 1},
+		{Lo: 0xfe0f, Hi: 0xfe0f, Stride: 1},
+	},
+	R32: []unicode.Range32{
+		{Lo: 0x1f3fb, Hi: 0x1f3ff, Stride: 1},
+		{Lo: 0xe0020, Hi: 0xe007f, Stride: 1},
+	},
+}
+
+// a short sequence starting with a symbol and made only of symbols and emoji modifiers,
+// which also keeps "." and "$" out of the counter field names
+func validEmoji(emoji string) bool {
+	if emoji == "" || utf8.RuneCountInString(emoji) > maxEmojiLength {
+		return false
+	}
+	for i, r := range emoji {
+		if unicode.In(r, unicode.So) {
+			continue
+		}
+		if i == 0 || !unicode.In(r, emojiModifiers) {
+			return false
+		}
+	}
+	return true
+}
+
+// remove the comments and reactions on a deleted announcement or event
+func purgeDiscussion(ctx context.Context, targetId primitive.ObjectID) error {
+	var comments []struct {
+		ID primitive.ObjectID `bson:"_id"`
+	}
+	cursor, err := commentCollection.Find(ctx, bson.M{"targetId": targetId}, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return err
+	}
+	if err := cursor.All(ctx, &comments); err != nil {
+		return err
+	}
+
+	targets := []primitive.ObjectID{targetId}
+	for _, comment := range comments {
+		targets = append(targets, comment.ID)
+	}
+	if _, err := reactionCollection.DeleteMany(ctx, bson.M{"targetId": bson.M{"$in": targets}}); err != nil {
+		return err
+	}
+	_, err = commentCollection.DeleteMany(ctx, bson.M{"targetId": targetId})
+	return err
+}
@@ -1,299 +1,963 @@
-package handler
-
-import (
-	"context"
-	"encoding/json"
-	"net/http"
-	"slices"
-	"time"
-
-	"github.com/go-chi/jwtauth/v5"
-	"github.com/zillalikestocode/community-api/configs"
-	"github.com/zillalikestocode/community-api/models"
-	"github.com/zillalikestocode/community-api/responses"
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
-)
-
-type Community struct {
-}
-
-var communityCollection *mongo.Collection = configs.GetCollection(configs.ConnectDB(), "communities")
-
-// get user communities
-func (c *Community) GetAll(w http.ResponseWriter, r *http.Request) {
-	_, claims, _ := jwtauth.FromContext(r.Context())
-	var result []bson.M
-
-	userId, _ := primitive.ObjectIDFromHex(claims["id"].(string))
-
-	cursor, _ := communityCollection.Find(context.TODO(), bson.M{"members": bson.M{"$elemMatch": bson.M{"id": userId}}})
-
-	if err := cursor.All(context.TODO(), &result); err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "A server error has occured", Data: map[string]interface{}{"error": err.Error()}})
-		return
-	}
-
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusOK, Message: "Communities fetched successfully", Data: map[string]interface{}{"result": result}})
-}
-
-// create community
-func (c *Community) Create(w http.ResponseWriter, r *http.Request) {
-	var body models.Community
-	_, claims, _ := jwtauth.FromContext(r.Context())
-	userId, _ := primitive.ObjectIDFromHex(claims["id"].(string))
-
-	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "Please pass the required details", Data: map[string]interface{}{"error": err.Error()}})
-		return
-	}
-
-	newCommunity := models.Community{
-		ID:          primitive.NewObjectID(),
-		Name:        body.Name,
-		Description: body.Description,
-		Owner:       userId,
-		Members:     []models.Member{{ID: userId, Admin: true}},
-	}
-	result, err := communityCollection.InsertOne(context.TODO(), newCommunity)
-	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "An error occured while creating the community", Data: map[string]interface{}{"error": err.Error()}})
-		return
-	}
-
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusCreated, Message: "Community created", Data: map[string]interface{}{"community": result}})
-}
-
-// join community
-func (c *Community) Join(w http.ResponseWriter, r *http.Request) {
-	var body struct {
-		CommunityId string `json:"communityId"`
-	}
-	var community models.Community
-	_, claims, _ := jwtauth.FromContext(r.Context())
-	userId, _ := primitive.ObjectIDFromHex(claims["id"].(string))
-
-	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "Please pass the required details", Data: map[string]interface{}{"error": err.Error()}})
-		return
-	}
-	communityId, _ := primitive.ObjectIDFromHex(body.CommunityId)
-	if err := communityCollection.FindOne(context.TODO(), bson.M{"_id": communityId}).Decode(&community); err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "Unable to find community", Data: map[string]interface{}{"error": err.Error(), "id": communityId}})
-		return
-	}
-	communityMembers := community.Members
-	if slices.Contains(communityMembers, models.Member{ID: userId, Admin: false}) || slices.Contains(communityMembers, models.Member{ID: userId, Admin: true}) {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "User already in the community"})
-		return
-	} else {
-		result, err := communityCollection.UpdateOne(context.TODO(), bson.M{"_id": communityId}, bson.M{"$push": bson.M{"members": userId}})
-
-		if err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "Couldn't join community", Data: map[string]interface{}{"error": err.Error()}})
-			return
-		}
-
-		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusOK, Message: "Successfully joined community", Data: map[string]interface{}{"result": result}})
-
-	}
-}
-
-// leave a community
-func (c *Community) Leave(w http.ResponseWriter, r *http.Request) {
-	_, claims, _ := jwtauth.FromContext(r.Context())
-	var body struct {
-		CommunityId string `json:"communityId"`
-	}
-	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadGateway, Message: "Please pass in the required body parameters", Data: map[string]interface{}{"error": err.Error()}})
-		return
-	}
-	userId, _ := primitive.ObjectIDFromHex(claims["id"].(string))
-	communityId, _ := primitive.ObjectIDFromHex(body.CommunityId)
-	result, err := communityCollection.UpdateOne(context.TODO(), bson.M{"_id": communityId}, bson.M{"$pull": bson.M{"members": bson.M{"id": userId}}})
-
-	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadGateway, Message: "An error occured while leaving the community", Data: map[string]interface{}{"error": err.Error()}})
-		return
-	} else {
-		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusOK, Message: "Successfully left the community", Data: map[string]interface{}{"result": result}})
-
-	}
-}
-
-// search community
-func (c *Community) SearchCommunity(w http.ResponseWriter, r *http.Request) {
-	query := r.URL.Query().Get("query")
-
-	var result []bson.M
-
-	cursor, _ := communityCollection.Find(context.TODO(), bson.M{"name": bson.M{"$regex": query}})
-
-	if err := cursor.All(context.TODO(), &result); err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "A server error has occured"})
-		return
-	}
-
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusOK, Message: "Communities found", Data: map[string]interface{}{"result": result}})
-
-}
-
-// ANNOUNCEMENT SECTION
-
-// create announcement
-func (c *Community) CreateAnnouncement(w http.ResponseWriter, r *http.Request) {
-	_, claims, _ := jwtauth.FromContext(r.Context())
-	var body struct {
-		Name        string `json:"name"`
-		Date        string `json:"date"`
-		Message     string `json:"message"`
-		CommunityId string `json:"communityId"`
-	}
-	json.NewDecoder(r.Body).Decode(&body)
-
-	parsedDate, _ := time.Parse(time.RFC3339, body.Date)
-	date := primitive.NewDateTimeFromTime(parsedDate)
-
-	userId, _ := primitive.ObjectIDFromHex(claims["id"].(string))
-	communityId, _ := primitive.ObjectIDFromHex(body.CommunityId)
-
-	newAnnouncement := bson.M{"announcements": bson.M{"date": date, "message": body.Message, "id": primitive.NewObjectID(), "creator": bson.M{"name": body.Name, "id": userId}}}
-
-	result, err := communityCollection.UpdateOne(context.TODO(), bson.M{"_id": communityId}, bson.M{"$push": newAnnouncement})
-
-	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadGateway, Message: "An error occured while creating an announcement", Data: map[string]interface{}{"error": err.Error()}})
-		return
-	} else {
-		w.WriteHeader(http.StatusCreated)
-		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusCreated, Message: "Announcement created successfully", Data: map[string]interface{}{"result": result}})
-	}
-
-}
-
-// delete announcement
-func (c *Community) DeleteAnnouncement(w http.ResponseWriter, r *http.Request) {
-	_, claims, _ := jwtauth.FromContext(r.Context())
-	var body struct {
-		AnnouncementId string `json:"announcementId"`
-		CommunityId    string `json:"communityId"`
-	}
-	json.NewDecoder(r.Body).Decode(&body)
-
-	userId, _ := primitive.ObjectIDFromHex(claims["id"].(string))
-	communityId, _ := primitive.ObjectIDFromHex(body.CommunityId)
-	announcementId, _ := primitive.ObjectIDFromHex(body.AnnouncementId)
-
-	communityCollection.UpdateOne(context.TODO(), bson.M{"_id": communityId}, bson.M{"$pull": bson.M{"announcements": bson.M{"id": announcementId, "creator.id": userId}}})
-
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusOK, Message: "Announcement deleted"})
-}
-
-// EVENTS SECTIONS
-
-// create event
-func (c *Community) CreateEvent(w http.ResponseWriter, r *http.Request) {
-	// _, claims, _ := jwtauth.FromContext(r.Context())
-	var body struct {
-		Name        string `json:"name"`
-		Description string `json:"description"`
-		Date        string `json:"date"`
-		Time        string `json:"time"`
-		CommunityId string `json:"communityId"`
-		Address     string `json:"address"`
-	}
-	json.NewDecoder(r.Body).Decode(&body)
-
-	// userId, _ := primitive.ObjectIDFromHex(claims["id"].(string))
-	communityId, _ := primitive.ObjectIDFromHex(body.CommunityId)
-	parsedDate, _ := time.Parse(time.RFC3339, body.Date)
-	date := primitive.NewDateTimeFromTime(parsedDate)
-
-	newEvent := bson.M{
-		"name":        body.Name,
-		"id":          primitive.NewObjectID(),
-		"description": body.Description,
-		"date":        date,
-		"time":        body.Time,
-		"address":     body.Address,
-	}
-
-	result, err := communityCollection.UpdateOne(context.TODO(), bson.M{"_id": communityId}, bson.M{"$push": bson.M{"events": newEvent}})
-	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadGateway, Message: "An error occured while adding the event", Data: map[string]interface{}{"error": err.Error()}})
-		return
-	} else {
-		w.WriteHeader(http.StatusCreated)
-		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusCreated, Message: "Event added successfully", Data: map[string]interface{}{"result": result}})
-	}
-
-}
-
-// delete event
-func (c *Community) DeleteEvent(w http.ResponseWriter, r *http.Request) {
-	_, claims, _ := jwtauth.FromContext(r.Context())
-	var body struct {
-		EventId     string `json:"eventId"`
-		CommunityId string `json:"communityId"`
-	}
-	json.NewDecoder(r.Body).Decode(&body)
-
-	userId, _ := primitive.ObjectIDFromHex(claims["id"].(string))
-	communityId, _ := primitive.ObjectIDFromHex(body.CommunityId)
-	eventId, _ := primitive.ObjectIDFromHex(body.EventId)
-
-	communityCollection.UpdateOne(context.TODO(), bson.M{"_id": communityId, "owner": userId}, bson.M{"$pull": bson.M{"events": bson.M{"id": eventId}}})
-
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusOK, Message: "Event deleted"})
-}
-
-// update event
-func (c *Community) UpdateEvent(w http.ResponseWriter, r *http.Request) {
-	var body struct {
-		Name        string `json:"name"`
-		Description string `json:"description"`
-		Date        string `json:"date"`
-		Time        string `json:"time"`
-		CommunityId string `json:"communityId"`
-		EventId     string `json:"eventId"`
-	}
-	json.NewDecoder(r.Body).Decode(&body)
-
-	// userId, _ := primitive.ObjectIDFromHex(claims["id"].(string))
-	communityId, _ := primitive.ObjectIDFromHex(body.CommunityId)
-	eventId, _ := primitive.ObjectIDFromHex(body.EventId)
-	parsedDate, _ := time.Parse(time.RFC3339, body.Date)
-	date := primitive.NewDateTimeFromTime(parsedDate)
-
-	result, err := communityCollection.UpdateOne(context.TODO(), bson.M{"_id": communityId, "events.id": eventId}, bson.M{"$set": bson.M{"events.$.name": body.Name, "events.$.description": body.Description, "events.$.date": date, "events.$.time": body.Time}})
-	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadGateway, Message: "An error occured while updating the event", Data: map[string]interface{}{"error": err.Error()}})
-		return
-	} else {
-		w.WriteHeader(http.StatusCreated)
-		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusCreated, Message: "Event updated successfully", Data: map[string]interface{}{"result": result}})
-	}
-
-}
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/jwtauth/v5"
+	"github.com/zillalikestocode/community-api/configs"
+	"github.com/zillalikestocode/community-api/content"
+	"github.com/zillalikestocode/community-api/models"
+	"github.com/zillalikestocode/community-api/responses"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type Community struct {
+}
+
+var communityCollection *mongo.Collection = configs.GetCollection(configs.ConnectDB(), "communities")
+
+// get user communities
+func (c *Community) GetAll(w http.ResponseWriter, r *http.Request) {
+	_, claims, _ := jwtauth.FromContext(r.Context())
+	var result []models.Community
+
+	userId, _ := primitive.ObjectIDFromHex(claims["id"].(string))
+
+	cursor, _ := communityCollection.Find(context.TODO(), bson.M{"members": bson.M{"$elemMatch": bson.M{"id": userId}}})
+
+	if err := cursor.All(context.TODO(), &result); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "A server error has occured", Data: map[string]interface{}{"error": err.Error()}})
+		return
+	}
+	for i := range result {
+		result[i] = communityImages(renderLegacyContent(result[i]))
+		result[i].Announcements = visibleAnnouncements(result[i], userId)
+	}
+	withCreatorAvatars(context.TODO(), result)
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusOK, Message: "Communities fetched successfully", Data: map[string]interface{}{"result": result}})
+}
+
+// create community
+func (c *Community) Create(w http.ResponseWriter, r *http.Request) {
+	var body models.Community
+	_, claims, _ := jwtauth.FromContext(r.Context())
+	userId, _ := primitive.ObjectIDFromHex(claims["id"].(string))
+
+	if !requireVerified(w, userId) {
+		return
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "Please pass the required details", Data: map[string]interface{}{"error": err.Error()}})
+		return
+	}
+
+	tags, ok := normalizeTags(w, body.Category, body.Tags)
+	if !ok {
+		return
+	}
+
+	joinedAt := primitive.NewDateTimeFromTime(time.Now())
+	newCommunity := models.Community{
+		ID:              primitive.NewObjectID(),
+		Name:            body.Name,
+		Description:     body.Description,
+		DescriptionHTML: content.Render(body.Description).HTML,
+		Category:        body.Category,
+		Tags:            tags,
+		Owner:           userId,
+		Members:         []models.Member{{ID: userId, Admin: true, JoinedAt: &joinedAt}},
+	}
+	result, err := communityCollection.InsertOne(context.TODO(), newCommunity)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "An error occured while creating the community", Data: map[string]interface{}{"error": err.Error()}})
+		return
+	}
+
+	recordMembership(context.TODO(), newCommunity.ID, userId, models.MembershipJoined)
+	audit(context.TODO(), newCommunity.ID, userId, models.AuditCreate, models.AuditCommunity, newCommunity.ID, nil, bson.M{"name": newCommunity.Name, "description": newCommunity.Description, "category": newCommunity.Category, "tags": newCommunity.Tags})
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusCreated, Message: "Community created", Data: map[string]interface{}{"community": result}})
+}
+
+// change a community's name, description, category or tags, admins only. Fields left out are kept.
+func (c *Community) Update(w http.ResponseWriter, r *http.Request) {
+	_, claims, _ := jwtauth.FromContext(r.Context())
+	var body struct {
+		CommunityId string    `json:"communityId"`
+		Name        *string   `json:"name"`
+		Description *string   `json:"description"`
+		Category    *string   `json:"category"`
+		Tags        *[]string `json:"tags"`
+	}
+	userId, _ := primitive.ObjectIDFromHex(claims["id"].(string))
+
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "Please pass the required details", Data: map[string]interface{}{"error": err.Error()}})
+		return
+	}
+	communityId, _ := primitive.ObjectIDFromHex(body.CommunityId)
+	if !requireCommunityAdmin(w, communityId, userId) {
+		return
+	}
+
+	set := bson.M{}
+	if body.Name != nil {
+		if strings.TrimSpace(*body.Name) == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "Communities need a name"})
+			return
+		}
+		set["name"] = strings.TrimSpace(*body.Name)
+	}
+	if body.Description != nil {
+		set["description"] = *body.Description
+		set["descriptionHtml"] = content.Render(*body.Description).HTML
+	}
+	category := ""
+	if body.Category != nil {
+		category = *body.Category
+		set["category"] = category
+	}
+	if body.Tags != nil || body.Category != nil {
+		var tags []string
+		if body.Tags != nil {
+			tags = *body.Tags
+		}
+		normalized, ok := normalizeTags(w, category, tags)
+		if !ok {
+			return
+		}
+		if body.Tags != nil {
+			set["tags"] = normalized
+		}
+	}
+	if len(set) == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "Nothing to update"})
+		return
+	}
+
+	var previous bson.M
+	fields := bson.M{}
+	for field := range set {
+		fields[field] = 1
+	}
+	if err := communityCollection.FindOneAndUpdate(context.TODO(), bson.M{"_id": communityId}, bson.M{"$set": set}, options.FindOneAndUpdate().SetProjection(fields)).Decode(&previous); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusInternalServerError, Message: "Unable to update community", Data: map[string]interface{}{"error": err.Error()}})
+		return
+	}
+	delete(previous, "_id")
+
+	audit(context.TODO(), communityId, userId, models.AuditUpdate, models.AuditCommunity, communityId, previous, set)
+	emit(context.TODO(), communityId, userId, EventCommunityUpdated, map[string]interface{}{"changes": set})
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusOK, Message: "Community updated", Data: map[string]interface{}{"changes": set}})
+}
+
+// join community
+func (c *Community) Join(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		CommunityId string `json:"communityId"`
+	}
+	var community models.Community
+	_, claims, _ := jwtauth.FromContext(r.Context())
+	userId, _ := primitive.ObjectIDFromHex(claims["id"].(string))
+
+	if !requireVerified(w, userId) {
+		return
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "Please pass the required details", Data: map[string]interface{}{"error": err.Error()}})
+		return
+	}
+	communityId, _ := primitive.ObjectIDFromHex(body.CommunityId)
+	if err := communityCollection.FindOne(context.TODO(), bson.M{"_id": communityId}).Decode(&community); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "Unable to find community", Data: map[string]interface{}{"error": err.Error(), "id": communityId}})
+		return
+	}
+	if isMember(community, userId) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "User already in the community"})
+		return
+	} else {
+		joinedAt := primitive.NewDateTimeFromTime(time.Now())
+		result, err := communityCollection.UpdateOne(context.TODO(), bson.M{"_id": communityId}, bson.M{"$push": bson.M{"members": models.Member{ID: userId, Admin: false, JoinedAt: &joinedAt}}})
+
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "Couldn't join community", Data: map[string]interface{}{"error": err.Error()}})
+			return
+		}
+
+		recordMembership(context.TODO(), communityId, userId, models.MembershipJoined)
+		emit(context.TODO(), communityId, userId, EventMemberJoined, map[string]interface{}{"memberId": userId})
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusOK, Message: "Successfully joined community", Data: map[string]interface{}{"result": result}})
+
+	}
+}
+
+// leave a community
+func (c *Community) Leave(w http.ResponseWriter, r *http.Request) {
+	_, claims, _ := jwtauth.FromContext(r.Context())
+	var body struct {
+		CommunityId string `json:"communityId"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadGateway, Message: "Please pass in the required body parameters", Data: map[string]interface{}{"error": err.Error()}})
+		return
+	}
+	userId, _ := primitive.ObjectIDFromHex(claims["id"].(string))
+	communityId, _ := primitive.ObjectIDFromHex(body.CommunityId)
+	result, err := communityCollection.UpdateOne(context.TODO(), bson.M{"_id": communityId}, bson.M{"$pull": bson.M{"members": bson.M{"id": userId}}})
+
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadGateway, Message: "An error occured while leaving the community", Data: map[string]interface{}{"error": err.Error()}})
+		return
+	} else {
+		if result.ModifiedCount > 0 {
+			recordMembership(context.TODO(), communityId, userId, models.MembershipLeft)
+			emit(context.TODO(), communityId, userId, EventMemberLeft, map[string]interface{}{"memberId": userId})
+		}
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusOK, Message: "Successfully left the community", Data: map[string]interface{}{"result": result}})
+
+	}
+}
+
+// search community
+func (c *Community) SearchCommunity(w http.ResponseWriter, r *http.Request) {
+	_, claims, _ := jwtauth.FromContext(r.Context())
+	query := r.URL.Query().Get("query")
+
+	var result []models.Community
+	userId, _ := primitive.ObjectIDFromHex(claims["id"].(string))
+
+	cursor, _ := communityCollection.Find(context.TODO(), bson.M{"name": bson.M{"$regex": query}})
+
+	if err := cursor.All(context.TODO(), &result); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "A server error has occured"})
+		return
+	}
+	for i := range result {
+		result[i] = communityImages(renderLegacyContent(result[i]))
+		result[i].Announcements = visibleAnnouncements(result[i], userId)
+	}
+	withCreatorAvatars(context.TODO(), result)
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusOK, Message: "Communities found", Data: map[string]interface{}{"result": result}})
+
+}
+
+// ANNOUNCEMENT SECTION
+
+// create announcement, admins only. It is published at publishAt (or now) unless it is a draft and hidden again after expireAt
+func (c *Community) CreateAnnouncement(w http.ResponseWriter, r *http.Request) {
+	_, claims, _ := jwtauth.FromContext(r.Context())
+	var body struct {
+		Name        string `json:"name"`
+		Date        string `json:"date"`
+		PublishAt   string `json:"publishAt"`
+		ExpireAt    string `json:"expireAt"`
+		Draft       bool   `json:"draft"`
+		Message     string `json:"message"`
+		CommunityId string `json:"communityId"`
+	}
+	json.NewDecoder(r.Body).Decode(&body)
+
+	// "date" is the older name for publishAt
+	if body.PublishAt == "" {
+		body.PublishAt = body.Date
+	}
+	publishAt, expireAt, ok := parseAnnouncementTimes(w, body.PublishAt, body.ExpireAt)
+	if !ok {
+		return
+	}
+
+	userId, _ := primitive.ObjectIDFromHex(claims["id"].(string))
+	communityId, _ := primitive.ObjectIDFromHex(body.CommunityId)
+	if !requireCommunityAdmin(w, communityId, userId) {
+		return
+	}
+
+	var community models.Community
+	rendered := content.Render(body.Message)
+	communityCollection.FindOne(context.TODO(), bson.M{"_id": communityId}).Decode(&community)
+	mentions, ok := mentionsFor(w, community, userId, rendered.Mentions)
+	if !ok {
+		return
+	}
+
+	announcement := models.Announcement{
+		ID:          primitive.NewObjectID(),
+		Date:        publishAt,
+		ExpireAt:    expireAt,
+		Message:     body.Message,
+		MessageHTML: rendered.HTML,
+		Mentions:    mentions,
+		Hashtags:    rendered.Hashtags,
+		Draft:       body.Draft,
+		Scheduled:   true,
+	}
+	announcement.Creator.Name = body.Name
+	announcement.Creator.ID = userId
+	newAnnouncement := bson.M{"announcements": announcement}
+
+	result, err := communityCollection.UpdateOne(context.TODO(), bson.M{"_id": communityId}, bson.M{"$push": newAnnouncement})
+
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadGateway, Message: "An error occured while creating an announcement", Data: map[string]interface{}{"error": err.Error()}})
+		return
+	} else {
+		if result.MatchedCount > 0 {
+			audit(context.TODO(), communityId, userId, models.AuditCreate, models.AuditAnnouncement, announcement.ID, nil, announcement)
+			scheduleAnnouncement(context.TODO(), communityId, announcement)
+		}
+		withAvatars(context.TODO(), &announcement.Creator)
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusCreated, Message: "Announcement created successfully", Data: map[string]interface{}{"result": result, "announcement": announcement}})
+	}
+
+}
+
+// publish a draft at publishAt or straight away, admins only since drafts are hidden from everyone else
+func (c *Community) PublishAnnouncement(w http.ResponseWriter, r *http.Request) {
+	_, claims, _ := jwtauth.FromContext(r.Context())
+	var body struct {
+		AnnouncementId string `json:"announcementId"`
+		CommunityId    string `json:"communityId"`
+		PublishAt      string `json:"publishAt"`
+		ExpireAt       string `json:"expireAt"`
+	}
+	json.NewDecoder(r.Body).Decode(&body)
+
+	userId, _ := primitive.ObjectIDFromHex(claims["id"].(string))
+	communityId, _ := primitive.ObjectIDFromHex(body.CommunityId)
+	announcementId, _ := primitive.ObjectIDFromHex(body.AnnouncementId)
+
+	publishAt, expireAt, ok := parseAnnouncementTimes(w, body.PublishAt, body.ExpireAt)
+	if !ok {
+		return
+	}
+
+	_, announcement, ok := findManagedAnnouncement(w, communityId, announcementId, userId)
+	if !ok {
+		return
+	}
+	if !announcement.Draft {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "Announcement is not a draft"})
+		return
+	}
+
+	before := announcement
+	announcement.Draft = false
+	announcement.Scheduled = true
+	announcement.Date = publishAt
+	if expireAt != nil {
+		announcement.ExpireAt = expireAt
+	}
+
+	filters := options.ArrayFilters{Filters: []interface{}{bson.M{"a.id": announcementId, "a.draft": true}}}
+	update := bson.M{"$set": bson.M{"announcements.$[a].date": announcement.Date, "announcements.$[a].expireAt": announcement.ExpireAt, "announcements.$[a].scheduled": true}, "$unset": bson.M{"announcements.$[a].draft": ""}}
+	result, err := communityCollection.UpdateOne(context.TODO(), bson.M{"_id": communityId}, update, options.Update().SetArrayFilters(filters))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusInternalServerError, Message: "Unable to publish announcement", Data: map[string]interface{}{"error": err.Error()}})
+		return
+	}
+	if result.ModifiedCount > 0 {
+		audit(context.TODO(), communityId, userId, models.AuditPublish, models.AuditAnnouncement, announcementId, before, announcement)
+		scheduleAnnouncement(context.TODO(), communityId, announcement)
+	}
+
+	withAvatars(context.TODO(), &announcement.Creator)
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusOK, Message: "Announcement scheduled", Data: map[string]interface{}{"announcement": announcement}})
+}
+
+// parse optional RFC3339 publish and expiry times, publishing defaults to now. Writes the response on error.
+func parseAnnouncementTimes(w http.ResponseWriter, publishAt string, expireAt string) (primitive.DateTime, *primitive.DateTime, bool) {
+	publish := time.Now()
+	if publishAt != "" {
+		parsed, err := time.Parse(time.RFC3339, publishAt)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "publishAt must be an RFC3339 time", Data: map[string]interface{}{"error": err.Error()}})
+			return 0, nil, false
+		}
+		publish = parsed
+	}
+
+	if expireAt == "" {
+		return primitive.NewDateTimeFromTime(publish), nil, true
+	}
+	expire, err := time.Parse(time.RFC3339, expireAt)
+	if err != nil || !expire.After(publish) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "expireAt must be an RFC3339 time after publishAt"})
+		return 0, nil, false
+	}
+	expiry := primitive.NewDateTimeFromTime(expire)
+	return primitive.NewDateTimeFromTime(publish), &expiry, true
+}
+
+// edit an announcement's message or times, admins and the author only. Every edit is kept in its history.
+func (c *Community) UpdateAnnouncement(w http.ResponseWriter, r *http.Request) {
+	_, claims, _ := jwtauth.FromContext(r.Context())
+	var body struct {
+		AnnouncementId string  `json:"announcementId"`
+		CommunityId    string  `json:"communityId"`
+		Message        *string `json:"message"`
+		PublishAt      *string `json:"publishAt"`
+		// an empty string removes the expiry
+		ExpireAt *string `json:"expireAt"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "Please pass the required details", Data: map[string]interface{}{"error": err.Error()}})
+		return
+	}
+
+	userId, _ := primitive.ObjectIDFromHex(claims["id"].(string))
+	communityId, _ := primitive.ObjectIDFromHex(body.CommunityId)
+	announcementId, _ := primitive.ObjectIDFromHex(body.AnnouncementId)
+
+	community, announcement, ok := findManagedAnnouncement(w, communityId, announcementId, userId)
+	if !ok {
+		return
+	}
+	before := announcement
+	published := !announcement.Draft && !announcement.Scheduled
+	previousMentions := announcement.Mentions
+
+	if body.PublishAt != nil && published {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "The announcement is already published"})
+		return
+	}
+
+	publishAt := announcement.Date.Time().Format(time.RFC3339)
+	if body.PublishAt != nil {
+		publishAt = *body.PublishAt
+	}
+	expireAt := ""
+	if announcement.ExpireAt != nil {
+		expireAt = announcement.ExpireAt.Time().Format(time.RFC3339)
+	}
+	if body.ExpireAt != nil {
+		expireAt = *body.ExpireAt
+	}
+	date, expiry, ok := parseAnnouncementTimes(w, publishAt, expireAt)
+	if !ok {
+		return
+	}
+
+	changes := []models.FieldChange{}
+	set := bson.M{}
+	unset := bson.M{}
+	if body.Message != nil && *body.Message != announcement.Message {
+		changes = append(changes, models.FieldChange{Field: "message", From: announcement.Message, To: *body.Message})
+		rendered := content.Render(*body.Message)
+		mentions, ok := mentionsFor(w, community, userId, rendered.Mentions)
+		if !ok {
+			return
+		}
+		set["announcements.$[a].message"] = rendered.Source
+		set["announcements.$[a].messageHtml"] = rendered.HTML
+		set["announcements.$[a].mentionRefs"] = mentions
+		set["announcements.$[a].hashtags"] = rendered.Hashtags
+		announcement.Message = rendered.Source
+		announcement.MessageHTML = rendered.HTML
+		announcement.Mentions = mentions
+		announcement.Hashtags = rendered.Hashtags
+	}
+	if body.PublishAt != nil && date != announcement.Date {
+		changes = append(changes, models.FieldChange{Field: "publishAt", From: announcement.Date, To: date})
+		set["announcements.$[a].date"] = date
+		announcement.Date = date
+	}
+	if body.ExpireAt != nil && !sameTime(expiry, announcement.ExpireAt) {
+		changes = append(changes, models.FieldChange{Field: "expireAt", From: announcement.ExpireAt, To: expiry})
+		if expiry == nil {
+			unset["announcements.$[a].expireAt"] = ""
+		} else {
+			set["announcements.$[a].expireAt"] = expiry
+		}
+		announcement.ExpireAt = expiry
+	}
+
+	if len(changes) == 0 {
+		withAvatars(context.TODO(), &announcement.Creator)
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusOK, Message: "Nothing to update", Data: map[string]interface{}{"announcement": announcement}})
+		return
+	}
+
+	now := primitive.NewDateTimeFromTime(time.Now())
+	announcement.EditedAt = &now
+	set["announcements.$[a].editedAt"] = now
+	update := bson.M{"$set": set}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+
+	// record the edit first so an update never lands without its history, and remove the
+	// record again if the update fails
+	edit := models.AnnouncementEdit{
+		ID:             primitive.NewObjectID(),
+		CommunityID:    communityId,
+		AnnouncementID: announcementId,
+		EditedBy:       userId,
+		EditedAt:       now,
+		Changes:        changes,
+	}
+	if _, err := announcementEditCollection.InsertOne(context.TODO(), edit); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusInternalServerError, Message: "Unable to update announcement", Data: map[string]interface{}{"error": err.Error()}})
+		return
+	}
+
+	filters := options.ArrayFilters{Filters: []interface{}{bson.M{"a.id": announcementId}}}
+	result, err := communityCollection.UpdateOne(context.TODO(), bson.M{"_id": communityId, "announcements.id": announcementId}, update, options.Update().SetArrayFilters(filters))
+	if err != nil {
+		announcementEditCollection.DeleteOne(context.TODO(), bson.M{"_id": edit.ID})
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusInternalServerError, Message: "Unable to update announcement", Data: map[string]interface{}{"error": err.Error()}})
+		return
+	}
+	// deleted since it was read, an edit of nothing isn't history
+	if result.MatchedCount == 0 {
+		announcementEditCollection.DeleteOne(context.TODO(), bson.M{"_id": edit.ID})
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "Unable to find announcement"})
+		return
+	}
+
+	audit(context.TODO(), communityId, userId, models.AuditUpdate, models.AuditAnnouncement, announcementId, before, announcement)
+
+	if published {
+		emit(context.TODO(), communityId, userId, EventAnnouncementUpdated, map[string]interface{}{"announcement": announcement, "changes": changes})
+		go notifyMentions(context.Background(), community, announcement.Creator.ID, announcement.Creator.Name, addedMentions(previousMentions, announcement.Mentions), announcement.Message, map[string]interface{}{"announcementId": announcement.ID})
+	} else if body.PublishAt != nil {
+		scheduleAnnouncement(context.TODO(), communityId, announcement)
+	}
+
+	withAvatars(context.TODO(), &announcement.Creator)
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusOK, Message: "Announcement updated", Data: map[string]interface{}{"announcement": announcement}})
+}
+
+// list an announcement's edits, newest first, admins and the author only
+func (c *Community) AnnouncementHistory(w http.ResponseWriter, r *http.Request) {
+	_, claims, _ := jwtauth.FromContext(r.Context())
+	var result []models.AnnouncementEdit
+	userId, _ := primitive.ObjectIDFromHex(claims["id"].(string))
+	communityId, _ := primitive.ObjectIDFromHex(r.URL.Query().Get("communityId"))
+	announcementId, _ := primitive.ObjectIDFromHex(r.URL.Query().Get("announcementId"))
+
+	if _, _, ok := findManagedAnnouncement(w, communityId, announcementId, userId); !ok {
+		return
+	}
+
+	cursor, _ := announcementEditCollection.Find(context.TODO(), bson.M{"announcementId": announcementId}, options.Find().SetSort(bson.M{"editedAt": -1}))
+	if err := cursor.All(context.TODO(), &result); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "A server error has occured", Data: map[string]interface{}{"error": err.Error()}})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusOK, Message: "History fetched successfully", Data: map[string]interface{}{"result": result}})
+}
+
+// pin an announcement to the top of listings, admins only
+func (c *Community) PinAnnouncement(w http.ResponseWriter, r *http.Request) {
+	_, claims, _ := jwtauth.FromContext(r.Context())
+	var body struct {
+		AnnouncementId string `json:"announcementId"`
+		CommunityId    string `json:"communityId"`
+	}
+	var community models.Community
+	json.NewDecoder(r.Body).Decode(&body)
+
+	userId, _ := primitive.ObjectIDFromHex(claims["id"].(string))
+	communityId, _ := primitive.ObjectIDFromHex(body.CommunityId)
+	announcementId, _ := primitive.ObjectIDFromHex(body.AnnouncementId)
+	limit := configs.MaxPinnedAnnouncements()
+
+	if !requireCommunityAdmin(w, communityId, userId) {
+		return
+	}
+	if limit <= 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "Pinning announcements is disabled"})
+		return
+	}
+
+	// the limit is part of the filter so concurrent pins can't go over it
+	filter := bson.M{
+		"_id":                 communityId,
+		"announcements.id":    announcementId,
+		"pinnedAnnouncements": bson.M{"$ne": announcementId},
+		"pinnedAnnouncements." + strconv.Itoa(limit-1): bson.M{"$exists": false},
+	}
+	err := communityCollection.FindOneAndUpdate(context.TODO(), filter, bson.M{"$push": bson.M{"pinnedAnnouncements": announcementId}}, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&community)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "Unable to pin, the announcement may already be pinned or the pin limit was reached", Data: map[string]interface{}{"limit": limit}})
+		return
+	}
+
+	audit(context.TODO(), communityId, userId, models.AuditPin, models.AuditAnnouncement, announcementId, nil, bson.M{"pinned": community.PinnedAnnouncements})
+	emit(context.TODO(), communityId, userId, EventAnnouncementPinsChanged, map[string]interface{}{"pinned": community.PinnedAnnouncements})
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusOK, Message: "Announcement pinned", Data: map[string]interface{}{"pinned": community.PinnedAnnouncements}})
+}
+
+// unpin an announcement, admins only
+func (c *Community) UnpinAnnouncement(w http.ResponseWriter, r *http.Request) {
+	_, claims, _ := jwtauth.FromContext(r.Context())
+	var body struct {
+		AnnouncementId string `json:"announcementId"`
+		CommunityId    string `json:"communityId"`
+	}
+	var community models.Community
+	json.NewDecoder(r.Body).Decode(&body)
+
+	userId, _ := primitive.ObjectIDFromHex(claims["id"].(string))
+	communityId, _ := primitive.ObjectIDFromHex(body.CommunityId)
+	announcementId, _ := primitive.ObjectIDFromHex(body.AnnouncementId)
+
+	if !requireCommunityAdmin(w, communityId, userId) {
+		return
+	}
+
+	err := communityCollection.FindOneAndUpdate(context.TODO(), bson.M{"_id": communityId, "pinnedAnnouncements": announcementId}, bson.M{"$pull": bson.M{"pinnedAnnouncements": announcementId}}, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&community)
+	if err == nil {
+		audit(context.TODO(), communityId, userId, models.AuditUnpin, models.AuditAnnouncement, announcementId, nil, bson.M{"pinned": community.PinnedAnnouncements})
+		emit(context.TODO(), communityId, userId, EventAnnouncementPinsChanged, map[string]interface{}{"pinned": community.PinnedAnnouncements})
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusOK, Message: "Announcement unpinned", Data: map[string]interface{}{"pinned": community.PinnedAnnouncements}})
+}
+
+// set the order of the pinned announcements, the list must contain exactly the pinned ids. Admins only.
+func (c *Community) ReorderPinnedAnnouncements(w http.ResponseWriter, r *http.Request) {
+	_, claims, _ := jwtauth.FromContext(r.Context())
+	var body struct {
+		AnnouncementIds []string `json:"announcementIds"`
+		CommunityId     string   `json:"communityId"`
+	}
+	json.NewDecoder(r.Body).Decode(&body)
+
+	userId, _ := primitive.ObjectIDFromHex(claims["id"].(string))
+	communityId, _ := primitive.ObjectIDFromHex(body.CommunityId)
+
+	if !requireCommunityAdmin(w, communityId, userId) {
+		return
+	}
+
+	order := []primitive.ObjectID{}
+	for _, id := range body.AnnouncementIds {
+		announcementId, err := primitive.ObjectIDFromHex(id)
+		if err != nil || slices.Contains(order, announcementId) {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "announcementIds must be distinct announcement ids", Data: map[string]interface{}{"id": id}})
+			return
+		}
+		order = append(order, announcementId)
+	}
+
+	var previous models.Community
+	filter := bson.M{"_id": communityId, "pinnedAnnouncements": bson.M{"$all": order, "$size": len(order)}}
+	err := communityCollection.FindOneAndUpdate(context.TODO(), filter, bson.M{"$set": bson.M{"pinnedAnnouncements": order}}, options.FindOneAndUpdate().SetProjection(bson.M{"pinnedAnnouncements": 1})).Decode(&previous)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "announcementIds must list every pinned announcement"})
+		return
+	}
+
+	audit(context.TODO(), communityId, userId, models.AuditReorder, models.AuditCommunity, communityId, bson.M{"pinned": previous.PinnedAnnouncements}, bson.M{"pinned": order})
+	emit(context.TODO(), communityId, userId, EventAnnouncementPinsChanged, map[string]interface{}{"pinned": order})
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusOK, Message: "Pinned announcements reordered", Data: map[string]interface{}{"pinned": order}})
+}
+
+// delete announcement, admins and the author only
+func (c *Community) DeleteAnnouncement(w http.ResponseWriter, r *http.Request) {
+	_, claims, _ := jwtauth.FromContext(r.Context())
+	var body struct {
+		AnnouncementId string `json:"announcementId"`
+		CommunityId    string `json:"communityId"`
+	}
+	json.NewDecoder(r.Body).Decode(&body)
+
+	userId, _ := primitive.ObjectIDFromHex(claims["id"].(string))
+	communityId, _ := primitive.ObjectIDFromHex(body.CommunityId)
+	announcementId, _ := primitive.ObjectIDFromHex(body.AnnouncementId)
+
+	_, announcement, ok := findManagedAnnouncement(w, communityId, announcementId, userId)
+	if !ok {
+		return
+	}
+
+	result, err := communityCollection.UpdateOne(context.TODO(), bson.M{"_id": communityId}, bson.M{"$pull": bson.M{"announcements": bson.M{"id": announcementId}, "pinnedAnnouncements": announcementId}})
+	if err == nil && result.ModifiedCount > 0 {
+		audit(context.TODO(), communityId, userId, models.AuditDelete, models.AuditAnnouncement, announcementId, announcement, nil)
+		emit(context.TODO(), communityId, userId, EventAnnouncementDeleted, map[string]interface{}{"announcementId": announcementId})
+		enqueue(context.TODO(), JobPurgeAnnouncement, purgePayload{ID: announcementId})
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusOK, Message: "Announcement deleted"})
+}
+
+// EVENTS SECTIONS
+
+// create event, admins only
+func (c *Community) CreateEvent(w http.ResponseWriter, r *http.Request) {
+	_, claims, _ := jwtauth.FromContext(r.Context())
+	var body struct {
+		Name        string `json:"name"`
+		Description string `json:"description"`
+		Date        string `json:"date"`
+		Time        string `json:"time"`
+		CommunityId string `json:"communityId"`
+		Address     string `json:"address"`
+		// structured address, coordinates and online link, geocoded later when coordinates are left out
+		Location *locationInput `json:"location"`
+		// "all" (default) or "rsvp"
+		ReminderAudience string `json:"reminderAudience"`
+	}
+	json.NewDecoder(r.Body).Decode(&body)
+
+	userId, _ := primitive.ObjectIDFromHex(claims["id"].(string))
+	communityId, _ := primitive.ObjectIDFromHex(body.CommunityId)
+	if !requireCommunityAdmin(w, communityId, userId) {
+		return
+	}
+	parsedDate, _ := time.Parse(time.RFC3339, body.Date)
+	date := primitive.NewDateTimeFromTime(parsedDate)
+
+	if body.ReminderAudience != models.ReminderAudienceRSVP {
+		body.ReminderAudience = models.ReminderAudienceAll
+	}
+	eventId := primitive.NewObjectID()
+	description := content.Render(body.Description)
+
+	newEvent := bson.M{
+		"name":             body.Name,
+		"id":               eventId,
+		"description":      body.Description,
+		"descriptionHtml":  description.HTML,
+		"hashtags":         description.Hashtags,
+		"date":             date,
+		"time":             body.Time,
+		"address":          body.Address,
+		"reminderAudience": body.ReminderAudience,
+	}
+	if body.Location != nil {
+		location, ok := resolveLocation(w, body.Location)
+		if !ok {
+			return
+		}
+		newEvent["location"] = location
+		if body.Address == "" {
+			newEvent["address"] = body.Location.address()
+		}
+	}
+
+	result, err := communityCollection.UpdateOne(context.TODO(), bson.M{"_id": communityId}, bson.M{"$push": bson.M{"events": newEvent}})
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadGateway, Message: "An error occured while adding the event", Data: map[string]interface{}{"error": err.Error()}})
+		return
+	} else {
+		if result.MatchedCount > 0 {
+			audit(context.TODO(), communityId, userId, models.AuditCreate, models.AuditEvent, eventId, nil, newEvent)
+			emit(context.TODO(), communityId, userId, EventEventCreated, map[string]interface{}{"event": newEvent})
+			scheduleReminders(context.TODO(), communityId, eventId, parsedDate)
+			if location, ok := newEvent["location"].(*models.Location); ok {
+				geocodeEvent(context.TODO(), communityId, eventId, location)
+			}
+		}
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusCreated, Message: "Event added successfully", Data: map[string]interface{}{"result": result}})
+	}
+
+}
+
+// delete event, admins only
+func (c *Community) DeleteEvent(w http.ResponseWriter, r *http.Request) {
+	_, claims, _ := jwtauth.FromContext(r.Context())
+	var body struct {
+		EventId     string `json:"eventId"`
+		CommunityId string `json:"communityId"`
+	}
+	json.NewDecoder(r.Body).Decode(&body)
+
+	userId, _ := primitive.ObjectIDFromHex(claims["id"].(string))
+	communityId, _ := primitive.ObjectIDFromHex(body.CommunityId)
+	eventId, _ := primitive.ObjectIDFromHex(body.EventId)
+	if !requireCommunityAdmin(w, communityId, userId) {
+		return
+	}
+
+	// the removed event comes back through the projection so the audit log keeps a copy
+	var previous models.Community
+	filter := bson.M{"_id": communityId, "events.id": eventId}
+	projection := bson.M{"events": bson.M{"$elemMatch": bson.M{"id": eventId}}}
+	err := communityCollection.FindOneAndUpdate(context.TODO(), filter, bson.M{"$pull": bson.M{"events": bson.M{"id": eventId}}}, options.FindOneAndUpdate().SetProjection(projection)).Decode(&previous)
+	if event, ok := findEvent(previous, eventId); err == nil && ok {
+		audit(context.TODO(), communityId, userId, models.AuditDelete, models.AuditEvent, eventId, event, nil)
+		emit(context.TODO(), communityId, userId, EventEventDeleted, map[string]interface{}{"eventId": eventId})
+		enqueue(context.TODO(), JobPurgeEvent, purgePayload{ID: eventId})
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusOK, Message: "Event deleted"})
+}
+
+// update event, admins only
+func (c *Community) UpdateEvent(w http.ResponseWriter, r *http.Request) {
+	_, claims, _ := jwtauth.FromContext(r.Context())
+	var body struct {
+		Name        string `json:"name"`
+		Description string `json:"description"`
+		Date        string `json:"date"`
+		Time        string `json:"time"`
+		CommunityId string `json:"communityId"`
+		EventId     string `json:"eventId"`
+		// replaces the location when passed
+		Location *locationInput `json:"location"`
+	}
+	json.NewDecoder(r.Body).Decode(&body)
+
+	userId, _ := primitive.ObjectIDFromHex(claims["id"].(string))
+	communityId, _ := primitive.ObjectIDFromHex(body.CommunityId)
+	eventId, _ := primitive.ObjectIDFromHex(body.EventId)
+	if !requireCommunityAdmin(w, communityId, userId) {
+		return
+	}
+
+	description := content.Render(body.Description)
+
+	set := bson.M{"events.$.name": body.Name, "events.$.description": body.Description, "events.$.descriptionHtml": description.HTML, "events.$.hashtags": description.Hashtags, "events.$.time": body.Time}
+	changed := bson.M{"id": eventId, "name": body.Name, "description": body.Description, "descriptionHtml": description.HTML, "time": body.Time}
+	// leaving the date out keeps the current one
+	var date primitive.DateTime
+	if body.Date != "" {
+		parsedDate, err := time.Parse(time.RFC3339, body.Date)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "date must be an RFC3339 time"})
+			return
+		}
+		date = primitive.NewDateTimeFromTime(parsedDate)
+		set["events.$.date"] = date
+		changed["date"] = date
+	}
+	if body.Location != nil {
+		location, ok := resolveLocation(w, body.Location)
+		if !ok {
+			return
+		}
+		set["events.$.location"] = location
+		set["events.$.address"] = body.Location.address()
+		changed["location"] = location
+		changed["address"] = body.Location.address()
+	}
+
+	var previous models.Community
+	communityCollection.FindOne(context.TODO(), bson.M{"_id": communityId}, options.FindOne().SetProjection(bson.M{"events": bson.M{"$elemMatch": bson.M{"id": eventId}}})).Decode(&previous)
+
+	result, err := communityCollection.UpdateOne(context.TODO(), bson.M{"_id": communityId, "events.id": eventId}, bson.M{"$set": set})
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadGateway, Message: "An error occured while updating the event", Data: map[string]interface{}{"error": err.Error()}})
+		return
+	} else {
+		if result.MatchedCount > 0 {
+			before, _ := findEvent(previous, eventId)
+			audit(context.TODO(), communityId, userId, models.AuditUpdate, models.AuditEvent, eventId, before, changed)
+			emit(context.TODO(), communityId, userId, EventEventUpdated, map[string]interface{}{"event": changed})
+			// moving an event schedules its reminders again
+			if body.Date != "" && date != before.Date {
+				scheduleReminders(context.TODO(), communityId, eventId, date.Time())
+			}
+			if location, ok := set["events.$.location"].(*models.Location); ok {
+				geocodeEvent(context.TODO(), communityId, eventId, location)
+			}
+		}
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusCreated, Message: "Event updated successfully", Data: map[string]interface{}{"result": result}})
+	}
+
+}
+
+// rsvp to an event
+func (c *Community) RSVP(w http.ResponseWriter, r *http.Request) {
+	updateAttendance(w, r, "$addToSet", "RSVP saved")
+}
+
+// cancel an rsvp
+func (c *Community) CancelRSVP(w http.ResponseWriter, r *http.Request) {
+	updateAttendance(w, r, "$pull", "RSVP cancelled")
+}
+
+func updateAttendance(w http.ResponseWriter, r *http.Request, operator string, message string) {
+	_, claims, _ := jwtauth.FromContext(r.Context())
+	var body struct {
+		EventId     string `json:"eventId"`
+		CommunityId string `json:"communityId"`
+	}
+	json.NewDecoder(r.Body).Decode(&body)
+
+	userId, _ := primitive.ObjectIDFromHex(claims["id"].(string))
+	communityId, _ := primitive.ObjectIDFromHex(body.CommunityId)
+	eventId, _ := primitive.ObjectIDFromHex(body.EventId)
+
+	// the filter touches two arrays, so the event is addressed with an array filter rather than $
+	filter := bson.M{"_id": communityId, "members.id": userId, "events.id": eventId}
+	opts := options.Update().SetArrayFilters(options.ArrayFilters{Filters: []interface{}{bson.M{"e.id": eventId}}})
+	result, err := communityCollection.UpdateOne(context.TODO(), filter, bson.M{operator: bson.M{"events.$[e].attendees": userId}}, opts)
+	if err != nil || result.MatchedCount == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "Unable to find event in your communities"})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusOK, Message: message})
+}
@@ -0,0 +1,38 @@
+package handler
+
+import (
+	"github.com/zillalikestocode/community-api/content"
+	"github.com/zillalikestocode/community-api/models"
+)
+
+// render the Markdown of communities, announcements and events saved before rendering
+// happened on write, so every response carries HTML alongside the source
+func renderLegacyContent(community models.Community) models.Community {
+	if community.DescriptionHTML == "" && community.Description != "" {
+		community.DescriptionHTML = content.Render(community.Description).HTML
+	}
+
+	announcements := make([]models.Announcement, len(community.Announcements))
+	for i, announcement := range community.Announcements {
+		if announcement.MessageHTML == "" && announcement.Message != "" {
+			rendered := content.Render(announcement.Message)
+			announcement.MessageHTML = rendered.HTML
+			announcement.Hashtags = rendered.Hashtags
+		}
+		announcements[i] = announcement
+	}
+	community.Announcements = announcements
+
+	events := make([]models.Event, len(community.Events))
+	for i, event := range community.Events {
+		if event.DescriptionHTML == "" && event.Description != "" {
+			rendered := content.Render(event.Description)
+			event.DescriptionHTML = rendered.HTML
+			event.Hashtags = rendered.Hashtags
+		}
+		events[i] = event
+	}
+	community.Events = events
+
+	return community
+}
@@ -0,0 +1,76 @@
+package handler
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/zillalikestocode/community-api/configs"
+	"github.com/zillalikestocode/community-api/jobs"
+	"github.com/zillalikestocode/community-api/responses"
+)
+
+// how long one call drains the job queue, it has to stay under the function's time limit.
+// Jobs still running then are cancelled and retried once their lease expires.
+const cronJobsBudget = 50 * time.Second
+
+// Cron runs the background work of a server process for deployments without one, such as
+// Vercel, where a scheduler calls these endpoints instead
+type Cron struct{}
+
+// RequireCronSecret only lets through requests carrying CRON_SECRET as a bearer token,
+// which is how Vercel calls cron jobs. Without the secret set the endpoints are disabled.
+func RequireCronSecret(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		secret := configs.CronSecret()
+		if secret == "" || subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+secret)) != 1 {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusUnauthorized, Message: "Unauthorized"})
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Setup creates the indexes and backfills documents, as a server does before it starts
+func (c *Cron) Setup(w http.ResponseWriter, r *http.Request) {
+	if err := errors.Join(EnsureIndexes(context.TODO()), Backfill(context.TODO())); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusInternalServerError, Message: "Setup failed", Data: map[string]interface{}{"error": err.Error()}})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusOK, Message: "Setup complete"})
+}
+
+// Reminders sends the event reminders that are due
+func (c *Cron) Reminders(w http.ResponseWriter, r *http.Request) {
+	sent := SendDueReminders(r.Context())
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusOK, Message: "Reminders sent", Data: map[string]interface{}{"reminders": sent}})
+}
+
+// Jobs runs the queued background jobs that are due. Only the mongo queue is shared between
+// invocations, JOB_QUEUE=memory can't be drained this way.
+func (c *Cron) Jobs(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), cronJobsBudget)
+	defer cancel()
+
+	pool := jobs.NewPool(jobQueue, 1)
+	RegisterJobs(pool)
+	ran, err := pool.Drain(ctx)
+	if err != nil && !errors.Is(err, context.DeadlineExceeded) {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusInternalServerError, Message: "Unable to run jobs", Data: map[string]interface{}{"error": err.Error(), "jobs": ran}})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusOK, Message: "Jobs run", Data: map[string]interface{}{"jobs": ran}})
+}
@@ -0,0 +1,393 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/jwtauth/v5"
+	"github.com/zillalikestocode/community-api/configs"
+	"github.com/zillalikestocode/community-api/models"
+	"github.com/zillalikestocode/community-api/responses"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// categories a community can be listed under
+var communityCategories = []string{
+	"art", "books", "business", "education", "environment", "faith", "family", "fitness",
+	"food", "gaming", "health", "hobbies", "local", "music", "outdoors", "politics",
+	"science", "social", "sports", "technology", "travel", "volunteering",
+}
+
+// ways the discovery endpoint can order communities
+const (
+	DiscoverTrending = "trending"
+	DiscoverPopular  = "popular"
+	DiscoverNew      = "new"
+)
+
+const (
+	maxCommunityTags = 10
+	maxTagLength     = 30
+	// how far back joins and activity count towards trending, in days
+	defaultDiscoverWindow = 7
+	maxDiscoverWindow     = 90
+	// members of the caller's communities compared when recommending, bounds the pipeline size
+	maxRecommendMembers = 1000
+)
+
+var tagPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+// a community as listed in discovery, without its members, announcements and events
+type communitySummary struct {
+	ID              primitive.ObjectID `json:"_id" bson:"_id"`
+	Name            string             `json:"name" bson:"name"`
+	Description     string             `json:"description" bson:"description"`
+	DescriptionHTML string             `json:"descriptionHtml,omitempty" bson:"descriptionHtml"`
+	Category        string             `json:"category,omitempty" bson:"category"`
+	Tags            []string           `json:"tags,omitempty" bson:"tags"`
+	Avatar          *models.Image      `json:"avatar,omitempty" bson:"avatar"`
+	Banner          *models.Image      `json:"banner,omitempty" bson:"banner"`
+	MemberCount     int                `json:"memberCount" bson:"memberCount"`
+	// members gained (joins minus leaves) and announcements and events posted within the window
+	NetJoins       int `json:"netJoins" bson:"netJoins"`
+	RecentActivity int `json:"recentActivity" bson:"recentActivity"`
+	Score          int `json:"score,omitempty" bson:"score"`
+	// recommendations only, why the community was suggested
+	SharedMembers int      `json:"sharedMembers,omitempty" bson:"sharedMembers"`
+	MatchedTags   []string `json:"matchedTags,omitempty" bson:"matchedTags"`
+}
+
+var summaryProjection = bson.M{
+	"name": 1, "description": 1, "descriptionHtml": 1, "category": 1, "tags": 1, "avatar": 1, "banner": 1,
+	"memberCount": 1, "netJoins": 1, "recentActivity": 1, "score": 1, "sharedMembers": 1, "matchedTags": 1,
+}
+
+// list the categories communities can use
+func (c *Community) Categories(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusOK, Message: "Categories fetched successfully", Data: map[string]interface{}{"result": communityCategories}})
+}
+
+// list communities the caller hasn't joined, ordered by ?sort= trending (net joins and
+// activity over the last ?days=), popular (members) or new. Filter with ?category= and ?tag=.
+func (c *Community) Discover(w http.ResponseWriter, r *http.Request) {
+	_, claims, _ := jwtauth.FromContext(r.Context())
+	query := r.URL.Query()
+	userId, _ := primitive.ObjectIDFromHex(claims["id"].(string))
+
+	sort := query.Get("sort")
+	if sort == "" {
+		sort = DiscoverTrending
+	}
+	if !slices.Contains([]string{DiscoverTrending, DiscoverPopular, DiscoverNew}, sort) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "sort must be trending, popular or new"})
+		return
+	}
+
+	days := defaultDiscoverWindow
+	if value, err := strconv.Atoi(query.Get("days")); err == nil && value > 0 && value <= maxDiscoverWindow {
+		days = value
+	}
+	limit, offset := discoverPage(query.Get("limit"), query.Get("offset"))
+
+	match := bson.M{"members.id": bson.M{"$ne": userId}}
+	if category := query.Get("category"); category != "" {
+		match["category"] = category
+	}
+	if tag := strings.ToLower(strings.TrimSpace(query.Get("tag"))); tag != "" {
+		match["tags"] = tag
+	}
+
+	order := bson.D{{Key: "score", Value: -1}, {Key: "memberCount", Value: -1}, {Key: "_id", Value: -1}}
+	switch sort {
+	case DiscoverPopular:
+		order = bson.D{{Key: "memberCount", Value: -1}, {Key: "_id", Value: -1}}
+	case DiscoverNew:
+		order = bson.D{{Key: "_id", Value: -1}}
+	}
+
+	ensureTrends(r.Context(), days)
+	fields := trendFields(days)
+	fields["score"] = bson.M{"$ifNull": bson.A{"$trends." + strconv.Itoa(days) + ".score", 0}}
+
+	result, err := summarize(context.TODO(), discoverPipeline(match, fields, order, offset, limit))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "A server error has occured", Data: map[string]interface{}{"error": err.Error()}})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusOK, Message: "Communities fetched successfully", Data: map[string]interface{}{"result": result, "sort": sort, "days": days}})
+}
+
+// suggest communities from the categories and tags of the caller's communities and where
+// their fellow members also belong, popular ones for users who haven't joined any yet
+func (c *Community) Recommended(w http.ResponseWriter, r *http.Request) {
+	_, claims, _ := jwtauth.FromContext(r.Context())
+	var mine []models.Community
+	userId, _ := primitive.ObjectIDFromHex(claims["id"].(string))
+	limit, offset := discoverPage(r.URL.Query().Get("limit"), r.URL.Query().Get("offset"))
+
+	cursor, _ := communityCollection.Find(context.TODO(), bson.M{"members.id": userId}, options.Find().SetProjection(bson.M{"category": 1, "tags": 1, "members.id": 1}))
+	if err := cursor.All(context.TODO(), &mine); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "A server error has occured", Data: map[string]interface{}{"error": err.Error()}})
+		return
+	}
+
+	categories := []string{}
+	tags := []string{}
+	fellows := []primitive.ObjectID{}
+	for _, community := range mine {
+		if community.Category != "" && !slices.Contains(categories, community.Category) {
+			categories = append(categories, community.Category)
+		}
+		for _, tag := range community.Tags {
+			if !slices.Contains(tags, tag) {
+				tags = append(tags, tag)
+			}
+		}
+		for _, member := range community.Members {
+			if len(fellows) < maxRecommendMembers && member.ID != userId && !slices.Contains(fellows, member.ID) {
+				fellows = append(fellows, member.ID)
+			}
+		}
+	}
+
+	match := bson.M{"members.id": bson.M{"$ne": userId}}
+	interests := bson.A{}
+	if len(categories) > 0 {
+		interests = append(interests, bson.M{"category": bson.M{"$in": categories}})
+	}
+	if len(tags) > 0 {
+		interests = append(interests, bson.M{"tags": bson.M{"$in": tags}})
+	}
+	if len(fellows) > 0 {
+		interests = append(interests, bson.M{"members.id": bson.M{"$in": fellows}})
+	}
+
+	ensureTrends(r.Context(), defaultDiscoverWindow)
+	fields := trendFields(defaultDiscoverWindow)
+	order := bson.D{{Key: "memberCount", Value: -1}, {Key: "_id", Value: -1}}
+	basis := DiscoverPopular
+	if len(interests) > 0 {
+		basis = "interests"
+		match["$or"] = interests
+		fields["matchedTags"] = bson.M{"$setIntersection": bson.A{bson.M{"$ifNull": bson.A{"$tags", bson.A{}}}, tags}}
+		fields["sharedMembers"] = bson.M{"$size": bson.M{"$setIntersection": bson.A{bson.M{"$ifNull": bson.A{"$members.id", bson.A{}}}, fellows}}}
+		fields["categoryMatch"] = bson.M{"$cond": bson.A{bson.M{"$in": bson.A{bson.M{"$ifNull": bson.A{"$category", ""}}, categories}}, 1, 0}}
+		order = bson.D{{Key: "score", Value: -1}, {Key: "memberCount", Value: -1}, {Key: "_id", Value: -1}}
+	}
+
+	pipeline := discoverPipeline(match, fields, order, offset, limit)
+	if len(interests) > 0 {
+		// scored in a second stage since it is built from the fields above
+		score := bson.M{"$addFields": bson.M{"score": bson.M{"$add": bson.A{
+			bson.M{"$multiply": bson.A{"$categoryMatch", 3}},
+			bson.M{"$multiply": bson.A{bson.M{"$size": "$matchedTags"}, 2}},
+			"$sharedMembers",
+		}}}}
+		pipeline = slices.Insert(pipeline, 2, score)
+	}
+
+	result, err := summarize(context.TODO(), pipeline)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "A server error has occured", Data: map[string]interface{}{"error": err.Error()}})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusOK, Message: "Recommendations fetched successfully", Data: map[string]interface{}{"result": result, "basis": basis}})
+}
+
+// check the category and clean up tags, writes the response when they are invalid
+func normalizeTags(w http.ResponseWriter, category string, tags []string) ([]string, bool) {
+	if category != "" && !slices.Contains(communityCategories, category) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "Unknown category", Data: map[string]interface{}{"categories": communityCategories}})
+		return nil, false
+	}
+
+	result := []string{}
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(tag), "#")))
+		if tag == "" || slices.Contains(result, tag) {
+			continue
+		}
+		if len(tag) > maxTagLength || !tagPattern.MatchString(tag) {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "Tags may only use letters, numbers and dashes and be at most " + strconv.Itoa(maxTagLength) + " characters", Data: map[string]interface{}{"tag": tag}})
+			return nil, false
+		}
+		result = append(result, tag)
+	}
+	if len(result) > maxCommunityTags {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "Communities can have at most " + strconv.Itoa(maxCommunityTags) + " tags"})
+		return nil, false
+	}
+	return result, true
+}
+
+func discoverPage(limitValue string, offsetValue string) (int, int) {
+	limit := historyPageSize
+	if value, err := strconv.Atoi(limitValue); err == nil && value > 0 && value <= historyMaxPageSize {
+		limit = value
+	}
+	offset := 0
+	if value, err := strconv.Atoi(offsetValue); err == nil && value > 0 {
+		offset = value
+	}
+	return limit, offset
+}
+
+// rankings are precomputed per window onto the community documents, under trends.<days>,
+// so listing communities doesn't go through every member, announcement and event
+var trendingRefresh = struct {
+	sync.Mutex
+	at      map[int]time.Time
+	running map[int]bool
+}{at: map[int]time.Time{}, running: map[int]bool{}}
+
+// make sure the trends for a window of days exist, they are computed while the caller
+// waits the first time and in the background once they are older than configs.TrendingTTL
+func ensureTrends(ctx context.Context, days int) {
+	trendingRefresh.Lock()
+	at, computed := trendingRefresh.at[days]
+	if (computed && time.Since(at) < configs.TrendingTTL()) || trendingRefresh.running[days] {
+		trendingRefresh.Unlock()
+		return
+	}
+	trendingRefresh.running[days] = true
+	trendingRefresh.Unlock()
+
+	refresh := func(ctx context.Context) {
+		err := refreshTrends(ctx, days, time.Now())
+		if err != nil {
+			fmt.Printf("failed to refresh %d day trends: %v\n", days, err)
+		}
+
+		trendingRefresh.Lock()
+		delete(trendingRefresh.running, days)
+		if err == nil {
+			trendingRefresh.at[days] = time.Now()
+		}
+		trendingRefresh.Unlock()
+	}
+	if !computed {
+		refresh(ctx)
+		return
+	}
+	go refresh(context.Background())
+}
+
+// store every community's net joins (joins minus leaves), activity and score over the
+// days before now
+func refreshTrends(ctx context.Context, days int, now time.Time) error {
+	from := primitive.NewDateTimeFromTime(now.AddDate(0, 0, -days))
+	joins := bson.A{
+		bson.M{"$match": bson.M{"$expr": bson.M{"$and": bson.A{
+			bson.M{"$eq": bson.A{"$communityId", "$$id"}},
+			bson.M{"$gte": bson.A{"$at", from}},
+		}}}},
+		bson.M{"$group": bson.M{"_id": nil, "net": bson.M{"$sum": bson.M{"$cond": bson.A{bson.M{"$eq": bson.A{"$type", models.MembershipJoined}}, 1, -1}}}}},
+	}
+
+	cursor, err := communityCollection.Aggregate(ctx, []bson.M{
+		{"$lookup": bson.M{"from": membershipCollection.Name(), "let": bson.M{"id": "$_id"}, "pipeline": joins, "as": "joins"}},
+		{"$project": bson.M{"trend": bson.M{
+			"netJoins":       bson.M{"$ifNull": bson.A{bson.M{"$arrayElemAt": bson.A{"$joins.net", 0}}, 0}},
+			"recentActivity": recentActivity(from, primitive.NewDateTimeFromTime(now)),
+			"computedAt":     primitive.NewDateTimeFromTime(now),
+		}}},
+		{"$set": bson.M{"trend.score": bson.M{"$add": bson.A{bson.M{"$multiply": bson.A{"$trend.netJoins", 2}}, "$trend.recentActivity"}}}},
+		{"$merge": bson.M{
+			"into":           communityCollection.Name(),
+			"on":             "_id",
+			"whenMatched":    bson.A{bson.M{"$set": bson.M{"trends." + strconv.Itoa(days): "$$new.trend"}}},
+			"whenNotMatched": "discard",
+		}},
+	})
+	if err != nil {
+		return err
+	}
+	return cursor.Close(ctx)
+}
+
+// the announcements published and events created between from and to
+func recentActivity(from primitive.DateTime, to primitive.DateTime) bson.M {
+	recentAnnouncements := bson.M{"$filter": bson.M{
+		"input": bson.M{"$ifNull": bson.A{"$announcements", bson.A{}}},
+		"as":    "a",
+		"cond": bson.M{"$and": bson.A{
+			bson.M{"$gte": bson.A{"$$a.date", from}},
+			bson.M{"$lte": bson.A{"$$a.date", to}},
+			bson.M{"$ne": bson.A{"$$a.draft", true}},
+		}},
+	}}
+	// events have no creation time of their own, their ids carry it
+	recentEvents := bson.M{"$filter": bson.M{
+		"input": bson.M{"$ifNull": bson.A{"$events", bson.A{}}},
+		"as":    "e",
+		"cond":  bson.M{"$gte": bson.A{bson.M{"$toDate": "$$e.id"}, from}},
+	}}
+	return bson.M{"$add": bson.A{bson.M{"$size": recentAnnouncements}, bson.M{"$size": recentEvents}}}
+}
+
+// member count plus the precomputed trends of a window, see ensureTrends
+func trendFields(days int) bson.M {
+	trend := "$trends." + strconv.Itoa(days)
+	return bson.M{
+		"memberCount":    bson.M{"$size": bson.M{"$ifNull": bson.A{"$members", bson.A{}}}},
+		"netJoins":       bson.M{"$ifNull": bson.A{trend + ".netJoins", 0}},
+		"recentActivity": bson.M{"$ifNull": bson.A{trend + ".recentActivity", 0}},
+	}
+}
+
+func discoverPipeline(match bson.M, fields bson.M, order bson.D, offset int, limit int) []bson.M {
+	pipeline := []bson.M{
+		{"$match": match},
+		{"$addFields": fields},
+		{"$sort": order},
+	}
+	if offset > 0 {
+		pipeline = append(pipeline, bson.M{"$skip": offset})
+	}
+	return append(pipeline, bson.M{"$limit": limit}, bson.M{"$project": summaryProjection})
+}
+
+func summarize(ctx context.Context, pipeline []bson.M) ([]communitySummary, error) {
+	result := []communitySummary{}
+	cursor, err := communityCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	if err := cursor.All(ctx, &result); err != nil {
+		return nil, err
+	}
+
+	for i, summary := range result {
+		if summary.Avatar != nil {
+			avatar := withImageURLs("community", summary.ID, ImageAvatar, summary.Avatar)
+			result[i].Avatar = &avatar
+		}
+		if summary.Banner != nil {
+			banner := withImageURLs("community", summary.ID, ImageBanner, summary.Banner)
+			result[i].Banner = &banner
+		}
+	}
+	return result, nil
+}
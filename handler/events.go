@@ -0,0 +1,54 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/zillalikestocode/community-api/configs"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// community event types pushed to subscribers
+const (
+	EventAnnouncementCreated     = "announcement.created"
+	EventAnnouncementUpdated     = "announcement.updated"
+	EventAnnouncementDeleted     = "announcement.deleted"
+	EventAnnouncementPinsChanged = "announcement.pins_changed"
+	EventEventCreated            = "event.created"
+	EventEventUpdated            = "event.updated"
+	EventEventDeleted            = "event.deleted"
+	EventEventReminder           = "event.reminder"
+	EventCommentCreated          = "comment.created"
+	EventCommentUpdated          = "comment.updated"
+	EventCommentDeleted          = "comment.deleted"
+	EventCommentModerated        = "comment.moderated"
+	EventPollCreated             = "poll.created"
+	EventPollVoted               = "poll.voted"
+	EventPollClosed              = "poll.closed"
+	EventPollDeleted             = "poll.deleted"
+	EventMention                 = "mention"
+	EventMemberJoined            = "member.joined"
+	EventMemberLeft              = "member.left"
+	EventCommunityUpdated        = "community.updated"
+)
+
+func communityTopic(communityId primitive.ObjectID) string {
+	return "community:" + communityId.Hex()
+}
+
+func userTopic(userId primitive.ObjectID) string {
+	return "user:" + userId.Hex()
+}
+
+// publish a domain event that happened in a community, record notifications for it
+// and send it to subscribed webhooks
+func emit(ctx context.Context, communityId primitive.ObjectID, actorId primitive.ObjectID, eventType string, data map[string]interface{}) {
+	data["communityId"] = communityId
+	data["actorId"] = actorId
+	if _, err := configs.UseBroker().Publish(ctx, communityTopic(communityId), eventType, data); err != nil {
+		fmt.Printf("failed to publish %s: %v\n", eventType, err)
+	}
+
+	go recordNotifications(context.Background(), communityId, actorId, eventType, data)
+	go dispatchWebhooks(context.Background(), communityId, eventType, data)
+}
@@ -0,0 +1,154 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/jwtauth/v5"
+	"github.com/zillalikestocode/community-api/models"
+	"github.com/zillalikestocode/community-api/responses"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// kinds of feed items
+const (
+	FeedAnnouncement = "announcement"
+	FeedPoll         = "poll"
+)
+
+type feedItem struct {
+	Type         string               `json:"type"`
+	Date         primitive.DateTime   `json:"date"`
+	ID           primitive.ObjectID   `json:"id"`
+	Announcement *models.Announcement `json:"announcement,omitempty"`
+	Poll         *models.Poll         `json:"poll,omitempty"`
+}
+
+// position in the feed, newest first with ties broken by id
+type feedKey struct {
+	Date primitive.DateTime
+	ID   primitive.ObjectID
+}
+
+func (k feedKey) before(other feedKey) bool {
+	return k.Date < other.Date || (k.Date == other.Date && bytes.Compare(k.ID[:], other.ID[:]) < 0)
+}
+
+func (k feedKey) String() string {
+	return strconv.FormatInt(int64(k.Date), 10) + "_" + k.ID.Hex()
+}
+
+func parseFeedKey(value string) (feedKey, bool) {
+	date, id, ok := strings.Cut(value, "_")
+	if !ok {
+		return feedKey{}, false
+	}
+	millis, err := strconv.ParseInt(date, 10, 64)
+	if err != nil {
+		return feedKey{}, false
+	}
+	objectId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return feedKey{}, false
+	}
+	return feedKey{Date: primitive.DateTime(millis), ID: objectId}, true
+}
+
+// announcements and polls of a community, newest first. Pinned announcements are returned
+// separately on the first page, pass the returned cursor as ?before= for the next page.
+func (c *Community) Feed(w http.ResponseWriter, r *http.Request) {
+	_, claims, _ := jwtauth.FromContext(r.Context())
+	var community models.Community
+	var polls []models.Poll
+	query := r.URL.Query()
+	userId, _ := primitive.ObjectIDFromHex(claims["id"].(string))
+	communityId, _ := primitive.ObjectIDFromHex(query.Get("communityId"))
+
+	if err := communityCollection.FindOne(context.TODO(), bson.M{"_id": communityId}).Decode(&community); err != nil || !isMember(community, userId) {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusForbidden, Message: "You are not a member of this community"})
+		return
+	}
+	community = renderLegacyContent(community)
+
+	limit := historyPageSize
+	if value, err := strconv.Atoi(query.Get("limit")); err == nil && value > 0 && value <= historyMaxPageSize {
+		limit = value
+	}
+
+	cursor, paged := parseFeedKey(query.Get("before"))
+	if query.Get("before") != "" && !paged {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "before must be a cursor returned by the feed"})
+		return
+	}
+
+	pinned := []feedItem{}
+	items := []feedItem{}
+	for _, announcement := range visibleAnnouncements(community, userId) {
+		item := feedItem{Type: FeedAnnouncement, Date: announcement.Date, ID: announcement.ID, Announcement: &announcement}
+		if announcement.Pinned {
+			pinned = append(pinned, item)
+			continue
+		}
+		if !paged || (feedKey{item.Date, item.ID}).before(cursor) {
+			items = append(items, item)
+		}
+	}
+
+	filter := bson.M{"communityId": community.ID}
+	if paged {
+		filter["$or"] = bson.A{
+			bson.M{"createdAt": bson.M{"$lt": cursor.Date}},
+			bson.M{"createdAt": cursor.Date, "_id": bson.M{"$lt": cursor.ID}},
+		}
+	}
+	found, _ := pollCollection.Find(context.TODO(), filter, options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}, {Key: "_id", Value: -1}}).SetLimit(int64(limit)))
+	if err := found.All(context.TODO(), &polls); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "A server error has occured", Data: map[string]interface{}{"error": err.Error()}})
+		return
+	}
+	for _, poll := range presentPolls(context.TODO(), polls, userId) {
+		items = append(items, feedItem{Type: FeedPoll, Date: poll.CreatedAt, ID: poll.ID, Poll: &poll})
+	}
+
+	slices.SortFunc(items, func(a, b feedItem) int {
+		if (feedKey{b.Date, b.ID}).before(feedKey{a.Date, a.ID}) {
+			return -1
+		}
+		return 1
+	})
+
+	var next interface{}
+	if len(items) > limit {
+		items = items[:limit]
+	}
+	if len(items) == limit {
+		last := items[len(items)-1]
+		next = feedKey{last.Date, last.ID}.String()
+	}
+
+	var creators []*models.Author
+	for _, item := range append(pinned, items...) {
+		if item.Announcement != nil {
+			creators = append(creators, &item.Announcement.Creator)
+		}
+	}
+	withAvatars(context.TODO(), creators...)
+
+	data := map[string]interface{}{"result": items, "before": next}
+	if !paged {
+		data["pinned"] = pinned
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusOK, Message: "Feed fetched successfully", Data: data})
+}
@@ -0,0 +1,398 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/jwtauth/v5"
+	"github.com/zillalikestocode/community-api/blob"
+	"github.com/zillalikestocode/community-api/configs"
+	"github.com/zillalikestocode/community-api/models"
+	"github.com/zillalikestocode/community-api/responses"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type File struct {
+}
+
+var fileCollection *mongo.Collection = configs.GetCollection(configs.ConnectDB(), "files")
+
+// content types accepted for upload, checked against the sniffed type rather than the client's claim
+var allowedFileTypes = []string{"image/png", "image/jpeg", "image/gif", "image/webp", "application/pdf"}
+
+// upload a file as multipart form data with "file" to ?communityId=, pass ?targetType= and
+// ?targetId= to attach it to an announcement or event
+func (f *File) Upload(w http.ResponseWriter, r *http.Request) {
+	_, claims, _ := jwtauth.FromContext(r.Context())
+	var community models.Community
+	userId, _ := primitive.ObjectIDFromHex(claims["id"].(string))
+	maxSize := configs.MaxUploadBytes()
+
+	// where the file goes is in the query so only members get as far as reading the body
+	query := r.URL.Query()
+	communityId, _ := primitive.ObjectIDFromHex(query.Get("communityId"))
+	if err := communityCollection.FindOne(context.TODO(), bson.M{"_id": communityId}).Decode(&community); err != nil || !isMember(community, userId) {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusForbidden, Message: "You are not a member of this community"})
+		return
+	}
+
+	targetType := query.Get("targetType")
+	targetId, _ := primitive.ObjectIDFromHex(query.Get("targetId"))
+	if targetType != "" && !canAttach(w, community, targetType, targetId, userId) {
+		return
+	}
+
+	upload, header, ok := parseUpload(w, r, "file", maxSize)
+	if !ok {
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+	defer upload.Close()
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(upload, head)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "Unable to read the file", Data: map[string]interface{}{"error": err.Error()}})
+		return
+	}
+	head = head[:n]
+	contentType, _, _ := mime.ParseMediaType(http.DetectContentType(head))
+	if !slices.Contains(allowedFileTypes, contentType) {
+		w.WriteHeader(http.StatusUnsupportedMediaType)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusUnsupportedMediaType, Message: "This type of file can't be uploaded", Data: map[string]interface{}{"contentType": contentType, "allowed": allowedFileTypes}})
+		return
+	}
+
+	if !reserveStorage(context.TODO(), community.ID, header.Size) {
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusRequestEntityTooLarge, Message: "The community's storage quota is used up", Data: map[string]interface{}{"quota": configs.CommunityStorageQuota(), "used": community.StorageUsed}})
+		return
+	}
+
+	file := models.File{
+		ID:          primitive.NewObjectID(),
+		CommunityID: community.ID,
+		UploadedBy:  userId,
+		Name:        fileName(header.Filename),
+		ContentType: contentType,
+		Size:        header.Size,
+		CreatedAt:   primitive.NewDateTimeFromTime(time.Now()),
+	}
+	file.Key = community.ID.Hex() + "/" + file.ID.Hex()
+	if targetType != "" {
+		file.TargetType = targetType
+		file.TargetID = &targetId
+	}
+
+	if err := configs.UseBlobStore().Put(context.TODO(), file.Key, io.MultiReader(bytes.NewReader(head), upload), file.Size, file.ContentType); err != nil {
+		releaseStorage(context.TODO(), community.ID, file.Size)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusInternalServerError, Message: "Unable to store the file", Data: map[string]interface{}{"error": err.Error()}})
+		return
+	}
+
+	if _, err := fileCollection.InsertOne(context.TODO(), file); err != nil {
+		configs.UseBlobStore().Delete(context.TODO(), file.Key)
+		releaseStorage(context.TODO(), community.ID, file.Size)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusInternalServerError, Message: "Unable to save the file", Data: map[string]interface{}{"error": err.Error()}})
+		return
+	}
+	if file.TargetID != nil {
+		updateAttachments(context.TODO(), file, "$push")
+	}
+
+	file.URL = signedFileURL(file)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusCreated, Message: "File uploaded", Data: map[string]interface{}{"file": file}})
+}
+
+// list a community's files, or those attached to ?targetId=, with signed download links.
+// Files on announcements the user can't see yet, such as drafts, are left out.
+func (f *File) List(w http.ResponseWriter, r *http.Request) {
+	_, claims, _ := jwtauth.FromContext(r.Context())
+	var community models.Community
+	var result []models.File
+	userId, _ := primitive.ObjectIDFromHex(claims["id"].(string))
+	communityId, _ := primitive.ObjectIDFromHex(r.URL.Query().Get("communityId"))
+
+	if err := communityCollection.FindOne(context.TODO(), bson.M{"_id": communityId}).Decode(&community); err != nil || !isMember(community, userId) {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusForbidden, Message: "You are not a member of this community"})
+		return
+	}
+
+	filter := bson.M{"communityId": community.ID}
+	if targetId, err := primitive.ObjectIDFromHex(r.URL.Query().Get("targetId")); err == nil {
+		filter["targetId"] = targetId
+	}
+	if before, err := primitive.ObjectIDFromHex(r.URL.Query().Get("before")); err == nil {
+		filter["_id"] = bson.M{"$lt": before}
+	}
+	if hidden := hiddenAnnouncementIds(community, userId); len(hidden) > 0 {
+		filter["$nor"] = bson.A{bson.M{"targetId": bson.M{"$in": hidden}}}
+	}
+
+	cursor, _ := fileCollection.Find(context.TODO(), filter, options.Find().SetSort(bson.M{"_id": -1}).SetLimit(historyPageSize))
+	if err := cursor.All(context.TODO(), &result); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "A server error has occured", Data: map[string]interface{}{"error": err.Error()}})
+		return
+	}
+	for i := range result {
+		result[i].URL = signedFileURL(result[i])
+	}
+
+	var next interface{}
+	if len(result) == historyPageSize {
+		next = result[len(result)-1].ID
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusOK, Message: "Files fetched successfully", Data: map[string]interface{}{"result": result, "before": next, "storageUsed": community.StorageUsed, "storageQuota": configs.CommunityStorageQuota()}})
+}
+
+// serve a file from a signed link, no login needed so links work in <img> tags and emails
+func (f *File) Download(w http.ResponseWriter, r *http.Request) {
+	var file models.File
+	query := r.URL.Query()
+	fileId, _ := primitive.ObjectIDFromHex(query.Get("fileId"))
+	expires, _ := strconv.ParseInt(query.Get("expires"), 10, 64)
+
+	if !blob.Verify(configs.FileURLSecret(), fileId.Hex(), expires, query.Get("sig")) {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusForbidden, Message: "This link is invalid or has expired"})
+		return
+	}
+
+	if err := fileCollection.FindOne(context.TODO(), bson.M{"_id": fileId}).Decode(&file); err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusNotFound, Message: "File not found"})
+		return
+	}
+
+	body, err := configs.UseBlobStore().Open(r.Context(), file.Key)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusNotFound, Message: "File not found"})
+		return
+	}
+	defer body.Close()
+
+	disposition := "attachment"
+	if strings.HasPrefix(file.ContentType, "image/") {
+		disposition = "inline"
+	}
+	w.Header().Set("Content-Type", file.ContentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(file.Size, 10))
+	w.Header().Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": file.Name}))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "private, max-age="+strconv.FormatInt(max(expires-time.Now().Unix(), 0), 10))
+	w.WriteHeader(http.StatusOK)
+	io.Copy(w, body)
+}
+
+// delete a file, the uploader and community admins only
+func (f *File) Delete(w http.ResponseWriter, r *http.Request) {
+	_, claims, _ := jwtauth.FromContext(r.Context())
+	var body struct {
+		FileId string `json:"fileId"`
+	}
+	var file models.File
+	var community models.Community
+	json.NewDecoder(r.Body).Decode(&body)
+	userId, _ := primitive.ObjectIDFromHex(claims["id"].(string))
+	fileId, _ := primitive.ObjectIDFromHex(body.FileId)
+
+	if err := fileCollection.FindOne(context.TODO(), bson.M{"_id": fileId}).Decode(&file); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "Unable to find file", Data: map[string]interface{}{"error": err.Error()}})
+		return
+	}
+	communityCollection.FindOne(context.TODO(), bson.M{"_id": file.CommunityID}).Decode(&community)
+	if file.UploadedBy != userId && !isAdmin(community, userId) {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusForbidden, Message: "Only the uploader and admins can delete this file"})
+		return
+	}
+
+	if err := deleteFile(context.TODO(), file); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusInternalServerError, Message: "Unable to delete file", Data: map[string]interface{}{"error": err.Error()}})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusOK, Message: "File deleted"})
+}
+
+// read the multipart form and open the file in field, writes the response when the
+// request is malformed or the file is larger than maxSize
+func parseUpload(w http.ResponseWriter, r *http.Request, field string, maxSize int64) (multipart.File, *multipart.FileHeader, bool) {
+	// leave room for the other form fields and multipart framing
+	r.Body = http.MaxBytesReader(w, r.Body, maxSize+1<<20)
+	if err := r.ParseMultipartForm(1 << 20); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusRequestEntityTooLarge, Message: "Files can be at most " + strconv.FormatInt(maxSize, 10) + " bytes"})
+			return nil, nil, false
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "Please upload the file as multipart form data", Data: map[string]interface{}{"error": err.Error()}})
+		return nil, nil, false
+	}
+
+	upload, header, err := r.FormFile(field)
+	if err != nil {
+		r.MultipartForm.RemoveAll()
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "Please pass a file as " + field, Data: map[string]interface{}{"error": err.Error()}})
+		return nil, nil, false
+	}
+
+	if header.Size <= 0 || header.Size > maxSize {
+		upload.Close()
+		r.MultipartForm.RemoveAll()
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusRequestEntityTooLarge, Message: "Files can be at most " + strconv.FormatInt(maxSize, 10) + " bytes"})
+		return nil, nil, false
+	}
+	return upload, header, true
+}
+
+// check the user may attach files to the target, writes the response when not
+func canAttach(w http.ResponseWriter, community models.Community, targetType string, targetId primitive.ObjectID, userId primitive.ObjectID) bool {
+	allowed := false
+	switch targetType {
+	case models.TargetAnnouncement:
+		announcement, ok := findAnnouncement(community, targetId)
+		allowed = ok && canManageAnnouncement(community, announcement, userId)
+	case models.TargetEvent:
+		allowed = isAdmin(community, userId) && slices.ContainsFunc(community.Events, func(e models.Event) bool { return e.ID == targetId })
+	}
+
+	if !allowed {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusForbidden, Message: "You can't attach files to this " + targetType, Data: map[string]interface{}{"targetTypes": []string{models.TargetAnnouncement, models.TargetEvent}}})
+	}
+	return allowed
+}
+
+// the announcements visibleAnnouncements leaves out for the user, none for admins
+func hiddenAnnouncementIds(community models.Community, userId primitive.ObjectID) []primitive.ObjectID {
+	if isAdmin(community, userId) {
+		return nil
+	}
+	now := time.Now()
+	var hidden []primitive.ObjectID
+	for _, announcement := range community.Announcements {
+		if !announcementLive(announcement, now) {
+			hidden = append(hidden, announcement.ID)
+		}
+	}
+	return hidden
+}
+
+// count size against the community's quota, false when it doesn't fit. The check and
+// increment are one update so concurrent uploads can't overshoot the quota.
+func reserveStorage(ctx context.Context, communityId primitive.ObjectID, size int64) bool {
+	limit := configs.CommunityStorageQuota() - size
+	if limit < 0 {
+		return false
+	}
+	filter := bson.M{"_id": communityId, "$or": bson.A{
+		bson.M{"storageUsed": bson.M{"$exists": false}},
+		bson.M{"storageUsed": bson.M{"$lte": limit}},
+	}}
+	result, err := communityCollection.UpdateOne(ctx, filter, bson.M{"$inc": bson.M{"storageUsed": size}})
+	return err == nil && result.ModifiedCount > 0
+}
+
+func releaseStorage(ctx context.Context, communityId primitive.ObjectID, size int64) {
+	communityCollection.UpdateOne(ctx, bson.M{"_id": communityId}, bson.M{"$inc": bson.M{"storageUsed": -size}})
+}
+
+// add or remove the file id on the announcement or event it is attached to
+func updateAttachments(ctx context.Context, file models.File, operator string) {
+	field := embeddedField(file.TargetType)
+	if field == "" || file.TargetID == nil {
+		return
+	}
+	filters := options.ArrayFilters{Filters: []interface{}{bson.M{"t.id": *file.TargetID}}}
+	communityCollection.UpdateOne(ctx, bson.M{"_id": file.CommunityID}, bson.M{operator: bson.M{field + ".$[t].attachments": file.ID}}, options.Update().SetArrayFilters(filters))
+}
+
+func deleteFile(ctx context.Context, file models.File) error {
+	if err := configs.UseBlobStore().Delete(ctx, file.Key); err != nil {
+		return err
+	}
+	result, err := fileCollection.DeleteOne(ctx, bson.M{"_id": file.ID})
+	if err != nil {
+		return err
+	}
+	// only the request that removed the document gives the space back
+	if result.DeletedCount > 0 {
+		releaseStorage(ctx, file.CommunityID, file.Size)
+		updateAttachments(ctx, file, "$pull")
+	}
+	return nil
+}
+
+// remove the files attached to a deleted announcement or event
+func purgeFiles(ctx context.Context, targetId primitive.ObjectID) error {
+	var files []models.File
+	cursor, err := fileCollection.Find(ctx, bson.M{"targetId": targetId})
+	if err != nil {
+		return err
+	}
+	if err := cursor.All(ctx, &files); err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		if err := deleteFile(ctx, file); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func signedFileURL(file models.File) string {
+	expires := time.Now().Add(configs.FileURLTTL()).Truncate(time.Second)
+	query := url.Values{
+		"fileId":  {file.ID.Hex()},
+		"expires": {strconv.FormatInt(expires.Unix(), 10)},
+		"sig":     {blob.Sign(configs.FileURLSecret(), file.ID.Hex(), expires)},
+	}
+	return configs.AppURL() + "/files/download?" + query.Encode()
+}
+
+// the client's file name without any directories, used for Content-Disposition
+func fileName(name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+	if name == "." || name == "/" || name == "" {
+		return "file"
+	}
+	if len([]rune(name)) > 200 {
+		name = string([]rune(name)[:200])
+	}
+	return name
+}
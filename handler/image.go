@@ -0,0 +1,351 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/jwtauth/v5"
+	"github.com/zillalikestocode/community-api/blob"
+	"github.com/zillalikestocode/community-api/configs"
+	"github.com/zillalikestocode/community-api/imaging"
+	"github.com/zillalikestocode/community-api/models"
+	"github.com/zillalikestocode/community-api/responses"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type Media struct {
+}
+
+const (
+	ImageAvatar = "avatar"
+	ImageBanner = "banner"
+)
+
+// the aspect ratio and thumbnail widths each kind of image is stored at
+var imageShapes = map[string]struct {
+	Aspect float64
+	Widths []int
+}{
+	ImageAvatar: {Aspect: 1, Widths: []int{64, 256, 1024}},
+	ImageBanner: {Aspect: 3, Widths: []int{640, 1280, 1920}},
+}
+
+var imageKeyPattern = regexp.MustCompile(`^images/(user|community)/[0-9a-f]{24}/(avatar|banner)-[0-9a-f]{24}-[0-9]+\.(jpg|png)$`)
+
+// upload the user's avatar as multipart form data with "image"
+func (u *User) UploadAvatar(w http.ResponseWriter, r *http.Request) {
+	uploadUserImage(w, r, ImageAvatar)
+}
+
+// upload the user's banner as multipart form data with "image"
+func (u *User) UploadBanner(w http.ResponseWriter, r *http.Request) {
+	uploadUserImage(w, r, ImageBanner)
+}
+
+// remove the user's avatar
+func (u *User) DeleteAvatar(w http.ResponseWriter, r *http.Request) {
+	deleteUserImage(w, r, ImageAvatar)
+}
+
+// remove the user's banner
+func (u *User) DeleteBanner(w http.ResponseWriter, r *http.Request) {
+	deleteUserImage(w, r, ImageBanner)
+}
+
+// upload a community's avatar as multipart form data with "image" to ?communityId=, admins only
+func (c *Community) UploadAvatar(w http.ResponseWriter, r *http.Request) {
+	uploadCommunityImage(w, r, ImageAvatar)
+}
+
+// upload a community's banner as multipart form data with "image" to ?communityId=, admins only
+func (c *Community) UploadBanner(w http.ResponseWriter, r *http.Request) {
+	uploadCommunityImage(w, r, ImageBanner)
+}
+
+// remove a community's avatar, admins only
+func (c *Community) DeleteAvatar(w http.ResponseWriter, r *http.Request) {
+	deleteCommunityImage(w, r, ImageAvatar)
+}
+
+// remove a community's banner, admins only
+func (c *Community) DeleteBanner(w http.ResponseWriter, r *http.Request) {
+	deleteCommunityImage(w, r, ImageBanner)
+}
+
+// serve a resized avatar or banner, the links change with every upload so they are cached for good
+func (m *Media) Serve(w http.ResponseWriter, r *http.Request) {
+	key := "images/" + chi.URLParam(r, "*")
+	if !imageKeyPattern.MatchString(key) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusNotFound, Message: "Image not found"})
+		return
+	}
+
+	etag := `"` + path.Base(key) + `"`
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	body, err := configs.UseBlobStore().Open(r.Context(), key)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusNotFound, Message: "Image not found"})
+		return
+	}
+	defer body.Close()
+
+	w.Header().Set("Content-Type", imaging.ContentType(path.Ext(key)[1:]))
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	w.Header().Set("ETag", etag)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusOK)
+	io.Copy(w, body)
+}
+
+func uploadUserImage(w http.ResponseWriter, r *http.Request, kind string) {
+	_, claims, _ := jwtauth.FromContext(r.Context())
+	userId, _ := primitive.ObjectIDFromHex(claims["id"].(string))
+
+	upload, _, ok := parseUpload(w, r, "image", configs.MaxUploadBytes())
+	if !ok {
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+	defer upload.Close()
+
+	image, ok := storeImage(w, upload, userCollection, "user", userId, kind)
+	if !ok {
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusOK, Message: strings.ToUpper(kind[:1]) + kind[1:] + " updated", Data: map[string]interface{}{kind: image}})
+}
+
+func deleteUserImage(w http.ResponseWriter, r *http.Request, kind string) {
+	_, claims, _ := jwtauth.FromContext(r.Context())
+	userId, _ := primitive.ObjectIDFromHex(claims["id"].(string))
+
+	if err := removeImage(context.TODO(), userCollection, "user", userId, kind); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusInternalServerError, Message: "Unable to remove " + kind, Data: map[string]interface{}{"error": err.Error()}})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusOK, Message: strings.ToUpper(kind[:1]) + kind[1:] + " removed"})
+}
+
+func uploadCommunityImage(w http.ResponseWriter, r *http.Request, kind string) {
+	_, claims, _ := jwtauth.FromContext(r.Context())
+	userId, _ := primitive.ObjectIDFromHex(claims["id"].(string))
+
+	// the community is in the query so only admins get as far as reading the body
+	r.Body = http.MaxBytesReader(w, r.Body, configs.MaxUploadBytes()+1<<20)
+	communityId, _ := primitive.ObjectIDFromHex(r.URL.Query().Get("communityId"))
+	if !requireCommunityAdmin(w, communityId, userId) {
+		return
+	}
+
+	upload, _, ok := parseUpload(w, r, "image", configs.MaxUploadBytes())
+	if !ok {
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+	defer upload.Close()
+
+	image, ok := storeImage(w, upload, communityCollection, "community", communityId, kind)
+	if !ok {
+		return
+	}
+
+	audit(context.TODO(), communityId, userId, models.AuditUpdate, models.AuditCommunity, communityId, nil, bson.M{kind: image})
+	emit(context.TODO(), communityId, userId, EventCommunityUpdated, map[string]interface{}{kind: image})
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusOK, Message: "Community " + kind + " updated", Data: map[string]interface{}{kind: image}})
+}
+
+func deleteCommunityImage(w http.ResponseWriter, r *http.Request, kind string) {
+	_, claims, _ := jwtauth.FromContext(r.Context())
+	var body struct {
+		CommunityId string `json:"communityId"`
+	}
+	json.NewDecoder(r.Body).Decode(&body)
+	userId, _ := primitive.ObjectIDFromHex(claims["id"].(string))
+	communityId, _ := primitive.ObjectIDFromHex(body.CommunityId)
+
+	if !requireCommunityAdmin(w, communityId, userId) {
+		return
+	}
+
+	if err := removeImage(context.TODO(), communityCollection, "community", communityId, kind); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusInternalServerError, Message: "Unable to remove " + kind, Data: map[string]interface{}{"error": err.Error()}})
+		return
+	}
+
+	audit(context.TODO(), communityId, userId, models.AuditUpdate, models.AuditCommunity, communityId, nil, bson.M{kind: nil})
+	emit(context.TODO(), communityId, userId, EventCommunityUpdated, map[string]interface{}{kind: nil})
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusOK, Message: "Community " + kind + " removed"})
+}
+
+// resize an uploaded image, store the thumbnails and set them as kind on the owner
+// document, writes the response when it fails
+func storeImage(w http.ResponseWriter, upload io.Reader, collection *mongo.Collection, owner string, ownerId primitive.ObjectID, kind string) (models.Image, bool) {
+	shape := imageShapes[kind]
+	result, err := imaging.Resize(upload, shape.Aspect, shape.Widths)
+	if errors.Is(err, imaging.ErrTooLarge) {
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusRequestEntityTooLarge, Message: "Images can be at most " + strconv.Itoa(imaging.MaxPixels) + " pixels"})
+		return models.Image{}, false
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusUnsupportedMediaType)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusUnsupportedMediaType, Message: "Please upload a PNG, JPEG, GIF or WebP image", Data: map[string]interface{}{"error": err.Error()}})
+		return models.Image{}, false
+	}
+
+	image := models.Image{Version: primitive.NewObjectID(), Format: result.Format}
+	for _, thumbnail := range result.Thumbnails {
+		key := imageKey(owner, ownerId, kind, image, thumbnail.Width)
+		if err := configs.UseBlobStore().Put(context.TODO(), key, bytes.NewReader(thumbnail.Data), int64(len(thumbnail.Data)), imaging.ContentType(image.Format)); err != nil {
+			deleteImageFiles(context.TODO(), owner, ownerId, kind, &image)
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusInternalServerError, Message: "Unable to store the image", Data: map[string]interface{}{"error": err.Error()}})
+			return models.Image{}, false
+		}
+		image.Widths = append(image.Widths, thumbnail.Width)
+	}
+
+	var previous bson.M
+	opts := options.FindOneAndUpdate().SetProjection(bson.M{kind: 1})
+	if err := collection.FindOneAndUpdate(context.TODO(), bson.M{"_id": ownerId}, bson.M{"$set": bson.M{kind: image}}, opts).Decode(&previous); err != nil {
+		deleteImageFiles(context.TODO(), owner, ownerId, kind, &image)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusInternalServerError, Message: "Unable to save the image", Data: map[string]interface{}{"error": err.Error()}})
+		return models.Image{}, false
+	}
+	deleteImageFiles(context.TODO(), owner, ownerId, kind, decodeImage(previous[kind]))
+
+	return withImageURLs(owner, ownerId, kind, &image), true
+}
+
+// unset kind on the owner document and delete its thumbnails
+func removeImage(ctx context.Context, collection *mongo.Collection, owner string, ownerId primitive.ObjectID, kind string) error {
+	var previous bson.M
+	opts := options.FindOneAndUpdate().SetProjection(bson.M{kind: 1})
+	err := collection.FindOneAndUpdate(ctx, bson.M{"_id": ownerId}, bson.M{"$unset": bson.M{kind: ""}}, opts).Decode(&previous)
+	if err != nil {
+		return err
+	}
+	deleteImageFiles(ctx, owner, ownerId, kind, decodeImage(previous[kind]))
+	return nil
+}
+
+func decodeImage(value interface{}) *models.Image {
+	doc, ok := value.(bson.M)
+	if !ok {
+		return nil
+	}
+	var image models.Image
+	raw, _ := bson.Marshal(doc)
+	if err := bson.Unmarshal(raw, &image); err != nil {
+		return nil
+	}
+	return &image
+}
+
+func deleteImageFiles(ctx context.Context, owner string, ownerId primitive.ObjectID, kind string, image *models.Image) {
+	if image == nil {
+		return
+	}
+	for _, width := range imageShapes[kind].Widths {
+		err := configs.UseBlobStore().Delete(ctx, imageKey(owner, ownerId, kind, *image, width))
+		if err != nil && !errors.Is(err, blob.ErrNotFound) {
+			fmt.Printf("image cleanup %s/%s: %v\n", ownerId.Hex(), kind, err)
+		}
+	}
+}
+
+func imageKey(owner string, ownerId primitive.ObjectID, kind string, image models.Image, width int) string {
+	return "images/" + owner + "/" + ownerId.Hex() + "/" + kind + "-" + image.Version.Hex() + "-" + strconv.Itoa(width) + "." + image.Format
+}
+
+// fill in the public links of an image
+func withImageURLs(owner string, ownerId primitive.ObjectID, kind string, image *models.Image) models.Image {
+	if image == nil {
+		return models.Image{}
+	}
+	result := *image
+	result.URLs = make(map[string]string, len(image.Widths))
+	for _, width := range image.Widths {
+		result.URLs[strconv.Itoa(width)] = configs.AppURL() + "/media/" + imageKey(owner, ownerId, kind, *image, width)
+	}
+	return result
+}
+
+func userImages(user models.User) models.User {
+	if user.Avatar != nil {
+		avatar := withImageURLs("user", user.ID, ImageAvatar, user.Avatar)
+		user.Avatar = &avatar
+	}
+	if user.Banner != nil {
+		banner := withImageURLs("user", user.ID, ImageBanner, user.Banner)
+		user.Banner = &banner
+	}
+	return user
+}
+
+// withAvatars sets each author's current avatar, looking them all up at once
+func withAvatars(ctx context.Context, authors ...*models.Author) {
+	ids := make([]primitive.ObjectID, 0, len(authors))
+	for _, author := range authors {
+		if !slices.Contains(ids, author.ID) {
+			ids = append(ids, author.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return
+	}
+
+	var users []models.User
+	cursor, err := userCollection.Find(ctx, bson.M{"_id": bson.M{"$in": ids}, "avatar": bson.M{"$exists": true}}, options.Find().SetProjection(bson.M{"avatar": 1}))
+	if err != nil || cursor.All(ctx, &users) != nil {
+		return
+	}
+	avatars := map[primitive.ObjectID]*models.Image{}
+	for _, user := range users {
+		avatars[user.ID] = userImages(user).Avatar
+	}
+	for _, author := range authors {
+		author.Avatar = avatars[author.ID]
+	}
+}
+
+func communityImages(community models.Community) models.Community {
+	if community.Avatar != nil {
+		avatar := withImageURLs("community", community.ID, ImageAvatar, community.Avatar)
+		community.Avatar = &avatar
+	}
+	if community.Banner != nil {
+		banner := withImageURLs("community", community.ID, ImageBanner, community.Banner)
+		community.Banner = &banner
+	}
+	return community
+}
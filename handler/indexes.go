@@ -0,0 +1,132 @@
+package handler
+
+import (
+	"context"
+	"errors"
+
+	"github.com/zillalikestocode/community-api/jobs"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// EnsureIndexes creates the indexes the handlers rely on, it is safe to call on every start.
+// A failure doesn't stop the other indexes from being created, every error is returned.
+func EnsureIndexes(ctx context.Context) error {
+	var errs []error
+	_, err := tokenCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "hash", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "expiresAt", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	errs = append(errs, err)
+
+	_, err = channelCollection.Indexes().CreateOne(ctx, mongo.IndexModel{Keys: bson.D{{Key: "communityId", Value: 1}, {Key: "name", Value: 1}}})
+	errs = append(errs, err)
+
+	_, err = messageCollection.Indexes().CreateOne(ctx, mongo.IndexModel{Keys: bson.D{{Key: "channelId", Value: 1}, {Key: "_id", Value: -1}}})
+	errs = append(errs, err)
+
+	_, err = conversationCollection.Indexes().CreateOne(ctx, mongo.IndexModel{Keys: bson.D{{Key: "participants.id", Value: 1}, {Key: "lastMessageAt", Value: -1}}})
+	errs = append(errs, err)
+
+	_, err = directMessageCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "conversationId", Value: 1}, {Key: "_id", Value: -1}}},
+		{Keys: bson.D{{Key: "expiresAt", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	errs = append(errs, err)
+
+	_, err = notificationCollection.Indexes().CreateOne(ctx, mongo.IndexModel{Keys: bson.D{{Key: "userId", Value: 1}, {Key: "read", Value: 1}, {Key: "_id", Value: -1}}})
+	errs = append(errs, err)
+
+	_, err = preferenceCollection.Indexes().CreateOne(ctx, mongo.IndexModel{Keys: bson.D{{Key: "userId", Value: 1}, {Key: "communityId", Value: 1}}, Options: options.Index().SetUnique(true)})
+	errs = append(errs, err)
+
+	_, err = webhookCollection.Indexes().CreateOne(ctx, mongo.IndexModel{Keys: bson.D{{Key: "communityId", Value: 1}, {Key: "events", Value: 1}}})
+	errs = append(errs, err)
+
+	_, err = deliveryCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "webhookId", Value: 1}, {Key: "_id", Value: -1}}},
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "nextAttemptAt", Value: 1}}},
+	})
+	errs = append(errs, err)
+
+	_, err = reminderCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "eventId", Value: 1}, {Key: "offset", Value: 1}, {Key: "startsAt", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "sendAt", Value: 1}}},
+	})
+	errs = append(errs, err)
+
+	_, err = announcementEditCollection.Indexes().CreateOne(ctx, mongo.IndexModel{Keys: bson.D{{Key: "announcementId", Value: 1}, {Key: "editedAt", Value: -1}}})
+	errs = append(errs, err)
+
+	_, err = commentCollection.Indexes().CreateOne(ctx, mongo.IndexModel{Keys: bson.D{{Key: "targetId", Value: 1}, {Key: "parentId", Value: 1}, {Key: "_id", Value: 1}}})
+	errs = append(errs, err)
+
+	_, err = reactionCollection.Indexes().CreateOne(ctx, mongo.IndexModel{Keys: bson.D{{Key: "targetId", Value: 1}, {Key: "userId", Value: 1}, {Key: "emoji", Value: 1}}, Options: options.Index().SetUnique(true)})
+	errs = append(errs, err)
+
+	_, err = userCollection.Indexes().CreateOne(ctx, mongo.IndexModel{Keys: bson.D{{Key: "username", Value: 1}}, Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{"username": bson.M{"$type": "string"}})})
+	errs = append(errs, err)
+
+	_, err = fileCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "communityId", Value: 1}, {Key: "_id", Value: -1}}},
+		{Keys: bson.D{{Key: "targetId", Value: 1}}},
+	})
+	errs = append(errs, err)
+
+	_, err = communityCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "members.id", Value: 1}}},
+		{Keys: bson.D{{Key: "category", Value: 1}}},
+		{Keys: bson.D{{Key: "tags", Value: 1}}},
+		// nearby event search
+		{Keys: bson.D{{Key: "events.location.point", Value: "2dsphere"}}},
+	})
+	errs = append(errs, err)
+
+	// a ticket can only be checked in once
+	_, err = checkInCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "eventId", Value: 1}, {Key: "userId", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	errs = append(errs, err)
+
+	_, err = pollCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "communityId", Value: 1}, {Key: "_id", Value: -1}},
+	})
+	errs = append(errs, err)
+
+	// one vote per member, changing it replaces the document
+	_, err = pollVoteCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "pollId", Value: 1}, {Key: "userId", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	errs = append(errs, err)
+
+	_, err = membershipCollection.Indexes().CreateOne(ctx, mongo.IndexModel{Keys: bson.D{{Key: "communityId", Value: 1}, {Key: "at", Value: 1}}})
+	errs = append(errs, err)
+
+	// analytics count participation per community over time
+	for collection, field := range map[*mongo.Collection]string{commentCollection: "createdAt", messageCollection: "createdAt", reactionCollection: "createdAt", pollVoteCollection: "createdAt"} {
+		_, err = collection.Indexes().CreateOne(ctx, mongo.IndexModel{Keys: bson.D{{Key: "communityId", Value: 1}, {Key: field, Value: 1}}})
+		errs = append(errs, err)
+	}
+
+	_, err = auditCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "communityId", Value: 1}, {Key: "_id", Value: -1}}},
+		{Keys: bson.D{{Key: "communityId", Value: 1}, {Key: "resourceId", Value: 1}, {Key: "_id", Value: -1}}},
+	})
+	errs = append(errs, err)
+	errs = append(errs, ensureAuditRetention(ctx))
+
+	if queue, ok := jobQueue.(*jobs.MongoQueue); ok {
+		errs = append(errs, queue.EnsureIndexes(ctx))
+	}
+
+	return errors.Join(errs...)
+}
+
+// dropping an index that doesn't exist fails with IndexNotFound, or NamespaceNotFound before the collection exists
+func isIndexNotFound(err error) bool {
+	var cmdErr mongo.CommandError
+	return errors.As(err, &cmdErr) && (cmdErr.Code == 27 || cmdErr.Code == 26)
+}
@@ -0,0 +1,138 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/zillalikestocode/community-api/configs"
+	"github.com/zillalikestocode/community-api/jobs"
+	"github.com/zillalikestocode/community-api/mailer"
+	"github.com/zillalikestocode/community-api/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// background job types
+const (
+	JobSendEmail           = "email.send"
+	JobSendPasswordReset   = "email.password_reset"
+	JobSendVerification    = "email.verify"
+	JobDeliverWebhook      = "webhook.deliver"
+	JobPurgeEvent          = "event.purge"
+	JobGeocodeEvent        = "event.geocode"
+	JobPurgeChannel        = "channel.purge"
+	JobPurgeWebhook        = "webhook.purge"
+	JobPublishAnnouncement = "announcement.publish"
+	JobPurgeAnnouncement   = "announcement.purge"
+	JobClosePoll           = "poll.close"
+	JobPurgePoll           = "poll.purge"
+)
+
+var jobQueue jobs.Queue = configs.UseJobQueue()
+
+// RegisterJobs adds the handlers for every job type to the pool
+func RegisterJobs(pool *jobs.Pool) {
+	pool.Handle(JobSendEmail, runSendEmail)
+	pool.Handle(JobSendPasswordReset, runSendPasswordReset)
+	pool.Handle(JobSendVerification, runSendVerification)
+	pool.Handle(JobDeliverWebhook, runDeliverWebhook)
+	pool.Handle(JobPurgeEvent, runPurgeEvent)
+	pool.Handle(JobGeocodeEvent, runGeocodeEvent)
+	pool.Handle(JobPurgeChannel, runPurgeChannel)
+	pool.Handle(JobPurgeWebhook, runPurgeWebhook)
+	pool.Handle(JobPublishAnnouncement, runPublishAnnouncement)
+	pool.Handle(JobPurgeAnnouncement, runPurgeAnnouncement)
+	pool.Handle(JobClosePoll, runClosePoll)
+	pool.Handle(JobPurgePoll, runPurgePoll)
+}
+
+// enqueue a job, failures are logged since callers have already done their own work
+func enqueue(ctx context.Context, jobType string, payload interface{}, opts ...jobs.Option) {
+	if err := jobQueue.Enqueue(ctx, jobType, payload, opts...); err != nil {
+		fmt.Printf("failed to enqueue %s job: %v\n", jobType, err)
+	}
+}
+
+func queueEmail(ctx context.Context, msg mailer.Message) {
+	enqueue(ctx, JobSendEmail, msg)
+}
+
+func runSendEmail(ctx context.Context, job *jobs.Job) error {
+	var msg mailer.Message
+	if err := job.Decode(&msg); err != nil {
+		return err
+	}
+	return configs.UseMailer().Send(ctx, msg)
+}
+
+func runDeliverWebhook(ctx context.Context, job *jobs.Job) error {
+	var payload struct {
+		DeliveryId primitive.ObjectID `json:"deliveryId"`
+	}
+	var delivery models.WebhookDelivery
+	var hook models.Webhook
+	if err := job.Decode(&payload); err != nil {
+		return err
+	}
+
+	err := deliveryCollection.FindOne(ctx, bson.M{"_id": payload.DeliveryId, "status": models.DeliveryPending}).Decode(&delivery)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		// delivered already or the webhook was deleted
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := webhookCollection.FindOne(ctx, bson.M{"_id": delivery.WebhookID, "active": true}).Decode(&hook); err != nil {
+		_, err = deliveryCollection.UpdateOne(ctx, bson.M{"_id": delivery.ID}, bson.M{"$set": bson.M{"status": models.DeliveryFailed, "error": "webhook is disabled"}, "$unset": bson.M{"nextAttemptAt": ""}})
+		return err
+	}
+
+	attemptDelivery(ctx, hook, delivery)
+	return nil
+}
+
+type purgePayload struct {
+	ID primitive.ObjectID `json:"id"`
+}
+
+// remove everything hanging off a deleted event
+func runPurgeEvent(ctx context.Context, job *jobs.Job) error {
+	var payload purgePayload
+	if err := job.Decode(&payload); err != nil {
+		return err
+	}
+	if _, err := reminderCollection.DeleteMany(ctx, bson.M{"eventId": payload.ID, "status": models.ReminderPending}); err != nil {
+		return err
+	}
+	if _, err := checkInCollection.DeleteMany(ctx, bson.M{"eventId": payload.ID}); err != nil {
+		return err
+	}
+	if err := purgeDiscussion(ctx, payload.ID); err != nil {
+		return err
+	}
+	return purgeFiles(ctx, payload.ID)
+}
+
+// remove the history of a deleted chat channel
+func runPurgeChannel(ctx context.Context, job *jobs.Job) error {
+	var payload purgePayload
+	if err := job.Decode(&payload); err != nil {
+		return err
+	}
+	_, err := messageCollection.DeleteMany(ctx, bson.M{"channelId": payload.ID})
+	return err
+}
+
+// remove the delivery log of a deleted webhook
+func runPurgeWebhook(ctx context.Context, job *jobs.Job) error {
+	var payload purgePayload
+	if err := job.Decode(&payload); err != nil {
+		return err
+	}
+	_, err := deliveryCollection.DeleteMany(ctx, bson.M{"webhookId": payload.ID})
+	return err
+}
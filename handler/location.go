@@ -0,0 +1,240 @@
+package handler
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zillalikestocode/community-api/configs"
+	"github.com/zillalikestocode/community-api/geo"
+	"github.com/zillalikestocode/community-api/jobs"
+	"github.com/zillalikestocode/community-api/models"
+	"github.com/zillalikestocode/community-api/responses"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// communities read per search, each can have several matching events
+const nearbyCommunityLimit = 200
+
+// the location of an event as sent by clients, coordinates are looked up from the address
+// in the background when they are left out
+type locationInput struct {
+	Street     string   `json:"street"`
+	City       string   `json:"city"`
+	Region     string   `json:"region"`
+	PostalCode string   `json:"postalCode"`
+	Country    string   `json:"country"`
+	Latitude   *float64 `json:"latitude"`
+	Longitude  *float64 `json:"longitude"`
+	OnlineURL  string   `json:"onlineUrl"`
+}
+
+func (l locationInput) address() string {
+	parts := []string{}
+	for _, part := range []string{l.Street, l.City, l.Region, l.PostalCode, l.Country} {
+		if part = strings.TrimSpace(part); part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// upcoming events near a point, nearest first and then soonest. Pass ?lat= and ?lng= or an
+// ?address= to geocode, ?radius= in km and ?days= ahead to look.
+func (c *Community) NearbyEvents(w http.ResponseWriter, r *http.Request) {
+	var communities []models.Community
+	query := r.URL.Query()
+
+	search, err := geo.ParseSearch(r.Context(), configs.UseGeocoder(), query)
+	if errors.Is(err, geo.ErrNoLocation) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "Please pass lat and lng, or an address"})
+		return
+	}
+	if errors.Is(err, geo.ErrInvalidRadius) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "radius must be a number of km above 0"})
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "Unable to find that address", Data: map[string]interface{}{"error": err.Error()}})
+		return
+	}
+	limit := historyPageSize
+	if value, err := strconv.Atoi(query.Get("limit")); err == nil && value > 0 && value <= historyMaxPageSize {
+		limit = value
+	}
+
+	now := time.Now()
+	until := search.Until(now)
+	upcoming := bson.M{
+		"date":           bson.M{"$gte": primitive.NewDateTimeFromTime(now), "$lte": primitive.NewDateTimeFromTime(until)},
+		"location.point": bson.M{"$exists": true},
+	}
+	pipeline := []bson.M{
+		search.GeoNear("events.location.point", bson.M{"events": bson.M{"$elemMatch": upcoming}}),
+		{"$limit": nearbyCommunityLimit},
+		{"$project": bson.M{"name": 1, "avatar": 1, "events": 1}},
+	}
+
+	cursor, err := communityCollection.Aggregate(context.TODO(), pipeline)
+	if err == nil {
+		err = cursor.All(context.TODO(), &communities)
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "A server error has occured", Data: map[string]interface{}{"error": err.Error()}})
+		return
+	}
+
+	type nearbyEvent struct {
+		Event         models.Event       `json:"event"`
+		CommunityID   primitive.ObjectID `json:"communityId"`
+		CommunityName string             `json:"communityName"`
+		// meters from the searched point
+		Distance float64 `json:"distance"`
+	}
+
+	// the pipeline finds communities with an event in range, each event is checked here
+	result := []nearbyEvent{}
+	for _, community := range communities {
+		for _, event := range community.Events {
+			point, ok := eventPoint(event)
+			if !ok || event.Date.Time().Before(now) || event.Date.Time().After(until) {
+				continue
+			}
+			distance, within := search.Within(point)
+			if !within {
+				continue
+			}
+			event.Attendees = nil
+			result = append(result, nearbyEvent{Event: event, CommunityID: community.ID, CommunityName: community.Name, Distance: distance})
+		}
+	}
+
+	// distances within 100m of each other count as the same place, then the soonest first
+	slices.SortFunc(result, func(a, b nearbyEvent) int {
+		if order := cmp.Compare(int(a.Distance/100), int(b.Distance/100)); order != 0 {
+			return order
+		}
+		return cmp.Compare(a.Event.Date, b.Event.Date)
+	})
+	if len(result) > limit {
+		result = result[:limit]
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusOK, Message: "Events fetched successfully", Data: map[string]interface{}{"result": result, "near": search.Near, "radius": search.Radius}})
+}
+
+// validate a location, writes the response when it is invalid. Without coordinates the
+// point is left out, see geocodeEvent.
+func resolveLocation(w http.ResponseWriter, input *locationInput) (*models.Location, bool) {
+	location := &models.Location{
+		Street:     strings.TrimSpace(input.Street),
+		City:       strings.TrimSpace(input.City),
+		Region:     strings.TrimSpace(input.Region),
+		PostalCode: strings.TrimSpace(input.PostalCode),
+		Country:    strings.TrimSpace(input.Country),
+		OnlineURL:  strings.TrimSpace(input.OnlineURL),
+	}
+
+	if location.OnlineURL != "" {
+		parsed, err := url.Parse(location.OnlineURL)
+		if err != nil || (parsed.Scheme != "https" && parsed.Scheme != "http") || parsed.Host == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "onlineUrl must be an http or https link"})
+			return nil, false
+		}
+	}
+
+	if (input.Latitude == nil) != (input.Longitude == nil) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "Please pass both latitude and longitude"})
+		return nil, false
+	}
+	if input.Latitude != nil {
+		point := geo.Point{Lat: *input.Latitude, Lng: *input.Longitude}
+		if !point.Valid() {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "latitude must be between -90 and 90 and longitude between -180 and 180"})
+			return nil, false
+		}
+		location.Point = geoPoint(point)
+	}
+	return location, true
+}
+
+type geocodePayload struct {
+	CommunityId primitive.ObjectID `json:"communityId"`
+	EventId     primitive.ObjectID `json:"eventId"`
+}
+
+// look up the coordinates of an event saved with an address but without them. Geocoding
+// services are slow and rate limited, so this runs as a job rather than in the request.
+func geocodeEvent(ctx context.Context, communityId primitive.ObjectID, eventId primitive.ObjectID, location *models.Location) {
+	if location == nil || location.Point != nil || locationAddress(*location) == "" {
+		return
+	}
+	enqueue(ctx, JobGeocodeEvent, geocodePayload{CommunityId: communityId, EventId: eventId})
+}
+
+func runGeocodeEvent(ctx context.Context, job *jobs.Job) error {
+	var payload geocodePayload
+	var community models.Community
+	if err := job.Decode(&payload); err != nil {
+		return err
+	}
+
+	err := communityCollection.FindOne(ctx, bson.M{"_id": payload.CommunityId}, options.FindOne().SetProjection(bson.M{"events": bson.M{"$elemMatch": bson.M{"id": payload.EventId}}})).Decode(&community)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	event, ok := findEvent(community, payload.EventId)
+	if !ok || event.Location == nil || event.Location.Point != nil {
+		return nil
+	}
+
+	// an address that can't be geocoded is still saved, the event just isn't found nearby
+	point, err := configs.UseGeocoder().Geocode(ctx, locationAddress(*event.Location))
+	if errors.Is(err, geo.ErrNotFound) || (err == nil && !point.Valid()) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	// only while the location is still the one that was looked up
+	filters := options.ArrayFilters{Filters: []interface{}{bson.M{"e.id": payload.EventId, "e.location": event.Location}}}
+	_, err = communityCollection.UpdateOne(ctx, bson.M{"_id": payload.CommunityId}, bson.M{"$set": bson.M{"events.$[e].location.point": geoPoint(point)}}, options.Update().SetArrayFilters(filters))
+	return err
+}
+
+func locationAddress(location models.Location) string {
+	return locationInput{Street: location.Street, City: location.City, Region: location.Region, PostalCode: location.PostalCode, Country: location.Country}.address()
+}
+
+func geoPoint(point geo.Point) *models.GeoPoint {
+	return &models.GeoPoint{Type: "Point", Coordinates: []float64{point.Lng, point.Lat}}
+}
+
+func eventPoint(event models.Event) (geo.Point, bool) {
+	if event.Location == nil || event.Location.Point == nil || len(event.Location.Point.Coordinates) != 2 {
+		return geo.Point{}, false
+	}
+	return geo.Point{Lat: event.Location.Point.Coordinates[1], Lng: event.Location.Point.Coordinates[0]}, true
+}
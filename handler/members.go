@@ -0,0 +1,88 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/zillalikestocode/community-api/configs"
+	"github.com/zillalikestocode/community-api/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var membershipCollection *mongo.Collection = configs.GetCollection(configs.ConnectDB(), "membership_changes")
+
+func findMember(community models.Community, userId primitive.ObjectID) (models.Member, bool) {
+	for _, member := range community.Members {
+		if member.ID == userId {
+			return member, true
+		}
+	}
+	return models.Member{}, false
+}
+
+func isMember(community models.Community, userId primitive.ObjectID) bool {
+	_, ok := findMember(community, userId)
+	return ok
+}
+
+func isAdmin(community models.Community, userId primitive.ObjectID) bool {
+	member, ok := findMember(community, userId)
+	return community.Owner == userId || (ok && member.Admin)
+}
+
+// ids of the communities the user is a member of
+func memberCommunityIds(ctx context.Context, userId primitive.ObjectID) ([]primitive.ObjectID, error) {
+	var result []struct {
+		ID primitive.ObjectID `bson:"_id"`
+	}
+
+	cursor, err := communityCollection.Find(ctx, bson.M{"members.id": userId}, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, err
+	}
+	if err := cursor.All(ctx, &result); err != nil {
+		return nil, err
+	}
+
+	ids := make([]primitive.ObjectID, 0, len(result))
+	for _, c := range result {
+		ids = append(ids, c.ID)
+	}
+	return ids, nil
+}
+
+// log a join or leave for analytics, failures only lose a data point so they are logged
+func recordMembership(ctx context.Context, communityId primitive.ObjectID, userId primitive.ObjectID, changeType string) {
+	change := models.MembershipChange{
+		ID:          primitive.NewObjectID(),
+		CommunityID: communityId,
+		UserID:      userId,
+		Type:        changeType,
+		At:          primitive.NewDateTimeFromTime(time.Now()),
+	}
+	if _, err := membershipCollection.InsertOne(ctx, change); err != nil {
+		fmt.Printf("failed to record %s for community %s: %v\n", changeType, communityId.Hex(), err)
+	}
+}
+
+// members from before joinedAt was recorded get the community's creation time, they
+// joined no later than that as far as anyone can tell
+func backfillJoinedAt(ctx context.Context) error {
+	_, err := communityCollection.UpdateMany(ctx,
+		bson.M{"members": bson.M{"$elemMatch": bson.M{"joinedAt": bson.M{"$exists": false}}}},
+		bson.A{bson.M{"$set": bson.M{"members": bson.M{"$map": bson.M{
+			"input": "$members",
+			"as":    "m",
+			"in": bson.M{"$cond": bson.A{
+				bson.M{"$ifNull": bson.A{"$$m.joinedAt", false}},
+				"$$m",
+				bson.M{"$mergeObjects": bson.A{"$$m", bson.M{"joinedAt": bson.M{"$toDate": "$_id"}}}},
+			}},
+		}}}}},
+	)
+	return err
+}
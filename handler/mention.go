@@ -0,0 +1,139 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+
+	"github.com/zillalikestocode/community-api/models"
+	"github.com/zillalikestocode/community-api/responses"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var errBroadcastMention = errors.New("only community admins can mention @everyone or @admins")
+
+// resolve the @names found in content against the community's members. Names that aren't
+// members are dropped, @everyone and @admins are only allowed for admins.
+func resolveMentions(ctx context.Context, community models.Community, authorId primitive.ObjectID, names []string) ([]models.Mention, error) {
+	mentions := []models.Mention{}
+	usernames := []string{}
+	for _, name := range names {
+		switch name {
+		case models.MentionEveryone, models.MentionAdmins:
+			if !isAdmin(community, authorId) {
+				return nil, errBroadcastMention
+			}
+			mentions = append(mentions, models.Mention{Type: name})
+		default:
+			usernames = append(usernames, name)
+		}
+	}
+	if len(usernames) == 0 {
+		return mentions, nil
+	}
+
+	memberIds := []primitive.ObjectID{}
+	for _, member := range community.Members {
+		memberIds = append(memberIds, member.ID)
+	}
+
+	var users []models.User
+	cursor, err := userCollection.Find(ctx, bson.M{"username": bson.M{"$in": usernames}, "_id": bson.M{"$in": memberIds}})
+	if err != nil {
+		return nil, err
+	}
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, err
+	}
+
+	// keep the order they were written in
+	for _, name := range usernames {
+		for _, user := range users {
+			if user.Username == name {
+				userId := user.ID
+				mentions = append(mentions, models.Mention{Type: models.MentionUser, UserID: &userId, Username: user.Username})
+			}
+		}
+	}
+	return mentions, nil
+}
+
+// the members a set of mentions reaches, without the author
+func mentionRecipients(community models.Community, authorId primitive.ObjectID, mentions []models.Mention) []primitive.ObjectID {
+	recipients := []primitive.ObjectID{}
+	add := func(userId primitive.ObjectID) {
+		if userId != authorId && !slices.Contains(recipients, userId) {
+			recipients = append(recipients, userId)
+		}
+	}
+
+	for _, mention := range mentions {
+		switch mention.Type {
+		case models.MentionEveryone:
+			for _, member := range community.Members {
+				add(member.ID)
+			}
+		case models.MentionAdmins:
+			for _, member := range community.Members {
+				if isAdmin(community, member.ID) {
+					add(member.ID)
+				}
+			}
+		case models.MentionUser:
+			if mention.UserID != nil && isMember(community, *mention.UserID) {
+				add(*mention.UserID)
+			}
+		}
+	}
+	return recipients
+}
+
+// the mentions in after that weren't already in before, so edits only notify newly mentioned members
+func addedMentions(before []models.Mention, after []models.Mention) []models.Mention {
+	added := []models.Mention{}
+	for _, mention := range after {
+		if !slices.ContainsFunc(before, func(m models.Mention) bool {
+			return m.Type == mention.Type && m.Username == mention.Username
+		}) {
+			added = append(added, mention)
+		}
+	}
+	return added
+}
+
+// notify the members reached by the mentions
+func notifyMentions(ctx context.Context, community models.Community, authorId primitive.ObjectID, authorName string, mentions []models.Mention, body string, data map[string]interface{}) {
+	recipients := mentionRecipients(community, authorId, mentions)
+	if len(recipients) == 0 {
+		return
+	}
+	data["communityId"] = community.ID
+	notify(ctx, recipients, community.ID, EventMention, authorName+" mentioned you in "+community.Name, excerpt(body, 140), data)
+}
+
+// resolveMentions for request handlers, writes the response when it fails
+func mentionsFor(w http.ResponseWriter, community models.Community, authorId primitive.ObjectID, names []string) ([]models.Mention, bool) {
+	mentions, err := resolveMentions(context.TODO(), community, authorId, names)
+	if errors.Is(err, errBroadcastMention) {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusForbidden, Message: mentionError(err)})
+		return nil, false
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusInternalServerError, Message: mentionError(err), Data: map[string]interface{}{"error": err.Error()}})
+		return nil, false
+	}
+	return mentions, true
+}
+
+// the message to show when mentions can't be resolved
+func mentionError(err error) string {
+	if errors.Is(err, errBroadcastMention) {
+		return "Only community admins can mention @everyone or @admins"
+	}
+	return "Unable to resolve mentions"
+}
@@ -0,0 +1,399 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/jwtauth/v5"
+	"github.com/zillalikestocode/community-api/configs"
+	"github.com/zillalikestocode/community-api/models"
+	"github.com/zillalikestocode/community-api/responses"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type Message struct {
+}
+
+var conversationCollection *mongo.Collection = configs.GetCollection(configs.ConnectDB(), "conversations")
+var directMessageCollection *mongo.Collection = configs.GetCollection(configs.ConnectDB(), "direct_messages")
+
+const maxConversationSize = 8
+
+// start a conversation with users who share a community with the caller,
+// an existing one-to-one conversation is returned instead of creating a second one
+func (m *Message) CreateConversation(w http.ResponseWriter, r *http.Request) {
+	_, claims, _ := jwtauth.FromContext(r.Context())
+	var body struct {
+		ParticipantIds []string `json:"participantIds"`
+		RetentionDays  int      `json:"retentionDays"`
+	}
+	userId, _ := primitive.ObjectIDFromHex(claims["id"].(string))
+
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "Please pass the required details", Data: map[string]interface{}{"error": err.Error()}})
+		return
+	}
+
+	participantIds := []primitive.ObjectID{userId}
+	for _, hex := range body.ParticipantIds {
+		id, err := primitive.ObjectIDFromHex(hex)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "Invalid participant id", Data: map[string]interface{}{"id": hex}})
+			return
+		}
+		if !slices.Contains(participantIds, id) {
+			participantIds = append(participantIds, id)
+		}
+	}
+
+	if len(participantIds) < 2 || len(participantIds) > maxConversationSize || body.RetentionDays < 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "Conversations need between 2 and 8 participants"})
+		return
+	}
+
+	for _, id := range participantIds[1:] {
+		shared, _ := communityCollection.CountDocuments(context.TODO(), bson.M{"members.id": bson.M{"$all": []primitive.ObjectID{userId, id}}})
+		if shared == 0 {
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusForbidden, Message: "You can only message members of your communities", Data: map[string]interface{}{"id": id}})
+			return
+		}
+	}
+
+	if blocked, _ := userCollection.CountDocuments(context.TODO(), bson.M{"_id": bson.M{"$in": participantIds}, "blocked": bson.M{"$in": participantIds}}); blocked > 0 {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusForbidden, Message: "You can't start a conversation with these users"})
+		return
+	}
+
+	if len(participantIds) == 2 {
+		var existing models.Conversation
+		filter := bson.M{"participants": bson.M{"$size": 2}, "participants.id": bson.M{"$all": participantIds}}
+		if err := conversationCollection.FindOne(context.TODO(), filter).Decode(&existing); err == nil {
+			w.WriteHeader(http.StatusOK)
+			json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusOK, Message: "Conversation already exists", Data: map[string]interface{}{"conversation": existing}})
+			return
+		}
+	}
+
+	conversation := models.Conversation{
+		ID:            primitive.NewObjectID(),
+		CreatedBy:     userId,
+		CreatedAt:     primitive.NewDateTimeFromTime(time.Now()),
+		RetentionDays: body.RetentionDays,
+	}
+	for _, id := range participantIds {
+		conversation.Participants = append(conversation.Participants, models.Participant{ID: id})
+	}
+
+	if _, err := conversationCollection.InsertOne(context.TODO(), conversation); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "An error occured while creating the conversation", Data: map[string]interface{}{"error": err.Error()}})
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusCreated, Message: "Conversation created", Data: map[string]interface{}{"conversation": conversation}})
+}
+
+// list the caller's conversations with unread counts, most recent first
+func (m *Message) ListConversations(w http.ResponseWriter, r *http.Request) {
+	_, claims, _ := jwtauth.FromContext(r.Context())
+	var conversations []models.Conversation
+	userId, _ := primitive.ObjectIDFromHex(claims["id"].(string))
+
+	cursor, _ := conversationCollection.Find(context.TODO(), bson.M{"participants.id": userId}, options.Find().SetSort(bson.D{{Key: "lastMessageAt", Value: -1}, {Key: "_id", Value: -1}}))
+	if err := cursor.All(context.TODO(), &conversations); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "A server error has occured", Data: map[string]interface{}{"error": err.Error()}})
+		return
+	}
+
+	unread, err := unreadCounts(context.TODO(), conversations, userId)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusInternalServerError, Message: "A server error has occured", Data: map[string]interface{}{"error": err.Error()}})
+		return
+	}
+
+	result := make([]map[string]interface{}, 0, len(conversations))
+	for _, conversation := range conversations {
+		result = append(result, map[string]interface{}{"conversation": conversation, "unread": unread[conversation.ID]})
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusOK, Message: "Conversations fetched successfully", Data: map[string]interface{}{"result": result}})
+}
+
+// page through a conversation, newest first, pass the last id as ?before= for older messages
+func (m *Message) History(w http.ResponseWriter, r *http.Request) {
+	_, claims, _ := jwtauth.FromContext(r.Context())
+	var result []models.DirectMessage
+	var user models.User
+	userId, _ := primitive.ObjectIDFromHex(claims["id"].(string))
+	conversationId, _ := primitive.ObjectIDFromHex(r.URL.Query().Get("conversationId"))
+
+	conversation, ok := findConversation(context.TODO(), conversationId, userId)
+	if !ok {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusForbidden, Message: "You are not part of this conversation"})
+		return
+	}
+	userCollection.FindOne(context.TODO(), bson.M{"_id": userId}).Decode(&user)
+
+	limit := historyPageSize
+	if value, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && value > 0 && value <= historyMaxPageSize {
+		limit = value
+	}
+
+	// messages from blocked users stay hidden in group conversations
+	filter := bson.M{"conversationId": conversation.ID, "senderId": bson.M{"$nin": append([]primitive.ObjectID{}, user.Blocked...)}}
+	if before, err := primitive.ObjectIDFromHex(r.URL.Query().Get("before")); err == nil {
+		filter["_id"] = bson.M{"$lt": before}
+	}
+	// the ttl monitor only runs every minute, hide expired messages it hasn't got to yet
+	filter["$or"] = bson.A{bson.M{"expiresAt": bson.M{"$exists": false}}, bson.M{"expiresAt": bson.M{"$gt": primitive.NewDateTimeFromTime(time.Now())}}}
+
+	cursor, _ := directMessageCollection.Find(context.TODO(), filter, options.Find().SetSort(bson.M{"_id": -1}).SetLimit(int64(limit)))
+	if err := cursor.All(context.TODO(), &result); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "A server error has occured", Data: map[string]interface{}{"error": err.Error()}})
+		return
+	}
+
+	var next interface{}
+	if len(result) == limit {
+		next = result[len(result)-1].ID
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusOK, Message: "Messages fetched successfully", Data: map[string]interface{}{"result": result, "before": next, "participants": conversation.Participants}})
+}
+
+// send a message to a conversation
+func (m *Message) Send(w http.ResponseWriter, r *http.Request) {
+	_, claims, _ := jwtauth.FromContext(r.Context())
+	var body struct {
+		ConversationId string `json:"conversationId"`
+		Body           string `json:"body"`
+	}
+	userId, _ := primitive.ObjectIDFromHex(claims["id"].(string))
+
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || strings.TrimSpace(body.Body) == "" || len(body.Body) > maxMessageLength {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "Message must be between 1 and 4000 characters"})
+		return
+	}
+
+	conversationId, _ := primitive.ObjectIDFromHex(body.ConversationId)
+	conversation, ok := findConversation(context.TODO(), conversationId, userId)
+	if !ok {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusForbidden, Message: "You are not part of this conversation"})
+		return
+	}
+
+	// a block in either direction closes one-to-one conversations
+	if len(conversation.Participants) == 2 {
+		ids := []primitive.ObjectID{conversation.Participants[0].ID, conversation.Participants[1].ID}
+		if blocked, _ := userCollection.CountDocuments(context.TODO(), bson.M{"_id": bson.M{"$in": ids}, "blocked": bson.M{"$in": ids}}); blocked > 0 {
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusForbidden, Message: "You can't message this user"})
+			return
+		}
+	}
+
+	now := time.Now()
+	message := models.DirectMessage{
+		ID:             primitive.NewObjectID(),
+		ConversationID: conversation.ID,
+		SenderID:       userId,
+		Body:           strings.TrimSpace(body.Body),
+		CreatedAt:      primitive.NewDateTimeFromTime(now),
+	}
+	if conversation.RetentionDays > 0 {
+		expiresAt := primitive.NewDateTimeFromTime(now.AddDate(0, 0, conversation.RetentionDays))
+		message.ExpiresAt = &expiresAt
+	}
+
+	if _, err := directMessageCollection.InsertOne(context.TODO(), message); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "Unable to send message", Data: map[string]interface{}{"error": err.Error()}})
+		return
+	}
+
+	// sending a message also marks the conversation read for the sender
+	conversationCollection.UpdateOne(context.TODO(), bson.M{"_id": conversation.ID, "participants.id": userId}, bson.M{"$set": bson.M{"lastMessageAt": message.CreatedAt, "participants.$.lastReadAt": message.CreatedAt}})
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusCreated, Message: "Message sent", Data: map[string]interface{}{"message": message}})
+}
+
+// mark a conversation read, other participants see it as a read receipt
+func (m *Message) MarkRead(w http.ResponseWriter, r *http.Request) {
+	_, claims, _ := jwtauth.FromContext(r.Context())
+	var body struct {
+		ConversationId string `json:"conversationId"`
+	}
+	json.NewDecoder(r.Body).Decode(&body)
+	userId, _ := primitive.ObjectIDFromHex(claims["id"].(string))
+	conversationId, _ := primitive.ObjectIDFromHex(body.ConversationId)
+
+	now := primitive.NewDateTimeFromTime(time.Now())
+	result, err := conversationCollection.UpdateOne(context.TODO(), bson.M{"_id": conversationId, "participants.id": userId}, bson.M{"$set": bson.M{"participants.$.lastReadAt": now}})
+	if err != nil || result.MatchedCount == 0 {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusForbidden, Message: "You are not part of this conversation"})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusOK, Message: "Conversation marked as read", Data: map[string]interface{}{"lastReadAt": now}})
+}
+
+// change how long messages are kept. Only messages sent after the change are affected,
+// each message keeps the retention it was sent under so no participant can delete
+// history the others already have.
+func (m *Message) SetRetention(w http.ResponseWriter, r *http.Request) {
+	_, claims, _ := jwtauth.FromContext(r.Context())
+	var body struct {
+		ConversationId string `json:"conversationId"`
+		RetentionDays  int    `json:"retentionDays"`
+	}
+	userId, _ := primitive.ObjectIDFromHex(claims["id"].(string))
+
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.RetentionDays < 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "Please pass the required details"})
+		return
+	}
+
+	conversationId, _ := primitive.ObjectIDFromHex(body.ConversationId)
+	result, err := conversationCollection.UpdateOne(context.TODO(), bson.M{"_id": conversationId, "participants.id": userId}, bson.M{"$set": bson.M{"retentionDays": body.RetentionDays}})
+	if err != nil || result.MatchedCount == 0 {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusForbidden, Message: "You are not part of this conversation"})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusOK, Message: "Retention updated"})
+}
+
+// block a user from messaging the caller
+func (m *Message) Block(w http.ResponseWriter, r *http.Request) {
+	updateBlocked(w, r, "$addToSet", "User blocked")
+}
+
+// unblock a user
+func (m *Message) Unblock(w http.ResponseWriter, r *http.Request) {
+	updateBlocked(w, r, "$pull", "User unblocked")
+}
+
+// list the users the caller has blocked
+func (m *Message) Blocked(w http.ResponseWriter, r *http.Request) {
+	_, claims, _ := jwtauth.FromContext(r.Context())
+	var user models.User
+	var blocked []models.User
+	userId, _ := primitive.ObjectIDFromHex(claims["id"].(string))
+
+	userCollection.FindOne(context.TODO(), bson.M{"_id": userId}).Decode(&user)
+	cursor, _ := userCollection.Find(context.TODO(), bson.M{"_id": bson.M{"$in": append([]primitive.ObjectID{}, user.Blocked...)}}, options.Find().SetProjection(bson.M{"name": 1, "avatar": 1}))
+	if err := cursor.All(context.TODO(), &blocked); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "A server error has occured", Data: map[string]interface{}{"error": err.Error()}})
+		return
+	}
+	result := make([]bson.M, 0, len(blocked))
+	for _, blockedUser := range blocked {
+		entry := bson.M{"_id": blockedUser.ID, "name": blockedUser.Name}
+		if avatar := userImages(blockedUser).Avatar; avatar != nil {
+			entry["avatar"] = avatar
+		}
+		result = append(result, entry)
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusOK, Message: "Blocked users fetched successfully", Data: map[string]interface{}{"result": result}})
+}
+
+func updateBlocked(w http.ResponseWriter, r *http.Request, operator string, message string) {
+	_, claims, _ := jwtauth.FromContext(r.Context())
+	var body struct {
+		UserId string `json:"userId"`
+	}
+	userId, _ := primitive.ObjectIDFromHex(claims["id"].(string))
+
+	json.NewDecoder(r.Body).Decode(&body)
+	blockedId, err := primitive.ObjectIDFromHex(body.UserId)
+	if err != nil || blockedId == userId {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "Please pass a valid user id"})
+		return
+	}
+
+	if _, err := userCollection.UpdateOne(context.TODO(), bson.M{"_id": userId}, bson.M{operator: bson.M{"blocked": blockedId}}); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusInternalServerError, Message: "An error has occurred", Data: map[string]interface{}{"error": err.Error()}})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusOK, Message: message})
+}
+
+func findConversation(ctx context.Context, conversationId primitive.ObjectID, userId primitive.ObjectID) (models.Conversation, bool) {
+	var conversation models.Conversation
+	err := conversationCollection.FindOne(ctx, bson.M{"_id": conversationId, "participants.id": userId}).Decode(&conversation)
+	return conversation, err == nil
+}
+
+// unreadCounts counts the messages from others since the user last read each
+// conversation, in one aggregation. Conversations without any are left out.
+func unreadCounts(ctx context.Context, conversations []models.Conversation, userId primitive.ObjectID) (map[primitive.ObjectID]int64, error) {
+	counts := map[primitive.ObjectID]int64{}
+	if len(conversations) == 0 {
+		return counts, nil
+	}
+
+	unread := make(bson.A, 0, len(conversations))
+	for _, conversation := range conversations {
+		filter := bson.M{"conversationId": conversation.ID}
+		for _, participant := range conversation.Participants {
+			if participant.ID == userId && participant.LastReadAt != nil {
+				filter["createdAt"] = bson.M{"$gt": *participant.LastReadAt}
+			}
+		}
+		unread = append(unread, filter)
+	}
+
+	cursor, err := directMessageCollection.Aggregate(ctx, []bson.M{
+		{"$match": bson.M{"$or": unread, "senderId": bson.M{"$ne": userId}}},
+		{"$group": bson.M{"_id": "$conversationId", "count": bson.M{"$sum": 1}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var rows []struct {
+		ID    primitive.ObjectID `bson:"_id"`
+		Count int64              `bson:"count"`
+	}
+	if err := cursor.All(ctx, &rows); err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		counts[row.ID] = row.Count
+	}
+	return counts, nil
+}
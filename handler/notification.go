@@ -0,0 +1,344 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/jwtauth/v5"
+	"github.com/zillalikestocode/community-api/configs"
+	"github.com/zillalikestocode/community-api/models"
+	"github.com/zillalikestocode/community-api/responses"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type Notification struct {
+}
+
+var notificationCollection *mongo.Collection = configs.GetCollection(configs.ConnectDB(), "notifications")
+var preferenceCollection *mongo.Collection = configs.GetCollection(configs.ConnectDB(), "notification_preferences")
+
+const EventNotificationCreated = "notification.created"
+
+// list the caller's notifications, newest first, ?unread=true for unread only
+func (n *Notification) List(w http.ResponseWriter, r *http.Request) {
+	_, claims, _ := jwtauth.FromContext(r.Context())
+	var result []models.Notification
+	userId, _ := primitive.ObjectIDFromHex(claims["id"].(string))
+
+	filter := bson.M{"userId": userId}
+	if r.URL.Query().Get("unread") == "true" {
+		filter["read"] = false
+	}
+	if communityId, err := primitive.ObjectIDFromHex(r.URL.Query().Get("communityId")); err == nil {
+		filter["communityId"] = communityId
+	}
+	if before, err := primitive.ObjectIDFromHex(r.URL.Query().Get("before")); err == nil {
+		filter["_id"] = bson.M{"$lt": before}
+	}
+
+	limit := historyPageSize
+	if value, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && value > 0 && value <= historyMaxPageSize {
+		limit = value
+	}
+
+	cursor, _ := notificationCollection.Find(context.TODO(), filter, options.Find().SetSort(bson.M{"_id": -1}).SetLimit(int64(limit)))
+	if err := cursor.All(context.TODO(), &result); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "A server error has occured", Data: map[string]interface{}{"error": err.Error()}})
+		return
+	}
+
+	var next interface{}
+	if len(result) == limit {
+		next = result[len(result)-1].ID
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusOK, Message: "Notifications fetched successfully", Data: map[string]interface{}{"result": result, "before": next}})
+}
+
+// unread counters, in total and per community
+func (n *Notification) UnreadCount(w http.ResponseWriter, r *http.Request) {
+	_, claims, _ := jwtauth.FromContext(r.Context())
+	var result []struct {
+		CommunityID primitive.ObjectID `json:"communityId" bson:"_id"`
+		Count       int                `json:"count" bson:"count"`
+	}
+	userId, _ := primitive.ObjectIDFromHex(claims["id"].(string))
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"userId": userId, "read": false}}},
+		{{Key: "$group", Value: bson.M{"_id": "$communityId", "count": bson.M{"$sum": 1}}}},
+	}
+	cursor, err := notificationCollection.Aggregate(context.TODO(), pipeline)
+	if err == nil {
+		err = cursor.All(context.TODO(), &result)
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "A server error has occured", Data: map[string]interface{}{"error": err.Error()}})
+		return
+	}
+
+	total := 0
+	for _, c := range result {
+		total += c.Count
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusOK, Message: "Unread count fetched successfully", Data: map[string]interface{}{"total": total, "communities": result}})
+}
+
+// mark specific notifications read
+func (n *Notification) MarkRead(w http.ResponseWriter, r *http.Request) {
+	_, claims, _ := jwtauth.FromContext(r.Context())
+	var body struct {
+		NotificationIds []string `json:"notificationIds"`
+	}
+	userId, _ := primitive.ObjectIDFromHex(claims["id"].(string))
+
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "Please pass the required details", Data: map[string]interface{}{"error": err.Error()}})
+		return
+	}
+
+	ids := []primitive.ObjectID{}
+	for _, hex := range body.NotificationIds {
+		if id, err := primitive.ObjectIDFromHex(hex); err == nil {
+			ids = append(ids, id)
+		}
+	}
+
+	markNotificationsRead(w, bson.M{"userId": userId, "_id": bson.M{"$in": ids}, "read": false})
+}
+
+// mark every notification read, optionally only for one community
+func (n *Notification) MarkAllRead(w http.ResponseWriter, r *http.Request) {
+	_, claims, _ := jwtauth.FromContext(r.Context())
+	var body struct {
+		CommunityId string `json:"communityId"`
+	}
+	json.NewDecoder(r.Body).Decode(&body)
+	userId, _ := primitive.ObjectIDFromHex(claims["id"].(string))
+
+	filter := bson.M{"userId": userId, "read": false}
+	if communityId, err := primitive.ObjectIDFromHex(body.CommunityId); err == nil {
+		filter["communityId"] = communityId
+	}
+
+	markNotificationsRead(w, filter)
+}
+
+func markNotificationsRead(w http.ResponseWriter, filter bson.M) {
+	now := primitive.NewDateTimeFromTime(time.Now())
+	result, err := notificationCollection.UpdateMany(context.TODO(), filter, bson.M{"$set": bson.M{"read": true, "readAt": now}})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusInternalServerError, Message: "Unable to update notifications", Data: map[string]interface{}{"error": err.Error()}})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusOK, Message: "Notifications marked as read", Data: map[string]interface{}{"updated": result.ModifiedCount}})
+}
+
+// get the muted notification types for a community
+func (n *Notification) GetPreferences(w http.ResponseWriter, r *http.Request) {
+	_, claims, _ := jwtauth.FromContext(r.Context())
+	var preference models.NotificationPreference
+	userId, _ := primitive.ObjectIDFromHex(claims["id"].(string))
+	communityId, _ := primitive.ObjectIDFromHex(r.URL.Query().Get("communityId"))
+
+	err := preferenceCollection.FindOne(context.TODO(), bson.M{"userId": userId, "communityId": communityId}).Decode(&preference)
+	if err == mongo.ErrNoDocuments {
+		preference = models.NotificationPreference{UserID: userId, CommunityID: communityId, Muted: []string{}}
+	} else if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "A server error has occured", Data: map[string]interface{}{"error": err.Error()}})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusOK, Message: "Preferences fetched successfully", Data: map[string]interface{}{"preferences": preference, "types": notificationTypes}})
+}
+
+// replace the muted notification types for a community
+func (n *Notification) UpdatePreferences(w http.ResponseWriter, r *http.Request) {
+	_, claims, _ := jwtauth.FromContext(r.Context())
+	var body struct {
+		CommunityId string   `json:"communityId"`
+		Muted       []string `json:"muted"`
+	}
+	userId, _ := primitive.ObjectIDFromHex(claims["id"].(string))
+
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "Please pass the required details", Data: map[string]interface{}{"error": err.Error()}})
+		return
+	}
+
+	muted := []string{}
+	for _, t := range body.Muted {
+		if !slices.Contains(notificationTypes, t) {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "Unknown notification type", Data: map[string]interface{}{"type": t, "types": notificationTypes}})
+			return
+		}
+		muted = append(muted, t)
+	}
+
+	communityId, _ := primitive.ObjectIDFromHex(body.CommunityId)
+	_, err := preferenceCollection.UpdateOne(context.TODO(), bson.M{"userId": userId, "communityId": communityId}, bson.M{"$set": bson.M{"muted": muted}}, options.Update().SetUpsert(true))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusInternalServerError, Message: "Unable to update preferences", Data: map[string]interface{}{"error": err.Error()}})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusOK, Message: "Preferences updated", Data: map[string]interface{}{"muted": muted}})
+}
+
+// notification types users can mute
+var notificationTypes = []string{
+	EventAnnouncementCreated,
+	EventEventCreated,
+	EventEventUpdated,
+	EventEventDeleted,
+	EventMemberJoined,
+	EventEventReminder,
+	EventMention,
+	EventPollCreated,
+	EventPollClosed,
+}
+
+// turn a community event into notifications for the members who should hear about it
+func recordNotifications(ctx context.Context, communityId primitive.ObjectID, actorId primitive.ObjectID, eventType string, data map[string]interface{}) {
+	var community models.Community
+	if err := communityCollection.FindOne(ctx, bson.M{"_id": communityId}).Decode(&community); err != nil {
+		return
+	}
+
+	var title, body string
+	adminsOnly := false
+	switch eventType {
+	case EventAnnouncementCreated:
+		title = "New announcement in " + community.Name
+		if announcement, ok := data["announcement"].(models.Announcement); ok {
+			body = excerpt(announcement.Message, 140)
+		}
+	case EventEventCreated:
+		title = "New event in " + community.Name
+		body = fieldString(data["event"], "name")
+	case EventEventUpdated:
+		title = "Event updated in " + community.Name
+		body = fieldString(data["event"], "name")
+	case EventEventDeleted:
+		title = "An event was cancelled in " + community.Name
+	case EventPollCreated:
+		title = "New poll in " + community.Name
+		if poll, ok := data["poll"].(models.Poll); ok {
+			body = excerpt(poll.Question, 140)
+		}
+	case EventPollClosed:
+		title = "A poll has closed in " + community.Name
+		if poll, ok := data["poll"].(models.Poll); ok {
+			body = excerpt(poll.Question, 140)
+		}
+	case EventMemberJoined:
+		var user models.User
+		userCollection.FindOne(ctx, bson.M{"_id": actorId}).Decode(&user)
+		title = user.Name + " joined " + community.Name
+		adminsOnly = true
+	default:
+		return
+	}
+
+	recipients := []primitive.ObjectID{}
+	for _, member := range community.Members {
+		if member.ID == actorId || (adminsOnly && !isAdmin(community, member.ID)) {
+			continue
+		}
+		recipients = append(recipients, member.ID)
+	}
+
+	notify(ctx, recipients, communityId, eventType, title, body, data)
+}
+
+// store a notification for each user who hasn't muted the type in the community,
+// and push it to their open streams
+func notify(ctx context.Context, userIds []primitive.ObjectID, communityId primitive.ObjectID, notificationType string, title string, body string, data map[string]interface{}) {
+	now := primitive.NewDateTimeFromTime(time.Now())
+	documents := []interface{}{}
+	for _, userId := range unmutedUsers(ctx, userIds, communityId, notificationType) {
+		documents = append(documents, models.Notification{
+			ID:          primitive.NewObjectID(),
+			UserID:      userId,
+			CommunityID: communityId,
+			Type:        notificationType,
+			Title:       title,
+			Body:        body,
+			Data:        data,
+			CreatedAt:   now,
+		})
+	}
+	if len(documents) == 0 {
+		return
+	}
+
+	if _, err := notificationCollection.InsertMany(ctx, documents); err != nil {
+		fmt.Printf("failed to record notifications: %v\n", err)
+		return
+	}
+
+	for _, doc := range documents {
+		notification := doc.(models.Notification)
+		configs.UseBroker().Publish(ctx, userTopic(notification.UserID), EventNotificationCreated, notification)
+	}
+}
+
+// the users who haven't muted the notification type in the community
+func unmutedUsers(ctx context.Context, userIds []primitive.ObjectID, communityId primitive.ObjectID, notificationType string) []primitive.ObjectID {
+	if len(userIds) == 0 {
+		return nil
+	}
+
+	var muted []models.NotificationPreference
+	cursor, err := preferenceCollection.Find(ctx, bson.M{"communityId": communityId, "userId": bson.M{"$in": userIds}, "muted": notificationType})
+	if err == nil {
+		cursor.All(ctx, &muted)
+	}
+
+	result := []primitive.ObjectID{}
+	for _, userId := range userIds {
+		if !slices.ContainsFunc(muted, func(p models.NotificationPreference) bool { return p.UserID == userId }) {
+			result = append(result, userId)
+		}
+	}
+	return result
+}
+
+func fieldString(value interface{}, key string) string {
+	if m, ok := value.(bson.M); ok {
+		s, _ := m[key].(string)
+		return s
+	}
+	return ""
+}
+
+func excerpt(s string, length int) string {
+	runes := []rune(s)
+	if len(runes) <= length {
+		return s
+	}
+	return string(runes[:length]) + "…"
+}
@@ -0,0 +1,515 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-chi/jwtauth/v5"
+	"github.com/zillalikestocode/community-api/configs"
+	"github.com/zillalikestocode/community-api/jobs"
+	"github.com/zillalikestocode/community-api/models"
+	"github.com/zillalikestocode/community-api/responses"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type Poll struct {
+}
+
+var pollCollection *mongo.Collection = configs.GetCollection(configs.ConnectDB(), "polls")
+var pollVoteCollection *mongo.Collection = configs.GetCollection(configs.ConnectDB(), "poll_votes")
+
+const (
+	maxPollOptions        = 10
+	maxPollQuestionLength = 300
+	maxPollOptionLength   = 100
+)
+
+// create a poll in a community, admins only
+func (p *Poll) Create(w http.ResponseWriter, r *http.Request) {
+	_, claims, _ := jwtauth.FromContext(r.Context())
+	var body struct {
+		CommunityId string   `json:"communityId"`
+		Question    string   `json:"question"`
+		Options     []string `json:"options"`
+		Multiple    bool     `json:"multiple"`
+		Anonymous   bool     `json:"anonymous"`
+		HideResults bool     `json:"hideResults"`
+		ClosesAt    string   `json:"closesAt"`
+	}
+	var user models.User
+	userId, _ := primitive.ObjectIDFromHex(claims["id"].(string))
+
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "Please pass the required details", Data: map[string]interface{}{"error": err.Error()}})
+		return
+	}
+
+	communityId, _ := primitive.ObjectIDFromHex(body.CommunityId)
+	if !requireCommunityAdmin(w, communityId, userId) {
+		return
+	}
+
+	body.Question = strings.TrimSpace(body.Question)
+	if body.Question == "" || utf8.RuneCountInString(body.Question) > maxPollQuestionLength {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "Questions must be between 1 and " + strconv.Itoa(maxPollQuestionLength) + " characters"})
+		return
+	}
+
+	pollOptions := []models.PollOption{}
+	for _, text := range body.Options {
+		text = strings.TrimSpace(text)
+		if text == "" || utf8.RuneCountInString(text) > maxPollOptionLength {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "Options must be between 1 and " + strconv.Itoa(maxPollOptionLength) + " characters"})
+			return
+		}
+		// the id is the option's position, votes are counted by it
+		pollOptions = append(pollOptions, models.PollOption{ID: len(pollOptions), Text: text})
+	}
+	if len(pollOptions) < 2 || len(pollOptions) > maxPollOptions {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "Polls need between 2 and " + strconv.Itoa(maxPollOptions) + " options"})
+		return
+	}
+
+	now := time.Now()
+	poll := models.Poll{
+		ID:          primitive.NewObjectID(),
+		CommunityID: communityId,
+		Question:    body.Question,
+		Options:     pollOptions,
+		Multiple:    body.Multiple,
+		Anonymous:   body.Anonymous,
+		HideResults: body.HideResults,
+		CreatedAt:   primitive.NewDateTimeFromTime(now),
+	}
+	if body.ClosesAt != "" {
+		closesAt, err := time.Parse(time.RFC3339, body.ClosesAt)
+		if err != nil || !closesAt.After(now) {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "closesAt must be an RFC3339 time in the future"})
+			return
+		}
+		closes := primitive.NewDateTimeFromTime(closesAt)
+		poll.ClosesAt = &closes
+	}
+
+	userCollection.FindOne(context.TODO(), bson.M{"_id": userId}).Decode(&user)
+	poll.Creator.ID = userId
+	poll.Creator.Name = user.Name
+	poll.Creator.Avatar = userImages(user).Avatar
+
+	if _, err := pollCollection.InsertOne(context.TODO(), poll); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusInternalServerError, Message: "Unable to save poll", Data: map[string]interface{}{"error": err.Error()}})
+		return
+	}
+	if poll.ClosesAt != nil {
+		enqueue(context.TODO(), JobClosePoll, purgePayload{ID: poll.ID}, jobs.Delay(time.Until(poll.ClosesAt.Time())))
+	}
+
+	audit(context.TODO(), communityId, userId, models.AuditCreate, models.AuditPoll, poll.ID, nil, poll)
+	poll = presentPoll(poll, nil, now)
+	emit(context.TODO(), communityId, userId, EventPollCreated, map[string]interface{}{"poll": poll})
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusCreated, Message: "Poll created", Data: map[string]interface{}{"poll": poll}})
+}
+
+// page through a community's polls, newest first, with the caller's votes
+func (p *Poll) List(w http.ResponseWriter, r *http.Request) {
+	_, claims, _ := jwtauth.FromContext(r.Context())
+	var community models.Community
+	var result []models.Poll
+	userId, _ := primitive.ObjectIDFromHex(claims["id"].(string))
+	communityId, _ := primitive.ObjectIDFromHex(r.URL.Query().Get("communityId"))
+
+	if err := communityCollection.FindOne(context.TODO(), bson.M{"_id": communityId}).Decode(&community); err != nil || !isMember(community, userId) {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusForbidden, Message: "You are not a member of this community"})
+		return
+	}
+
+	filter := bson.M{"communityId": communityId}
+	if before, err := primitive.ObjectIDFromHex(r.URL.Query().Get("before")); err == nil {
+		filter["_id"] = bson.M{"$lt": before}
+	}
+
+	cursor, _ := pollCollection.Find(context.TODO(), filter, options.Find().SetSort(bson.M{"_id": -1}).SetLimit(historyPageSize))
+	if err := cursor.All(context.TODO(), &result); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "A server error has occured", Data: map[string]interface{}{"error": err.Error()}})
+		return
+	}
+	result = presentPolls(context.TODO(), result, userId)
+
+	var next interface{}
+	if len(result) == historyPageSize {
+		next = result[len(result)-1].ID
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusOK, Message: "Polls fetched successfully", Data: map[string]interface{}{"result": result, "before": next}})
+}
+
+// vote in an open poll, voting again replaces the earlier choice
+func (p *Poll) Vote(w http.ResponseWriter, r *http.Request) {
+	_, claims, _ := jwtauth.FromContext(r.Context())
+	var body struct {
+		PollId  string `json:"pollId"`
+		Options []int  `json:"options"`
+	}
+	json.NewDecoder(r.Body).Decode(&body)
+	userId, _ := primitive.ObjectIDFromHex(claims["id"].(string))
+	pollId, _ := primitive.ObjectIDFromHex(body.PollId)
+
+	poll, ok := findMemberPoll(w, pollId, userId)
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	if pollClosed(poll, now) {
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusConflict, Message: "This poll has closed"})
+		return
+	}
+
+	choices := slices.Clone(body.Options)
+	slices.Sort(choices)
+	choices = slices.Compact(choices)
+	if len(choices) == 0 || len(choices) != len(body.Options) || (!poll.Multiple && len(choices) > 1) || choices[0] < 0 || choices[len(choices)-1] >= len(poll.Options) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "Please pick one option, or several different ones when the poll allows it", Data: map[string]interface{}{"options": poll.Options, "multiple": poll.Multiple}})
+		return
+	}
+
+	// swap the vote and get the old one back in one step, so the totals are adjusted by
+	// exactly what changed even when the same member votes twice at once. Votes carry the
+	// poll's closing time so a closed poll's votes can't be changed.
+	var previous models.PollVote
+	var err error
+	filter := pollOpen(primitive.NewDateTimeFromTime(now))
+	filter["pollId"], filter["userId"] = poll.ID, userId
+	for attempt := 0; attempt < 2; attempt++ {
+		err = pollVoteCollection.FindOneAndUpdate(context.TODO(),
+			filter,
+			bson.M{
+				"$set":         bson.M{"options": choices, "updatedAt": primitive.NewDateTimeFromTime(now)},
+				"$setOnInsert": bson.M{"_id": primitive.NewObjectID(), "communityId": poll.CommunityID, "closesAt": poll.ClosesAt, "createdAt": primitive.NewDateTimeFromTime(now)},
+			},
+			options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.Before),
+		).Decode(&previous)
+		// a concurrent first vote won the insert, running again updates the vote it created.
+		// When it happens again the existing vote is closed and the insert is the one failing.
+		if !mongo.IsDuplicateKeyError(err) {
+			break
+		}
+	}
+	if mongo.IsDuplicateKeyError(err) {
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusConflict, Message: "This poll has closed"})
+		return
+	}
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusInternalServerError, Message: "Unable to save your vote", Data: map[string]interface{}{"error": err.Error()}})
+		return
+	}
+
+	firstVote := errors.Is(err, mongo.ErrNoDocuments)
+	inc := bson.M{}
+	if firstVote {
+		inc["voterCount"] = 1
+	}
+	for _, option := range previous.Options {
+		if !slices.Contains(choices, option) {
+			inc["options."+strconv.Itoa(option)+".votes"] = -1
+		}
+	}
+	for _, option := range choices {
+		if !slices.Contains(previous.Options, option) {
+			inc["options."+strconv.Itoa(option)+".votes"] = 1
+		}
+	}
+	if len(inc) > 0 {
+		// a first vote copied the closing time from the poll read above, if it closed since
+		// then the vote is taken back
+		tally := pollOpen(primitive.NewDateTimeFromTime(now))
+		tally["_id"] = poll.ID
+		err := pollCollection.FindOneAndUpdate(context.TODO(), tally, bson.M{"$inc": inc}, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&poll)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			if firstVote {
+				pollVoteCollection.DeleteOne(context.TODO(), bson.M{"pollId": poll.ID, "userId": userId})
+			} else {
+				pollVoteCollection.UpdateOne(context.TODO(), bson.M{"pollId": poll.ID, "userId": userId}, bson.M{"$set": bson.M{"options": previous.Options, "updatedAt": previous.UpdatedAt}})
+			}
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusConflict, Message: "This poll has closed"})
+			return
+		}
+	}
+
+	poll = presentPoll(poll, choices, now)
+	publishTally(context.TODO(), poll)
+	withAvatars(context.TODO(), &poll.Creator)
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusOK, Message: "Vote saved", Data: map[string]interface{}{"poll": poll}})
+}
+
+// close a poll early, admins only
+func (p *Poll) Close(w http.ResponseWriter, r *http.Request) {
+	_, claims, _ := jwtauth.FromContext(r.Context())
+	var body struct {
+		PollId string `json:"pollId"`
+	}
+	var poll models.Poll
+	json.NewDecoder(r.Body).Decode(&body)
+	userId, _ := primitive.ObjectIDFromHex(claims["id"].(string))
+	pollId, _ := primitive.ObjectIDFromHex(body.PollId)
+
+	if err := pollCollection.FindOne(context.TODO(), bson.M{"_id": pollId}).Decode(&poll); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "Unable to find poll", Data: map[string]interface{}{"error": err.Error()}})
+		return
+	}
+	if !requireCommunityAdmin(w, poll.CommunityID, userId) {
+		return
+	}
+
+	now := primitive.NewDateTimeFromTime(time.Now())
+	open := pollOpen(now)
+	open["_id"] = poll.ID
+	result, err := pollCollection.UpdateOne(context.TODO(), open, bson.M{"$set": bson.M{"closesAt": now}})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusInternalServerError, Message: "Unable to close poll", Data: map[string]interface{}{"error": err.Error()}})
+		return
+	}
+	if result.ModifiedCount == 0 {
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusConflict, Message: "This poll has already closed"})
+		return
+	}
+	// close the votes too, see Vote
+	if _, err := pollVoteCollection.UpdateMany(context.TODO(), bson.M{"pollId": poll.ID}, bson.M{"$set": bson.M{"closesAt": now}}); err != nil {
+		fmt.Printf("failed to close votes of poll %s: %v\n", poll.ID.Hex(), err)
+	}
+	audit(context.TODO(), poll.CommunityID, userId, models.AuditClose, models.AuditPoll, poll.ID, bson.M{"closesAt": poll.ClosesAt}, bson.M{"closesAt": now})
+	finalizePoll(context.TODO(), poll.ID)
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusOK, Message: "Poll closed"})
+}
+
+// delete a poll and its votes, admins only
+func (p *Poll) Delete(w http.ResponseWriter, r *http.Request) {
+	_, claims, _ := jwtauth.FromContext(r.Context())
+	var body struct {
+		PollId string `json:"pollId"`
+	}
+	var poll models.Poll
+	json.NewDecoder(r.Body).Decode(&body)
+	userId, _ := primitive.ObjectIDFromHex(claims["id"].(string))
+	pollId, _ := primitive.ObjectIDFromHex(body.PollId)
+
+	if err := pollCollection.FindOne(context.TODO(), bson.M{"_id": pollId}).Decode(&poll); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "Unable to find poll", Data: map[string]interface{}{"error": err.Error()}})
+		return
+	}
+	if !requireCommunityAdmin(w, poll.CommunityID, userId) {
+		return
+	}
+
+	if _, err := pollCollection.DeleteOne(context.TODO(), bson.M{"_id": poll.ID}); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusInternalServerError, Message: "Unable to delete poll", Data: map[string]interface{}{"error": err.Error()}})
+		return
+	}
+	audit(context.TODO(), poll.CommunityID, userId, models.AuditDelete, models.AuditPoll, poll.ID, poll, nil)
+	emit(context.TODO(), poll.CommunityID, userId, EventPollDeleted, map[string]interface{}{"pollId": poll.ID})
+	enqueue(context.TODO(), JobPurgePoll, purgePayload{ID: poll.ID})
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusOK, Message: "Poll deleted"})
+}
+
+// who voted for each option of a named poll, once its results can be seen
+func (p *Poll) Voters(w http.ResponseWriter, r *http.Request) {
+	_, claims, _ := jwtauth.FromContext(r.Context())
+	var votes []models.PollVote
+	var users []models.User
+	userId, _ := primitive.ObjectIDFromHex(claims["id"].(string))
+	pollId, _ := primitive.ObjectIDFromHex(r.URL.Query().Get("pollId"))
+
+	poll, ok := findMemberPoll(w, pollId, userId)
+	if !ok {
+		return
+	}
+	if poll.Anonymous || presentPoll(poll, nil, time.Now()).ResultsHidden {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusForbidden, Message: "The voters of this poll can't be seen"})
+		return
+	}
+
+	cursor, _ := pollVoteCollection.Find(context.TODO(), bson.M{"pollId": poll.ID})
+	if err := cursor.All(context.TODO(), &votes); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "A server error has occured", Data: map[string]interface{}{"error": err.Error()}})
+		return
+	}
+
+	userIds := make([]primitive.ObjectID, 0, len(votes))
+	for _, vote := range votes {
+		userIds = append(userIds, vote.UserID)
+	}
+	cursor, _ = userCollection.Find(context.TODO(), bson.M{"_id": bson.M{"$in": userIds}}, options.Find().SetProjection(bson.M{"name": 1, "username": 1, "avatar": 1}))
+	cursor.All(context.TODO(), &users)
+	names := map[primitive.ObjectID]models.User{}
+	for _, user := range users {
+		names[user.ID] = userImages(user)
+	}
+
+	result := map[string][]map[string]interface{}{}
+	for _, option := range poll.Options {
+		result[strconv.Itoa(option.ID)] = []map[string]interface{}{}
+	}
+	for _, vote := range votes {
+		voter := map[string]interface{}{"id": vote.UserID, "name": names[vote.UserID].Name, "username": names[vote.UserID].Username, "avatar": names[vote.UserID].Avatar}
+		for _, option := range vote.Options {
+			key := strconv.Itoa(option)
+			result[key] = append(result[key], voter)
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusOK, Message: "Voters fetched successfully", Data: map[string]interface{}{"result": result}})
+}
+
+// find a poll in a community the user belongs to, writes the response when it can't be found
+func findMemberPoll(w http.ResponseWriter, pollId primitive.ObjectID, userId primitive.ObjectID) (models.Poll, bool) {
+	var poll models.Poll
+	var community models.Community
+	if err := pollCollection.FindOne(context.TODO(), bson.M{"_id": pollId}).Decode(&poll); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "Unable to find poll"})
+		return poll, false
+	}
+	if err := communityCollection.FindOne(context.TODO(), bson.M{"_id": poll.CommunityID}).Decode(&community); err != nil || !isMember(community, userId) {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusForbidden, Message: "You are not a member of this community"})
+		return poll, false
+	}
+	return poll, true
+}
+
+// matches polls and votes that are still open at now, a missing closesAt never closes
+func pollOpen(now primitive.DateTime) bson.M {
+	return bson.M{"$or": bson.A{bson.M{"closesAt": nil}, bson.M{"closesAt": bson.M{"$gt": now}}}}
+}
+
+func pollClosed(poll models.Poll, now time.Time) bool {
+	return poll.ClosesAt != nil && !poll.ClosesAt.Time().After(now)
+}
+
+// fill in the fields that depend on the time and the caller, totals are zeroed while the
+// results are hidden
+func presentPoll(poll models.Poll, myVote []int, now time.Time) models.Poll {
+	poll.Closed = pollClosed(poll, now)
+	poll.MyVote = myVote
+	if poll.HideResults && !poll.Closed {
+		poll.ResultsHidden = true
+		pollOptions := make([]models.PollOption, len(poll.Options))
+		for i, option := range poll.Options {
+			option.Votes = 0
+			pollOptions[i] = option
+		}
+		poll.Options = pollOptions
+	}
+	return poll
+}
+
+// present a page of polls with the user's votes in them
+func presentPolls(ctx context.Context, polls []models.Poll, userId primitive.ObjectID) []models.Poll {
+	var votes []models.PollVote
+	pollIds := make([]primitive.ObjectID, 0, len(polls))
+	for _, poll := range polls {
+		pollIds = append(pollIds, poll.ID)
+	}
+
+	myVotes := map[primitive.ObjectID][]int{}
+	if cursor, err := pollVoteCollection.Find(ctx, bson.M{"userId": userId, "pollId": bson.M{"$in": pollIds}}); err == nil && cursor.All(ctx, &votes) == nil {
+		for _, vote := range votes {
+			myVotes[vote.PollID] = vote.Options
+		}
+	}
+
+	now := time.Now()
+	creators := make([]*models.Author, 0, len(polls))
+	for i := range polls {
+		polls[i] = presentPoll(polls[i], myVotes[polls[i].ID], now)
+		creators = append(creators, &polls[i].Creator)
+	}
+	withAvatars(ctx, creators...)
+	return polls
+}
+
+// push the running totals to the community's subscribers, votes don't notify anyone or go to webhooks
+func publishTally(ctx context.Context, poll models.Poll) {
+	data := map[string]interface{}{"communityId": poll.CommunityID, "pollId": poll.ID, "voterCount": poll.VoterCount}
+	if !poll.ResultsHidden {
+		data["options"] = poll.Options
+	}
+	configs.UseBroker().Publish(ctx, communityTopic(poll.CommunityID), EventPollVoted, data)
+}
+
+func runClosePoll(ctx context.Context, job *jobs.Job) error {
+	var payload purgePayload
+	if err := job.Decode(&payload); err != nil {
+		return err
+	}
+	return finalizePoll(ctx, payload.ID)
+}
+
+// send poll.closed with the final results once the poll has closed. The finalized flag is
+// set atomically so the manual close and the scheduled job don't both send it.
+func finalizePoll(ctx context.Context, pollId primitive.ObjectID) error {
+	var poll models.Poll
+	due := bson.M{"_id": pollId, "finalized": bson.M{"$ne": true}, "closesAt": bson.M{"$lte": primitive.NewDateTimeFromTime(time.Now())}}
+	err := pollCollection.FindOneAndUpdate(ctx, due, bson.M{"$set": bson.M{"finalized": true}}, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&poll)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		// deleted, already finalized, or still open
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	emit(ctx, poll.CommunityID, poll.Creator.ID, EventPollClosed, map[string]interface{}{"poll": presentPoll(poll, nil, time.Now())})
+	return nil
+}
+
+// remove the votes of a deleted poll
+func runPurgePoll(ctx context.Context, job *jobs.Job) error {
+	var payload purgePayload
+	if err := job.Decode(&payload); err != nil {
+		return err
+	}
+	_, err := pollVoteCollection.DeleteMany(ctx, bson.M{"pollId": payload.ID})
+	return err
+}
@@ -0,0 +1,160 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/zillalikestocode/community-api/configs"
+	"github.com/zillalikestocode/community-api/mailer"
+	"github.com/zillalikestocode/community-api/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var reminderCollection *mongo.Collection = configs.GetCollection(configs.ConnectDB(), "reminders")
+
+const (
+	reminderPoll  = 30 * time.Second
+	reminderLease = 5 * time.Minute
+)
+
+// (re)schedule the reminders for an event starting at start. Reminders already sent for
+// this start time are kept so they don't go out twice, moving the event to another time
+// schedules every offset again.
+func scheduleReminders(ctx context.Context, communityId primitive.ObjectID, eventId primitive.ObjectID, start time.Time) {
+	if _, err := reminderCollection.DeleteMany(ctx, bson.M{"eventId": eventId, "status": models.ReminderPending}); err != nil {
+		fmt.Printf("failed to clear reminders: %v\n", err)
+		return
+	}
+
+	for _, offset := range configs.ReminderOffsets() {
+		sendAt := start.Add(-offset)
+		if sendAt.Before(time.Now()) {
+			continue
+		}
+
+		reminder := models.Reminder{
+			ID:          primitive.NewObjectID(),
+			CommunityID: communityId,
+			EventID:     eventId,
+			Offset:      offset.String(),
+			StartsAt:    primitive.NewDateTimeFromTime(start),
+			SendAt:      primitive.NewDateTimeFromTime(sendAt),
+			Status:      models.ReminderPending,
+		}
+		// the unique index on eventId, offset and startsAt rejects offsets that were already sent
+		if _, err := reminderCollection.InsertOne(ctx, reminder); err != nil && !mongo.IsDuplicateKeyError(err) {
+			fmt.Printf("failed to schedule reminder: %v\n", err)
+		}
+	}
+}
+
+// RunReminderScheduler sends due event reminders until ctx is done. Each reminder is leased
+// before sending so running several instances doesn't send duplicates.
+func RunReminderScheduler(ctx context.Context) {
+	ticker := time.NewTicker(reminderPoll)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		SendDueReminders(ctx)
+	}
+}
+
+// SendDueReminders sends every reminder that is due and returns how many it handled
+func SendDueReminders(ctx context.Context) int {
+	handled := 0
+	for ctx.Err() == nil {
+		reminder, ok := claimReminder(ctx)
+		if !ok {
+			break
+		}
+		status := sendReminder(ctx, reminder)
+
+		now := primitive.NewDateTimeFromTime(time.Now())
+		reminderCollection.UpdateOne(ctx, bson.M{"_id": reminder.ID, "lockedUntil": reminder.LockedUntil}, bson.M{"$set": bson.M{"status": status, "sentAt": now}, "$unset": bson.M{"lockedUntil": ""}})
+		handled++
+	}
+	return handled
+}
+
+func claimReminder(ctx context.Context) (models.Reminder, bool) {
+	var reminder models.Reminder
+	now := time.Now()
+	lease := primitive.NewDateTimeFromTime(now.Add(reminderLease))
+
+	filter := bson.M{
+		"status": models.ReminderPending,
+		"sendAt": bson.M{"$lte": primitive.NewDateTimeFromTime(now)},
+		"$or": bson.A{
+			bson.M{"lockedUntil": bson.M{"$exists": false}},
+			bson.M{"lockedUntil": bson.M{"$lt": primitive.NewDateTimeFromTime(now)}},
+		},
+	}
+	err := reminderCollection.FindOneAndUpdate(ctx, filter, bson.M{"$set": bson.M{"lockedUntil": lease}}, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&reminder)
+
+	return reminder, err == nil
+}
+
+// notify and email the event's audience, returns the status to record
+func sendReminder(ctx context.Context, reminder models.Reminder) string {
+	var community models.Community
+	if err := communityCollection.FindOne(ctx, bson.M{"_id": reminder.CommunityID}).Decode(&community); err != nil {
+		return models.ReminderSkipped
+	}
+
+	var event models.Event
+	found := false
+	for _, e := range community.Events {
+		if e.ID == reminder.EventID {
+			event, found = e, true
+		}
+	}
+	// the event was removed, moved since this was scheduled or has already started, e.g. after downtime
+	if !found || reminder.StartsAt != event.Date || event.Date.Time().Before(time.Now()) {
+		return models.ReminderSkipped
+	}
+
+	recipients := event.Attendees
+	if event.ReminderAudience != models.ReminderAudienceRSVP {
+		recipients = nil
+		for _, member := range community.Members {
+			recipients = append(recipients, member.ID)
+		}
+	}
+	recipients = unmutedUsers(ctx, recipients, community.ID, EventEventReminder)
+
+	startsIn := time.Until(event.Date.Time()).Round(time.Minute).String()
+	notify(ctx, recipients, community.ID, EventEventReminder, "Reminder: "+event.Name+" starts in "+startsIn, event.Address, map[string]interface{}{"eventId": event.ID, "communityId": community.ID})
+
+	var users []models.User
+	cursor, err := userCollection.Find(ctx, bson.M{"_id": bson.M{"$in": recipients}})
+	if err == nil {
+		cursor.All(ctx, &users)
+	}
+	for _, user := range users {
+		msg, err := mailer.Render("event_reminder", user.Email, map[string]interface{}{
+			"Name":      user.Name,
+			"Event":     event.Name,
+			"Community": community.Name,
+			"StartsIn":  startsIn,
+			"Date":      event.Date.Time().Format(time.RFC1123),
+			"Address":   event.Address,
+		})
+		if err != nil {
+			fmt.Printf("failed to render reminder for %s: %v\n", user.ID.Hex(), err)
+			continue
+		}
+		queueEmail(ctx, msg)
+	}
+
+	return models.ReminderSent
+}
@@ -0,0 +1,95 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+
+	"github.com/go-chi/jwtauth/v5"
+	"github.com/zillalikestocode/community-api/models"
+	"github.com/zillalikestocode/community-api/responses"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type sessionCacheKey struct{}
+
+// the session versions looked up for one request, keyed by user id, missing users are -1
+type sessionCache struct {
+	mu       sync.Mutex
+	versions map[primitive.ObjectID]int
+}
+
+// CacheSessions lets the rate limiters and RequireSession share one user lookup per
+// request, it must run before any of them
+func CacheSessions(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cache := &sessionCache{versions: map[primitive.ObjectID]int{}}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), sessionCacheKey{}, cache)))
+	})
+}
+
+// RequireSession rejects tokens issued before the user's sessions were revoked,
+// it must run after jwtauth.Authenticator
+func RequireSession(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, claims, _ := jwtauth.FromContext(r.Context())
+
+		if !ActiveSession(r.Context(), claims) {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusUnauthorized, Message: "Session has expired, please log in again"})
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ActiveSession reports whether the claims are for a completed login whose sessions
+// haven't been revoked since
+func ActiveSession(ctx context.Context, claims map[string]interface{}) bool {
+	// challenge tokens from a pending 2fa login are not sessions
+	if _, pending := claims["purpose"]; pending {
+		return false
+	}
+
+	id, _ := claims["id"].(string)
+	userId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return false
+	}
+	current := sessionVersion(ctx, userId)
+	if current < 0 {
+		return false
+	}
+
+	version, _ := claims["sv"].(float64)
+	return int(version) == current
+}
+
+// sessionVersion returns the user's session version, or -1 when the user doesn't exist,
+// going through the request's cache when CacheSessions installed one
+func sessionVersion(ctx context.Context, userId primitive.ObjectID) int {
+	cache, _ := ctx.Value(sessionCacheKey{}).(*sessionCache)
+	if cache != nil {
+		cache.mu.Lock()
+		defer cache.mu.Unlock()
+		if version, ok := cache.versions[userId]; ok {
+			return version
+		}
+	}
+
+	version := -1
+	var user models.User
+	err := userCollection.FindOne(ctx, bson.M{"_id": userId}).Decode(&user)
+	if err == nil {
+		version = user.SessionVersion
+	}
+	// a failed lookup is tried again rather than remembered
+	if cache != nil && (err == nil || err == mongo.ErrNoDocuments) {
+		cache.versions[userId] = version
+	}
+	return version
+}
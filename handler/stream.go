@@ -0,0 +1,103 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/jwtauth/v5"
+	"github.com/zillalikestocode/community-api/configs"
+	"github.com/zillalikestocode/community-api/models"
+	"github.com/zillalikestocode/community-api/responses"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const streamHeartbeat = 25 * time.Second
+
+// stream a single community's events over server-sent events
+func (c *Community) Stream(w http.ResponseWriter, r *http.Request) {
+	_, claims, _ := jwtauth.FromContext(r.Context())
+	var community models.Community
+	userId, _ := primitive.ObjectIDFromHex(claims["id"].(string))
+	communityId, _ := primitive.ObjectIDFromHex(r.URL.Query().Get("communityId"))
+
+	if err := communityCollection.FindOne(context.TODO(), bson.M{"_id": communityId}).Decode(&community); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "Unable to find community", Data: map[string]interface{}{"error": err.Error(), "id": communityId}})
+		return
+	}
+
+	if !isMember(community, userId) {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusForbidden, Message: "You are not a member of this community"})
+		return
+	}
+
+	serveStream(w, r, []string{communityTopic(communityId)})
+}
+
+// stream events from every community the user belongs to, along with their notifications
+func (c *Community) StreamAll(w http.ResponseWriter, r *http.Request) {
+	_, claims, _ := jwtauth.FromContext(r.Context())
+	userId, _ := primitive.ObjectIDFromHex(claims["id"].(string))
+
+	communityIds, err := memberCommunityIds(context.TODO(), userId)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusInternalServerError, Message: "A server error has occured", Data: map[string]interface{}{"error": err.Error()}})
+		return
+	}
+
+	topics := []string{userTopic(userId)}
+	for _, id := range communityIds {
+		topics = append(topics, communityTopic(id))
+	}
+
+	serveStream(w, r, topics)
+}
+
+func serveStream(w http.ResponseWriter, r *http.Request, topics []string) {
+	lastId := r.Header.Get("Last-Event-ID")
+	if lastId == "" {
+		lastId = r.URL.Query().Get("lastEventId")
+	}
+
+	messages, err := configs.UseBroker().Subscribe(r.Context(), topics, lastId)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusInternalServerError, Message: "Unable to subscribe", Data: map[string]interface{}{"error": err.Error()}})
+		return
+	}
+
+	controller := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	controller.Flush()
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": ping\n\n")
+		case msg, ok := <-messages:
+			if !ok {
+				return
+			}
+			data, _ := json.Marshal(msg.Data)
+			fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", msg.ID, msg.Type, data)
+		}
+		if err := controller.Flush(); err != nil {
+			return
+		}
+	}
+}
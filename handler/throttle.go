@@ -0,0 +1,50 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/zillalikestocode/community-api/configs"
+	"github.com/zillalikestocode/community-api/responses"
+	"github.com/zillalikestocode/community-api/throttle"
+)
+
+var (
+	// failed logins per account, locks the account for 15 minutes after 10 failures
+	loginAccountGuard = &throttle.Guard{Store: configs.UseThrottleStore(), FreeAttempts: 3, BaseDelay: time.Second, MaxDelay: time.Minute, MaxFailures: 10, Lockout: 15 * time.Minute, Window: time.Hour}
+	// failed logins per ip, higher limits since many users can share an address
+	loginIPGuard = &throttle.Guard{Store: configs.UseThrottleStore(), FreeAttempts: 10, BaseDelay: time.Second, MaxDelay: time.Minute, MaxFailures: 50, Lockout: 15 * time.Minute, Window: time.Hour}
+	// failed 2fa codes per account
+	twoFactorGuard = &throttle.Guard{Store: configs.UseThrottleStore(), FreeAttempts: 2, BaseDelay: 2 * time.Second, MaxDelay: time.Minute, MaxFailures: 5, Lockout: 15 * time.Minute, Window: time.Hour}
+	// account creations per ip
+	signupGuard = &throttle.Guard{Store: configs.UseThrottleStore(), MaxFailures: 10, Lockout: time.Hour, Window: time.Hour}
+)
+
+// check the guard for the keys, writes a 429 response and returns true when the caller must wait
+func throttled(w http.ResponseWriter, r *http.Request, guard *throttle.Guard, keys ...string) bool {
+	wait, err := guard.Check(r.Context(), keys...)
+	if err != nil {
+		fmt.Printf("throttle check failed: %v\n", err)
+		return false
+	}
+	if wait <= 0 {
+		return false
+	}
+
+	w.Header().Set("Retry-After", fmt.Sprint(int(math.Ceil(wait.Seconds()))))
+	w.WriteHeader(http.StatusTooManyRequests)
+	json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusTooManyRequests, Message: "Too many attempts, please try again later"})
+	return true
+}
+
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
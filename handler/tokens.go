@@ -0,0 +1,75 @@
+package handler
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/zillalikestocode/community-api/configs"
+	"github.com/zillalikestocode/community-api/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var tokenCollection *mongo.Collection = configs.GetCollection(configs.ConnectDB(), "tokens")
+
+var errInvalidToken = errors.New("token is invalid or has expired")
+
+func hashToken(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
+
+// issue a new token for the user, any unused token with the same purpose is revoked.
+// revoked tokens are kept until they expire so resends can be counted
+func issueUserToken(ctx context.Context, userId primitive.ObjectID, purpose string, ttl time.Duration) (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	raw := base64.RawURLEncoding.EncodeToString(buf)
+
+	now := time.Now()
+	if _, err := tokenCollection.UpdateMany(ctx, bson.M{"userId": userId, "purpose": purpose, "usedAt": bson.M{"$exists": false}}, bson.M{"$set": bson.M{"usedAt": primitive.NewDateTimeFromTime(now)}}); err != nil {
+		return "", err
+	}
+
+	token := models.UserToken{
+		ID:        primitive.NewObjectID(),
+		UserID:    userId,
+		Purpose:   purpose,
+		Hash:      hashToken(raw),
+		CreatedAt: primitive.NewDateTimeFromTime(now),
+		ExpiresAt: primitive.NewDateTimeFromTime(now.Add(ttl)),
+	}
+	if _, err := tokenCollection.InsertOne(ctx, token); err != nil {
+		return "", err
+	}
+
+	return raw, nil
+}
+
+// mark the token as used and return it, fails if it was already used or expired
+func consumeUserToken(ctx context.Context, raw string, purpose string) (models.UserToken, error) {
+	var token models.UserToken
+	now := primitive.NewDateTimeFromTime(time.Now())
+
+	filter := bson.M{
+		"hash":      hashToken(raw),
+		"purpose":   purpose,
+		"usedAt":    bson.M{"$exists": false},
+		"expiresAt": bson.M{"$gt": now},
+	}
+	err := tokenCollection.FindOneAndUpdate(ctx, filter, bson.M{"$set": bson.M{"usedAt": now}}, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&token)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return token, errInvalidToken
+	}
+
+	return token, err
+}
@@ -0,0 +1,255 @@
+package handler
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/jwtauth/v5"
+	"github.com/zillalikestocode/community-api/configs"
+	"github.com/zillalikestocode/community-api/models"
+	"github.com/zillalikestocode/community-api/responses"
+	"github.com/zillalikestocode/community-api/totp"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	totpIssuer        = "Community API"
+	challengePurpose  = "2fa"
+	challengeTTL      = 5 * time.Minute
+	recoveryCodeCount = 10
+)
+
+// start 2fa enrollment, the secret is only active once confirmed with a code
+func (u *User) EnrollTwoFactor(w http.ResponseWriter, r *http.Request) {
+	_, claims, _ := jwtauth.FromContext(r.Context())
+	var user models.User
+	userId, _ := primitive.ObjectIDFromHex(claims["id"].(string))
+
+	if err := userCollection.FindOne(context.TODO(), bson.M{"_id": userId}).Decode(&user); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusInternalServerError, Message: "An error has occurred", Data: map[string]interface{}{"error": err.Error()}})
+		return
+	}
+
+	if user.TwoFactorEnabled {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "Two-factor authentication is already enabled"})
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusInternalServerError, Message: "An error has occurred", Data: map[string]interface{}{"error": err.Error()}})
+		return
+	}
+
+	if _, err := userCollection.UpdateOne(context.TODO(), bson.M{"_id": userId}, bson.M{"$set": bson.M{"twoFactorPending": secret}}); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusInternalServerError, Message: "Unable to start enrollment", Data: map[string]interface{}{"error": err.Error()}})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusOK, Message: "Scan the code with your authenticator app and confirm", Data: map[string]interface{}{"secret": secret, "uri": totp.URI(totpIssuer, user.Email, secret)}})
+}
+
+// confirm enrollment with a code, returns the recovery codes once
+func (u *User) ConfirmTwoFactor(w http.ResponseWriter, r *http.Request) {
+	_, claims, _ := jwtauth.FromContext(r.Context())
+	var body struct {
+		Code string `json:"code"`
+	}
+	var user models.User
+	userId, _ := primitive.ObjectIDFromHex(claims["id"].(string))
+
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "Please pass the required details", Data: map[string]interface{}{"error": err.Error()}})
+		return
+	}
+
+	if err := userCollection.FindOne(context.TODO(), bson.M{"_id": userId}).Decode(&user); err != nil || user.TwoFactorPending == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "No two-factor enrollment in progress"})
+		return
+	}
+
+	step, ok := totp.Validate(user.TwoFactorPending, body.Code, time.Now())
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "Invalid code"})
+		return
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusInternalServerError, Message: "An error has occurred", Data: map[string]interface{}{"error": err.Error()}})
+		return
+	}
+
+	update := bson.M{
+		"$set":   bson.M{"twoFactorEnabled": true, "twoFactorSecret": user.TwoFactorPending, "twoFactorLastStep": step, "recoveryCodes": hashes},
+		"$unset": bson.M{"twoFactorPending": ""},
+	}
+	if _, err := userCollection.UpdateOne(context.TODO(), bson.M{"_id": userId}, update); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusInternalServerError, Message: "Unable to enable two-factor authentication", Data: map[string]interface{}{"error": err.Error()}})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusOK, Message: "Two-factor authentication enabled, store your recovery codes somewhere safe", Data: map[string]interface{}{"recoveryCodes": codes}})
+}
+
+// disable 2fa, requires the password and a current code or recovery code
+func (u *User) DisableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	_, claims, _ := jwtauth.FromContext(r.Context())
+	var body struct {
+		Password     string `json:"password"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recoveryCode"`
+	}
+	var user models.User
+	userId, _ := primitive.ObjectIDFromHex(claims["id"].(string))
+
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "Please pass the required details", Data: map[string]interface{}{"error": err.Error()}})
+		return
+	}
+
+	if err := userCollection.FindOne(context.TODO(), bson.M{"_id": userId}).Decode(&user); err != nil || !user.TwoFactorEnabled {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "Two-factor authentication is not enabled"})
+		return
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(body.Password)); err != nil || !checkSecondFactor(user, body.Code, body.RecoveryCode) {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusUnauthorized, Message: "Invalid password or code"})
+		return
+	}
+
+	update := bson.M{
+		"$set":   bson.M{"twoFactorEnabled": false},
+		"$unset": bson.M{"twoFactorSecret": "", "twoFactorPending": "", "twoFactorLastStep": "", "recoveryCodes": ""},
+	}
+	if _, err := userCollection.UpdateOne(context.TODO(), bson.M{"_id": userId}, update); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusInternalServerError, Message: "Unable to disable two-factor authentication", Data: map[string]interface{}{"error": err.Error()}})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusOK, Message: "Two-factor authentication disabled"})
+}
+
+// second login step, exchanges a challenge token and a code for a session token
+func (u *User) LoginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Challenge    string `json:"challenge"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recoveryCode"`
+	}
+	var user models.User
+
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "Please pass the required details", Data: map[string]interface{}{"error": err.Error()}})
+		return
+	}
+
+	token, err := jwtauth.VerifyToken(configs.UseJWT(), body.Challenge)
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusUnauthorized, Message: "Login challenge is invalid or has expired"})
+		return
+	}
+
+	claims := token.PrivateClaims()
+	id, _ := claims["id"].(string)
+	version, _ := claims["sv"].(float64)
+	userId, _ := primitive.ObjectIDFromHex(id)
+
+	err = userCollection.FindOne(context.TODO(), bson.M{"_id": userId}).Decode(&user)
+	if err != nil || claims["purpose"] != challengePurpose || int(version) != user.SessionVersion || !user.TwoFactorEnabled {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusUnauthorized, Message: "Login challenge is invalid or has expired"})
+		return
+	}
+
+	factorKey := "2fa:" + user.ID.Hex()
+	if throttled(w, r, twoFactorGuard, factorKey) {
+		return
+	}
+
+	if !checkSecondFactor(user, body.Code, body.RecoveryCode) {
+		twoFactorGuard.Fail(r.Context(), factorKey)
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusUnauthorized, Message: "Invalid code"})
+		return
+	}
+	twoFactorGuard.Reset(r.Context(), factorKey)
+
+	w.Header().Set("Content-type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusOK, Message: "Log in Successfull", Data: map[string]interface{}{"token": newSessionToken(user)}})
+}
+
+// check a totp code or consume a recovery code, codes can't be replayed
+func checkSecondFactor(user models.User, code string, recoveryCode string) bool {
+	if code != "" {
+		step, ok := totp.Validate(user.TwoFactorSecret, code, time.Now())
+		if !ok || step <= user.TwoFactorLastStep {
+			return false
+		}
+		result, err := userCollection.UpdateOne(context.TODO(), bson.M{"_id": user.ID, "twoFactorLastStep": user.TwoFactorLastStep}, bson.M{"$set": bson.M{"twoFactorLastStep": step}})
+		return err == nil && result.ModifiedCount == 1
+	}
+
+	normalized := strings.ToLower(strings.TrimSpace(recoveryCode))
+	if normalized == "" {
+		return false
+	}
+	for _, hash := range user.RecoveryCodes {
+		if bcrypt.CompareHashAndPassword([]byte(hash), []byte(normalized)) == nil {
+			result, err := userCollection.UpdateOne(context.TODO(), bson.M{"_id": user.ID, "recoveryCodes": hash}, bson.M{"$pull": bson.M{"recoveryCodes": hash}})
+			return err == nil && result.ModifiedCount == 1
+		}
+	}
+
+	return false
+}
+
+func newRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+	encoding := base32.StdEncoding.WithPadding(base32.NoPadding)
+
+	for i := 0; i < recoveryCodeCount; i++ {
+		buf := make([]byte, 6)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, nil, err
+		}
+		raw := strings.ToLower(encoding.EncodeToString(buf))
+		code := raw[:5] + "-" + raw[5:]
+
+		hash, err := bcrypt.GenerateFromPassword([]byte(code), bcrypt.DefaultCost)
+		if err != nil {
+			return nil, nil, err
+		}
+		codes = append(codes, code)
+		hashes = append(hashes, string(hash))
+	}
+
+	return codes, hashes, nil
+}
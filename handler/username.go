@@ -0,0 +1,141 @@
+package handler
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/go-chi/jwtauth/v5"
+	"github.com/zillalikestocode/community-api/models"
+	"github.com/zillalikestocode/community-api/responses"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var usernamePattern = regexp.MustCompile(`^[a-z0-9_]{3,32}$`)
+
+// how many generated usernames to try before giving up on saving one
+const maxUsernameAttempts = 5
+
+// names that mean something else in an @mention
+var reservedUsernames = []string{models.MentionEveryone, models.MentionAdmins, "here", "channel"}
+
+func validUsername(username string) bool {
+	return usernamePattern.MatchString(username) && !slices.Contains(reservedUsernames, username)
+}
+
+// change the username other members @mention you by
+func (u *User) SetUsername(w http.ResponseWriter, r *http.Request) {
+	_, claims, _ := jwtauth.FromContext(r.Context())
+	var body struct {
+		Username string `json:"username"`
+	}
+	json.NewDecoder(r.Body).Decode(&body)
+	userId, _ := primitive.ObjectIDFromHex(claims["id"].(string))
+
+	username := strings.ToLower(strings.TrimSpace(body.Username))
+	if !validUsername(username) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "Usernames are 3 to 32 letters, digits or underscores"})
+		return
+	}
+
+	// the unique index on username settles races between two users picking the same name
+	_, err := userCollection.UpdateOne(context.TODO(), bson.M{"_id": userId}, bson.M{"$set": bson.M{"username": username}})
+	if mongo.IsDuplicateKeyError(err) {
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusConflict, Message: "That username is taken"})
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusInternalServerError, Message: "Unable to update username", Data: map[string]interface{}{"error": err.Error()}})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusOK, Message: "Username updated", Data: map[string]interface{}{"username": username}})
+}
+
+// pick a username based on the user's name, adding digits when it is taken. After a few
+// taken names it settles for a long random suffix, which is practically always free, the
+// unique index catches the rare clash and the caller tries again.
+func generateUsername(ctx context.Context, name string) string {
+	base := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '_':
+			return r
+		case r == ' ' || r == '-' || r == '.':
+			return '_'
+		}
+		return -1
+	}, strings.ToLower(name))
+	if len(base) > 23 {
+		base = base[:23]
+	}
+	if len(base) < 3 || slices.Contains(reservedUsernames, base) {
+		base = "member"
+	}
+
+	candidate := base
+	for i := 0; i < 5; i++ {
+		if err := userCollection.FindOne(ctx, bson.M{"username": candidate}).Err(); err == mongo.ErrNoDocuments {
+			return candidate
+		}
+		candidate = base + "_" + randomDigits(4)
+	}
+	return base + "_" + randomDigits(8)
+}
+
+func randomDigits(n int) string {
+	digits := make([]byte, n)
+	for i := range digits {
+		d, _ := rand.Int(rand.Reader, big.NewInt(10))
+		digits[i] = byte('0' + d.Int64())
+	}
+	return string(digits)
+}
+
+// save a generated username with save, picking another one when a different user took it
+// first. save returns the duplicate key error in that case.
+func saveGeneratedUsername(ctx context.Context, name string, save func(username string) error) (string, error) {
+	var err error
+	for attempt := 0; attempt < maxUsernameAttempts; attempt++ {
+		username := generateUsername(ctx, name)
+		if err = save(username); !mongo.IsDuplicateKeyError(err) {
+			return username, err
+		}
+	}
+	return "", err
+}
+
+// give the users who signed up before usernames existed one, so they can be @mentioned
+func backfillUsernames(ctx context.Context) error {
+	cursor, err := userCollection.Find(ctx, bson.M{"username": bson.M{"$in": bson.A{nil, ""}}}, options.Find().SetProjection(bson.M{"name": 1}))
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var user models.User
+		if err := cursor.Decode(&user); err != nil {
+			return err
+		}
+		_, err := saveGeneratedUsername(ctx, user.Name, func(username string) error {
+			_, err := userCollection.UpdateOne(ctx, bson.M{"_id": user.ID, "username": bson.M{"$in": bson.A{nil, ""}}}, bson.M{"$set": bson.M{"username": username}})
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
@@ -0,0 +1,356 @@
+package handler
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/go-chi/jwtauth/v5"
+	"github.com/zillalikestocode/community-api/configs"
+	"github.com/zillalikestocode/community-api/jobs"
+	"github.com/zillalikestocode/community-api/models"
+	"github.com/zillalikestocode/community-api/responses"
+	"github.com/zillalikestocode/community-api/webhook"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type Webhook struct {
+}
+
+var webhookCollection *mongo.Collection = configs.GetCollection(configs.ConnectDB(), "webhooks")
+var deliveryCollection *mongo.Collection = configs.GetCollection(configs.ConnectDB(), "webhook_deliveries")
+
+var webhookClient = webhook.NewClient(10 * time.Second)
+
+const (
+	// failed attempts in a row before a webhook is disabled
+	webhookFailureLimit = 15
+)
+
+// event types webhooks can subscribe to, "*" subscribes to all of them
+var webhookEvents = []string{
+	EventMemberJoined,
+	EventMemberLeft,
+	EventCommunityUpdated,
+	EventAnnouncementCreated,
+	EventAnnouncementUpdated,
+	EventAnnouncementDeleted,
+	EventAnnouncementPinsChanged,
+	EventEventCreated,
+	EventEventUpdated,
+	EventEventDeleted,
+	EventCommentCreated,
+	EventCommentUpdated,
+	EventCommentDeleted,
+	EventCommentModerated,
+	EventPollCreated,
+	EventPollClosed,
+	EventPollDeleted,
+}
+
+// register a webhook, admins only. The secret is only returned here.
+func (h *Webhook) Create(w http.ResponseWriter, r *http.Request) {
+	_, claims, _ := jwtauth.FromContext(r.Context())
+	var body struct {
+		CommunityId string   `json:"communityId"`
+		URL         string   `json:"url"`
+		Events      []string `json:"events"`
+	}
+	userId, _ := primitive.ObjectIDFromHex(claims["id"].(string))
+
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "Please pass the required details", Data: map[string]interface{}{"error": err.Error()}})
+		return
+	}
+
+	// plain http is only allowed while developing
+	if err := webhook.ValidateURL(r.Context(), body.URL, !configs.Development()); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "Please pass a valid https url on a public address", Data: map[string]interface{}{"error": err.Error()}})
+		return
+	}
+
+	if len(body.Events) == 0 {
+		body.Events = []string{"*"}
+	}
+	for _, event := range body.Events {
+		if event != "*" && !slices.Contains(webhookEvents, event) {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "Unknown event type", Data: map[string]interface{}{"event": event, "events": webhookEvents}})
+			return
+		}
+	}
+
+	communityId, _ := primitive.ObjectIDFromHex(body.CommunityId)
+	if !requireCommunityAdmin(w, communityId, userId) {
+		return
+	}
+
+	secret := make([]byte, 32)
+	rand.Read(secret)
+
+	hook := models.Webhook{
+		ID:          primitive.NewObjectID(),
+		CommunityID: communityId,
+		URL:         body.URL,
+		Secret:      "whsec_" + hex.EncodeToString(secret),
+		Events:      body.Events,
+		Active:      true,
+		CreatedBy:   userId,
+		CreatedAt:   primitive.NewDateTimeFromTime(time.Now()),
+	}
+	if _, err := webhookCollection.InsertOne(context.TODO(), hook); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "An error occured while creating the webhook", Data: map[string]interface{}{"error": err.Error()}})
+		return
+	}
+
+	audit(context.TODO(), communityId, userId, models.AuditCreate, models.AuditWebhook, hook.ID, nil, webhookSnapshot(hook))
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusCreated, Message: "Webhook created, store the secret to verify signatures", Data: map[string]interface{}{"webhook": hook, "secret": hook.Secret}})
+}
+
+// list a community's webhooks, admins only
+func (h *Webhook) List(w http.ResponseWriter, r *http.Request) {
+	_, claims, _ := jwtauth.FromContext(r.Context())
+	var result []models.Webhook
+	userId, _ := primitive.ObjectIDFromHex(claims["id"].(string))
+	communityId, _ := primitive.ObjectIDFromHex(r.URL.Query().Get("communityId"))
+
+	if !requireCommunityAdmin(w, communityId, userId) {
+		return
+	}
+
+	cursor, _ := webhookCollection.Find(context.TODO(), bson.M{"communityId": communityId})
+	if err := cursor.All(context.TODO(), &result); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "A server error has occured", Data: map[string]interface{}{"error": err.Error()}})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusOK, Message: "Webhooks fetched successfully", Data: map[string]interface{}{"result": result}})
+}
+
+// delete a webhook and its delivery log, admins only
+func (h *Webhook) Delete(w http.ResponseWriter, r *http.Request) {
+	_, claims, _ := jwtauth.FromContext(r.Context())
+	var body struct {
+		WebhookId string `json:"webhookId"`
+	}
+	json.NewDecoder(r.Body).Decode(&body)
+	userId, _ := primitive.ObjectIDFromHex(claims["id"].(string))
+	webhookId, _ := primitive.ObjectIDFromHex(body.WebhookId)
+
+	hook, ok := findAdminWebhook(w, webhookId, userId)
+	if !ok {
+		return
+	}
+
+	webhookCollection.DeleteOne(context.TODO(), bson.M{"_id": hook.ID})
+	audit(context.TODO(), hook.CommunityID, userId, models.AuditDelete, models.AuditWebhook, hook.ID, webhookSnapshot(hook), nil)
+	enqueue(context.TODO(), JobPurgeWebhook, purgePayload{ID: hook.ID})
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusOK, Message: "Webhook deleted"})
+}
+
+// re-enable a webhook that was disabled after repeated failures, admins only
+func (h *Webhook) Enable(w http.ResponseWriter, r *http.Request) {
+	_, claims, _ := jwtauth.FromContext(r.Context())
+	var body struct {
+		WebhookId string `json:"webhookId"`
+	}
+	json.NewDecoder(r.Body).Decode(&body)
+	userId, _ := primitive.ObjectIDFromHex(claims["id"].(string))
+	webhookId, _ := primitive.ObjectIDFromHex(body.WebhookId)
+
+	hook, ok := findAdminWebhook(w, webhookId, userId)
+	if !ok {
+		return
+	}
+
+	webhookCollection.UpdateOne(context.TODO(), bson.M{"_id": hook.ID}, bson.M{"$set": bson.M{"active": true, "consecutiveFailures": 0}, "$unset": bson.M{"disabledAt": ""}})
+	audit(context.TODO(), hook.CommunityID, userId, models.AuditEnable, models.AuditWebhook, hook.ID, webhookSnapshot(hook), bson.M{"url": hook.URL, "events": hook.Events, "active": true})
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusOK, Message: "Webhook enabled"})
+}
+
+// page through a webhook's delivery log, newest first
+func (h *Webhook) Deliveries(w http.ResponseWriter, r *http.Request) {
+	_, claims, _ := jwtauth.FromContext(r.Context())
+	var result []models.WebhookDelivery
+	userId, _ := primitive.ObjectIDFromHex(claims["id"].(string))
+	webhookId, _ := primitive.ObjectIDFromHex(r.URL.Query().Get("webhookId"))
+
+	hook, ok := findAdminWebhook(w, webhookId, userId)
+	if !ok {
+		return
+	}
+
+	filter := bson.M{"webhookId": hook.ID}
+	if status := r.URL.Query().Get("status"); status != "" {
+		filter["status"] = status
+	}
+	if before, err := primitive.ObjectIDFromHex(r.URL.Query().Get("before")); err == nil {
+		filter["_id"] = bson.M{"$lt": before}
+	}
+
+	cursor, _ := deliveryCollection.Find(context.TODO(), filter, options.Find().SetSort(bson.M{"_id": -1}).SetLimit(historyPageSize))
+	if err := cursor.All(context.TODO(), &result); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "A server error has occured", Data: map[string]interface{}{"error": err.Error()}})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusOK, Message: "Deliveries fetched successfully", Data: map[string]interface{}{"result": result}})
+}
+
+// send a past delivery again with the same payload, admins only
+func (h *Webhook) Redeliver(w http.ResponseWriter, r *http.Request) {
+	_, claims, _ := jwtauth.FromContext(r.Context())
+	var body struct {
+		DeliveryId string `json:"deliveryId"`
+	}
+	var delivery models.WebhookDelivery
+	json.NewDecoder(r.Body).Decode(&body)
+	userId, _ := primitive.ObjectIDFromHex(claims["id"].(string))
+	deliveryId, _ := primitive.ObjectIDFromHex(body.DeliveryId)
+
+	if err := deliveryCollection.FindOne(context.TODO(), bson.M{"_id": deliveryId}).Decode(&delivery); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "Unable to find delivery", Data: map[string]interface{}{"error": err.Error()}})
+		return
+	}
+
+	hook, ok := findAdminWebhook(w, delivery.WebhookID, userId)
+	if !ok {
+		return
+	}
+
+	redelivery := models.WebhookDelivery{
+		ID:          primitive.NewObjectID(),
+		WebhookID:   hook.ID,
+		CommunityID: hook.CommunityID,
+		Event:       delivery.Event,
+		Payload:     delivery.Payload,
+		Status:      models.DeliveryPending,
+		CreatedAt:   primitive.NewDateTimeFromTime(time.Now()),
+	}
+	if _, err := deliveryCollection.InsertOne(context.TODO(), redelivery); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusInternalServerError, Message: "Unable to redeliver", Data: map[string]interface{}{"error": err.Error()}})
+		return
+	}
+
+	redelivery = attemptDelivery(context.TODO(), hook, redelivery)
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusOK, Message: "Delivery attempted", Data: map[string]interface{}{"delivery": redelivery}})
+}
+
+// create deliveries for every active webhook subscribed to the event and queue them
+func dispatchWebhooks(ctx context.Context, communityId primitive.ObjectID, eventType string, data map[string]interface{}) {
+	var hooks []models.Webhook
+	cursor, err := webhookCollection.Find(ctx, bson.M{"communityId": communityId, "active": true, "events": bson.M{"$in": []string{eventType, "*"}}})
+	if err != nil || cursor.All(ctx, &hooks) != nil {
+		return
+	}
+
+	for _, hook := range hooks {
+		delivery := models.WebhookDelivery{
+			ID:          primitive.NewObjectID(),
+			WebhookID:   hook.ID,
+			CommunityID: communityId,
+			Event:       eventType,
+			Status:      models.DeliveryPending,
+			CreatedAt:   primitive.NewDateTimeFromTime(time.Now()),
+		}
+		payload, _ := json.Marshal(map[string]interface{}{
+			"id":          delivery.ID,
+			"type":        eventType,
+			"communityId": communityId,
+			"createdAt":   delivery.CreatedAt,
+			"data":        data,
+		})
+		delivery.Payload = string(payload)
+
+		if _, err := deliveryCollection.InsertOne(ctx, delivery); err != nil {
+			fmt.Printf("failed to record webhook delivery: %v\n", err)
+			continue
+		}
+		enqueue(ctx, JobDeliverWebhook, map[string]interface{}{"deliveryId": delivery.ID})
+	}
+}
+
+// send one attempt and record the outcome, scheduling a retry with backoff on failure
+func attemptDelivery(ctx context.Context, hook models.Webhook, delivery models.WebhookDelivery) models.WebhookDelivery {
+	status, err := webhook.Deliver(ctx, webhookClient, hook.URL, hook.Secret, delivery.ID.Hex(), delivery.Event, []byte(delivery.Payload))
+
+	now := time.Now()
+	lastAttempt := primitive.NewDateTimeFromTime(now)
+	delivery.Attempts++
+	delivery.LastAttemptAt = &lastAttempt
+	delivery.ResponseStatus = status
+	delivery.NextAttemptAt = nil
+	delivery.Error = ""
+
+	if err == nil {
+		delivery.Status = models.DeliverySucceeded
+		webhookCollection.UpdateOne(ctx, bson.M{"_id": hook.ID}, bson.M{"$set": bson.M{"consecutiveFailures": 0}})
+	} else {
+		delivery.Error = err.Error()
+		if backoff, retry := webhook.Retry(delivery.Attempts); retry {
+			next := primitive.NewDateTimeFromTime(now.Add(backoff))
+			delivery.NextAttemptAt = &next
+			enqueue(ctx, JobDeliverWebhook, map[string]interface{}{"deliveryId": delivery.ID}, jobs.Delay(backoff))
+		} else {
+			delivery.Status = models.DeliveryFailed
+		}
+
+		var updated models.Webhook
+		webhookCollection.FindOneAndUpdate(ctx, bson.M{"_id": hook.ID}, bson.M{"$inc": bson.M{"consecutiveFailures": 1}}, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&updated)
+		if updated.Active && updated.ConsecutiveFailures >= webhookFailureLimit {
+			webhookCollection.UpdateOne(ctx, bson.M{"_id": hook.ID}, bson.M{"$set": bson.M{"active": false, "disabledAt": lastAttempt}})
+		}
+	}
+
+	deliveryCollection.ReplaceOne(ctx, bson.M{"_id": delivery.ID}, delivery)
+	return delivery
+}
+
+func requireCommunityAdmin(w http.ResponseWriter, communityId primitive.ObjectID, userId primitive.ObjectID) bool {
+	var community models.Community
+	if err := communityCollection.FindOne(context.TODO(), bson.M{"_id": communityId}).Decode(&community); err != nil || !isAdmin(community, userId) {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusForbidden, Message: "Only community admins can do this"})
+		return false
+	}
+	return true
+}
+
+// the audit log keeps a webhook without its secret
+func webhookSnapshot(hook models.Webhook) bson.M {
+	return bson.M{"url": hook.URL, "events": hook.Events, "active": hook.Active, "disabledAt": hook.DisabledAt}
+}
+
+func findAdminWebhook(w http.ResponseWriter, webhookId primitive.ObjectID, userId primitive.ObjectID) (models.Webhook, bool) {
+	var hook models.Webhook
+	if err := webhookCollection.FindOne(context.TODO(), bson.M{"_id": webhookId}).Decode(&hook); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusBadRequest, Message: "Unable to find webhook", Data: map[string]interface{}{"error": err.Error()}})
+		return hook, false
+	}
+	return hook, requireCommunityAdmin(w, hook.CommunityID, userId)
+}
@@ -0,0 +1,147 @@
+// Package imaging turns uploaded avatars and banners into fixed size thumbnails.
+// Images are decoded and encoded again, so EXIF and other metadata never reach the
+// stored copies.
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+
+	"golang.org/x/image/draw"
+
+	_ "image/gif"
+
+	_ "golang.org/x/image/webp"
+)
+
+var (
+	ErrUnsupported = errors.New("unsupported image format")
+	ErrTooLarge    = errors.New("image dimensions are too large")
+)
+
+// MaxPixels limits the decoded size so a small compressed file can't exhaust memory,
+// each decoded copy takes 4 bytes a pixel
+const MaxPixels = 16_000_000
+
+const (
+	FormatJPEG = "jpg"
+	FormatPNG  = "png"
+)
+
+// Thumbnail is one resized copy of an image
+type Thumbnail struct {
+	Width  int
+	Height int
+	Data   []byte
+}
+
+// Result holds the thumbnails of an image, all encoded in Format
+type Result struct {
+	Format     string
+	Thumbnails []Thumbnail
+}
+
+// ContentType of thumbnails encoded in format
+func ContentType(format string) string {
+	if format == FormatPNG {
+		return "image/png"
+	}
+	return "image/jpeg"
+}
+
+// Resize decodes a PNG, JPEG, GIF or WebP image, crops it around the centre to
+// aspect (width / height) and scales it to each of widths. Opaque images are encoded
+// as JPEG, images with transparency as PNG.
+func Resize(r io.Reader, aspect float64, widths []int) (Result, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return Result{}, err
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return Result{}, ErrUnsupported
+	}
+	if config.Width <= 0 || config.Height <= 0 || config.Width*config.Height > MaxPixels {
+		return Result{}, ErrTooLarge
+	}
+
+	src, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return Result{}, ErrUnsupported
+	}
+	if format == "jpeg" {
+		src = orient(src, jpegOrientation(data))
+	}
+	src = crop(src, aspect)
+
+	result := Result{Format: FormatJPEG}
+	if !opaque(src) {
+		result.Format = FormatPNG
+	}
+
+	for _, width := range widths {
+		height := int(float64(width)/aspect + 0.5)
+		dst := image.NewRGBA(image.Rect(0, 0, width, height))
+		if result.Format == FormatJPEG {
+			// JPEG has no alpha, fill in behind anything the scaler leaves translucent
+			draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+		}
+		draw.CatmullRom.Scale(dst, dst.Bounds(), src, src.Bounds(), draw.Over, nil)
+
+		var buf bytes.Buffer
+		if result.Format == FormatPNG {
+			err = png.Encode(&buf, dst)
+		} else {
+			err = jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 85})
+		}
+		if err != nil {
+			return Result{}, err
+		}
+		result.Thumbnails = append(result.Thumbnails, Thumbnail{Width: width, Height: height, Data: buf.Bytes()})
+	}
+	return result, nil
+}
+
+// the largest centred region of img with the given aspect ratio
+func crop(img image.Image, aspect float64) image.Image {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if float64(width)/float64(height) > aspect {
+		width = int(float64(height)*aspect + 0.5)
+	} else {
+		height = int(float64(width)/aspect + 0.5)
+	}
+	x := bounds.Min.X + (bounds.Dx()-width)/2
+	y := bounds.Min.Y + (bounds.Dy()-height)/2
+	rect := image.Rect(x, y, x+width, y+height)
+
+	if sub, ok := img.(interface {
+		SubImage(image.Rectangle) image.Image
+	}); ok {
+		return sub.SubImage(rect)
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(dst, dst.Bounds(), img, rect.Min, draw.Src)
+	return dst
+}
+
+func opaque(img image.Image) bool {
+	if o, ok := img.(interface{ Opaque() bool }); ok {
+		return o.Opaque()
+	}
+	bounds := img.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if _, _, _, a := img.At(x, y).RGBA(); a != 0xffff {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,256 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+// the source pixel shown at (u, v) for each EXIF orientation, as the spec describes it
+func reference(orientation int, width, height, u, v int) (int, int) {
+	switch orientation {
+	case 2:
+		return width - 1 - u, v
+	case 3:
+		return width - 1 - u, height - 1 - v
+	case 4:
+		return u, height - 1 - v
+	case 5:
+		return v, u
+	case 6:
+		return v, height - 1 - u
+	case 7:
+		return width - 1 - v, height - 1 - u
+	case 8:
+		return width - 1 - v, u
+	}
+	return u, v
+}
+
+func TestOrient(t *testing.T) {
+	const width, height = 5, 3
+	sources := map[string]image.Image{}
+
+	rgba := image.NewRGBA(image.Rect(0, 0, width, height))
+	nrgba := image.NewNRGBA(image.Rect(0, 0, width, height))
+	gray := image.NewGray(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			rgba.Set(x, y, color.RGBA{uint8(x * 40), uint8(y * 80), 7, 255})
+			nrgba.Set(x, y, color.NRGBA{uint8(x * 40), uint8(y * 80), 7, uint8(50 + x*y*10)})
+			gray.Set(x, y, color.Gray{uint8(x*40 + y)})
+		}
+	}
+	sources["rgba"] = rgba
+	sources["nrgba"] = nrgba
+	sources["gray"] = gray
+	// a sub image doesn't start at the origin or at the start of its Pix
+	big := image.NewRGBA(image.Rect(0, 0, width+4, height+4))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			big.Set(x+2, y+3, rgba.At(x, y))
+		}
+	}
+	sources["sub image"] = big.SubImage(image.Rect(2, 3, width+2, height+3))
+
+	for name, src := range sources {
+		for orientation := 1; orientation <= 8; orientation++ {
+			got := orient(src, orientation)
+			bounds := got.Bounds()
+			wantWidth, wantHeight := width, height
+			if orientation >= 5 {
+				wantWidth, wantHeight = height, width
+			}
+			if bounds.Dx() != wantWidth || bounds.Dy() != wantHeight {
+				t.Fatalf("%s orientation %d: size %v, want %dx%d", name, orientation, bounds.Size(), wantWidth, wantHeight)
+			}
+			if _, ok := src.(*image.NRGBA); ok && orientation > 1 {
+				if _, ok := got.(*image.NRGBA); !ok {
+					t.Errorf("%s orientation %d: got %T, want *image.NRGBA", name, orientation, got)
+				}
+			}
+
+			for v := 0; v < wantHeight; v++ {
+				for u := 0; u < wantWidth; u++ {
+					x, y := reference(orientation, width, height, u, v)
+					want := color.NRGBAModel.Convert(src.At(src.Bounds().Min.X+x, src.Bounds().Min.Y+y))
+					if have := color.NRGBAModel.Convert(got.At(bounds.Min.X+u, bounds.Min.Y+v)); have != want {
+						t.Errorf("%s orientation %d: pixel (%d, %d) = %v, want %v", name, orientation, u, v, have, want)
+					}
+				}
+			}
+		}
+	}
+}
+
+// a JPEG APP1 segment holding just the orientation tag
+func exifSegment(order binary.ByteOrder, orientation uint16) []byte {
+	tiff := make([]byte, 8+2+12+4)
+	if order == binary.LittleEndian {
+		copy(tiff, "II")
+	} else {
+		copy(tiff, "MM")
+	}
+	order.PutUint16(tiff[2:], 42)
+	order.PutUint32(tiff[4:], 8)
+	order.PutUint16(tiff[8:], 1)
+	order.PutUint16(tiff[10:], 0x0112)
+	order.PutUint16(tiff[12:], 3)
+	order.PutUint32(tiff[14:], 1)
+	order.PutUint16(tiff[18:], orientation)
+
+	body := append([]byte("Exif\x00\x00"), tiff...)
+	segment := []byte{0xff, 0xe1, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(body)+2))
+	return append(segment, body...)
+}
+
+// insert segment right after the start of image marker
+func withSegment(jpegData []byte, segment []byte) []byte {
+	out := append([]byte{}, jpegData[:2]...)
+	out = append(out, segment...)
+	return append(out, jpegData[2:]...)
+}
+
+func TestJPEGOrientation(t *testing.T) {
+	var plain bytes.Buffer
+	jpeg.Encode(&plain, image.NewGray(image.Rect(0, 0, 8, 8)), nil)
+
+	tests := []struct {
+		name string
+		data []byte
+		want int
+	}{
+		{"no exif", plain.Bytes(), 1},
+		{"little endian", withSegment(plain.Bytes(), exifSegment(binary.LittleEndian, 6)), 6},
+		{"big endian", withSegment(plain.Bytes(), exifSegment(binary.BigEndian, 8)), 8},
+		{"out of range", withSegment(plain.Bytes(), exifSegment(binary.BigEndian, 9)), 1},
+		{"truncated", withSegment(plain.Bytes(), exifSegment(binary.BigEndian, 3))[:20], 1},
+		{"not a jpeg", []byte("GIF89a"), 1},
+		{"empty", nil, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := jpegOrientation(tt.data); got != tt.want {
+				t.Errorf("jpegOrientation = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+// a PNG that claims the given size, only DecodeConfig can read it
+func pngHeader(width, height uint32) []byte {
+	ihdr := make([]byte, 13)
+	binary.BigEndian.PutUint32(ihdr, width)
+	binary.BigEndian.PutUint32(ihdr[4:], height)
+	ihdr[8], ihdr[9] = 8, 6
+
+	chunk := append([]byte("IHDR"), ihdr...)
+	data := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\x0d")
+	data = append(data, chunk...)
+	return binary.BigEndian.AppendUint32(data, crc32.ChecksumIEEE(chunk))
+}
+
+func encodePNG(t *testing.T, img image.Image) []byte {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestResize(t *testing.T) {
+	opaque := image.NewRGBA(image.Rect(0, 0, 300, 100))
+	for i := 3; i < len(opaque.Pix); i += 4 {
+		opaque.Pix[i] = 0xff
+	}
+	translucent := image.NewNRGBA(image.Rect(0, 0, 100, 300))
+
+	tests := []struct {
+		name   string
+		data   []byte
+		aspect float64
+		widths []int
+		format string
+		err    error
+	}{
+		{"opaque", encodePNG(t, opaque), 1, []int{64, 256}, FormatJPEG, nil},
+		{"transparent", encodePNG(t, translucent), 3, []int{640}, FormatPNG, nil},
+		{"too large", pngHeader(5000, 4000), 1, []int{64}, "", ErrTooLarge},
+		{"zero width", pngHeader(0, 10), 1, []int{64}, "", ErrUnsupported},
+		{"not an image", []byte("hello"), 1, []int{64}, "", ErrUnsupported},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := Resize(bytes.NewReader(tt.data), tt.aspect, tt.widths)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Resize error = %v, want %v", err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+			if result.Format != tt.format {
+				t.Errorf("format = %s, want %s", result.Format, tt.format)
+			}
+			if len(result.Thumbnails) != len(tt.widths) {
+				t.Fatalf("%d thumbnails, want %d", len(result.Thumbnails), len(tt.widths))
+			}
+			for i, thumbnail := range result.Thumbnails {
+				config, format, err := image.DecodeConfig(bytes.NewReader(thumbnail.Data))
+				if err != nil {
+					t.Fatal(err)
+				}
+				wantHeight := int(float64(tt.widths[i])/tt.aspect + 0.5)
+				if config.Width != tt.widths[i] || config.Height != wantHeight || thumbnail.Width != tt.widths[i] || thumbnail.Height != wantHeight {
+					t.Errorf("thumbnail %d is %dx%d, want %dx%d", i, config.Width, config.Height, tt.widths[i], wantHeight)
+				}
+				if !strings.HasPrefix(ContentType(result.Format), "image/"+format) {
+					t.Errorf("thumbnail %d is %s, want %s", i, format, result.Format)
+				}
+			}
+		})
+	}
+}
+
+func TestResizeAppliesOrientation(t *testing.T) {
+	// red on the left and blue on the right, stored sideways with orientation 6
+	src := image.NewRGBA(image.Rect(0, 0, 40, 20))
+	for y := 0; y < 20; y++ {
+		for x := 0; x < 40; x++ {
+			c := color.RGBA{255, 0, 0, 255}
+			if x >= 20 {
+				c = color.RGBA{0, 0, 255, 255}
+			}
+			src.Set(x, y, c)
+		}
+	}
+	var buf bytes.Buffer
+	jpeg.Encode(&buf, src, &jpeg.Options{Quality: 100})
+	data := withSegment(buf.Bytes(), exifSegment(binary.BigEndian, 6))
+
+	result, err := Resize(bytes.NewReader(data), 0.5, []int{20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := jpeg.Decode(bytes.NewReader(result.Thumbnails[0].Data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Bounds().Dx() != 20 || img.Bounds().Dy() != 40 {
+		t.Fatalf("thumbnail is %v, want 20x40", img.Bounds().Size())
+	}
+
+	// turned upright the red half is on top
+	top, _, topBlue, _ := img.At(10, 5).RGBA()
+	bottom, _, bottomBlue, _ := img.At(10, 35).RGBA()
+	if top < topBlue || bottomBlue < bottom {
+		t.Errorf("top pixel is %v and bottom %v, want red over blue", img.At(10, 5), img.At(10, 35))
+	}
+}
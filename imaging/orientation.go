@@ -0,0 +1,129 @@
+package imaging
+
+import (
+	"encoding/binary"
+	"image"
+
+	"golang.org/x/image/draw"
+)
+
+// jpegOrientation reads the EXIF orientation tag of a JPEG, 1 (upright) when there is none.
+// Phones store photos as shot and rely on this tag, so it has to be applied before the
+// metadata is dropped.
+func jpegOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xff || data[1] != 0xd8 {
+		return 1
+	}
+	i := 2
+	for i+4 <= len(data) && data[i] == 0xff {
+		marker := data[i+1]
+		size := int(binary.BigEndian.Uint16(data[i+2:]))
+		if size < 2 || i+2+size > len(data) {
+			return 1
+		}
+		segment := data[i+4 : i+2+size]
+		if marker == 0xe1 && len(segment) > 6 && string(segment[:6]) == "Exif\x00\x00" {
+			return exifOrientation(segment[6:])
+		}
+		// the image data starts at SOS, EXIF always comes before it
+		if marker == 0xda {
+			return 1
+		}
+		i += 2 + size
+	}
+	return 1
+}
+
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	offset := int(order.Uint32(tiff[4:]))
+	if offset < 8 || offset+2 > len(tiff) {
+		return 1
+	}
+	count := int(order.Uint16(tiff[offset:]))
+	for n := 0; n < count; n++ {
+		entry := offset + 2 + n*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			value := int(order.Uint16(tiff[entry+8:]))
+			if value >= 1 && value <= 8 {
+				return value
+			}
+			return 1
+		}
+	}
+	return 1
+}
+
+// orient returns img transformed so it displays upright for the EXIF orientation. Pixels
+// are copied between Pix slices, going through At and Set would box every one of them.
+func orient(img image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+
+	var src *image.RGBA
+	switch img := img.(type) {
+	case *image.NRGBA:
+		// keep straight alpha so transparent pixels don't lose their colour
+		src = &image.RGBA{Pix: img.Pix, Stride: img.Stride, Rect: img.Rect}
+	case *image.RGBA:
+		src = img
+	default:
+		src = image.NewRGBA(img.Bounds())
+		draw.Draw(src, src.Rect, img, img.Bounds().Min, draw.Src)
+	}
+
+	width, height := src.Rect.Dx(), src.Rect.Dy()
+	dstWidth, dstHeight := width, height
+	// orientations 5 to 8 swap width and height
+	if orientation >= 5 {
+		dstWidth, dstHeight = height, width
+	}
+	pix := make([]byte, dstWidth*dstHeight*4)
+	stride := dstWidth * 4
+
+	for y := 0; y < height; y++ {
+		row := src.Pix[y*src.Stride : y*src.Stride+width*4]
+		for x := 0; x < width; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2:
+				dx, dy = dstWidth-1-x, y
+			case 3:
+				dx, dy = dstWidth-1-x, dstHeight-1-y
+			case 4:
+				dx, dy = x, dstHeight-1-y
+			case 5:
+				dx, dy = y, x
+			case 6:
+				dx, dy = dstWidth-1-y, x
+			case 7:
+				dx, dy = dstWidth-1-y, dstHeight-1-x
+			case 8:
+				dx, dy = y, dstHeight-1-x
+			}
+			copy(pix[dy*stride+dx*4:dy*stride+dx*4+4], row[x*4:x*4+4])
+		}
+	}
+
+	rect := image.Rect(0, 0, dstWidth, dstHeight)
+	if _, ok := img.(*image.NRGBA); ok {
+		return &image.NRGBA{Pix: pix, Stride: stride, Rect: rect}
+	}
+	return &image.RGBA{Pix: pix, Stride: stride, Rect: rect}
+}
@@ -0,0 +1,101 @@
+// Package jobs is a durable background job queue with retries, dead-lettering
+// and leasing so several instances can share one queue.
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+const (
+	StatusPending = "pending"
+	StatusDead    = "dead"
+
+	DefaultMaxAttempts = 5
+
+	// how long dead jobs are kept for inspection before they are purged with their payload,
+	// completed jobs are removed straight away
+	DeadRetention = 7 * 24 * time.Hour
+)
+
+type Job struct {
+	ID          string          `json:"id" bson:"-"`
+	Type        string          `json:"type" bson:"type"`
+	Payload     json.RawMessage `json:"payload" bson:"payload"`
+	Status      string          `json:"status" bson:"status"`
+	Attempts    int             `json:"attempts" bson:"attempts"`
+	MaxAttempts int             `json:"maxAttempts" bson:"maxAttempts"`
+	RunAt       time.Time       `json:"runAt" bson:"runAt"`
+	LockedBy    string          `json:"lockedBy,omitempty" bson:"lockedBy,omitempty"`
+	LockedUntil time.Time       `json:"lockedUntil,omitempty" bson:"lockedUntil,omitempty"`
+	LastError   string          `json:"lastError,omitempty" bson:"lastError,omitempty"`
+	DeadAt      time.Time       `json:"deadAt,omitempty" bson:"deadAt,omitempty"`
+	CreatedAt   time.Time       `json:"createdAt" bson:"createdAt"`
+}
+
+// Decode unmarshals the job payload
+func (j *Job) Decode(v interface{}) error {
+	return json.Unmarshal(j.Payload, v)
+}
+
+// Queue stores jobs. Lease hands a due job to one worker until the lease expires,
+// a job whose worker dies is picked up again once its lease runs out.
+type Queue interface {
+	Enqueue(ctx context.Context, jobType string, payload interface{}, opts ...Option) error
+	// Lease returns nil when no job is due
+	Lease(ctx context.Context, worker string, lease time.Duration) (*Job, error)
+	Complete(ctx context.Context, job *Job) error
+	// Fail schedules a retry with backoff, or dead-letters the job once it has no attempts left
+	Fail(ctx context.Context, job *Job, cause error) error
+}
+
+type Option func(*Job)
+
+// Delay runs the job no earlier than d from now
+func Delay(d time.Duration) Option {
+	return func(j *Job) {
+		j.RunAt = j.RunAt.Add(d)
+	}
+}
+
+// MaxAttempts overrides DefaultMaxAttempts
+func MaxAttempts(n int) Option {
+	return func(j *Job) {
+		j.MaxAttempts = n
+	}
+}
+
+func newJob(jobType string, payload interface{}, opts []Option) (*Job, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	job := &Job{
+		Type:        jobType,
+		Payload:     data,
+		Status:      StatusPending,
+		MaxAttempts: DefaultMaxAttempts,
+		RunAt:       now,
+		CreatedAt:   now,
+	}
+	for _, opt := range opts {
+		opt(job)
+	}
+
+	return job, nil
+}
+
+// Backoff returns the wait before retrying after the given attempt: 10s, 20s, 40s ... up to 1h
+func Backoff(attempt int) time.Duration {
+	delay := 10 * time.Second
+	for i := 1; i < attempt && delay < time.Hour; i++ {
+		delay *= 2
+	}
+	if delay > time.Hour {
+		delay = time.Hour
+	}
+	return delay
+}
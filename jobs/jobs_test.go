@@ -0,0 +1,199 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{1, 10 * time.Second},
+		{2, 20 * time.Second},
+		{3, 40 * time.Second},
+		{9, 2560 * time.Second},
+		{10, time.Hour},
+		{100, time.Hour},
+	}
+	for _, tt := range tests {
+		if got := Backoff(tt.attempt); got != tt.want {
+			t.Errorf("Backoff(%d) = %s, want %s", tt.attempt, got, tt.want)
+		}
+	}
+}
+
+func TestMemoryQueueLeaseAndComplete(t *testing.T) {
+	ctx := context.Background()
+	q := NewMemoryQueue()
+
+	q.Enqueue(ctx, "email.verify", map[string]string{"userId": "u1"})
+	q.Enqueue(ctx, "later", nil, Delay(time.Hour))
+
+	job, err := q.Lease(ctx, "w1", time.Minute)
+	if err != nil || job == nil || job.Type != "email.verify" || job.Attempts != 1 {
+		t.Fatalf("Lease = %+v, %v", job, err)
+	}
+	var payload map[string]string
+	if err := job.Decode(&payload); err != nil || payload["userId"] != "u1" {
+		t.Fatalf("payload = %v, %v", payload, err)
+	}
+
+	// leased and delayed jobs aren't handed out
+	if next, _ := q.Lease(ctx, "w2", time.Minute); next != nil {
+		t.Fatalf("leased %+v twice", next)
+	}
+
+	q.Complete(ctx, job)
+	if _, ok := q.jobs[job.ID]; ok {
+		t.Fatal("completed jobs should be removed with their payload")
+	}
+}
+
+func TestMemoryQueueFailRetriesThenDies(t *testing.T) {
+	ctx := context.Background()
+	q := NewMemoryQueue()
+	q.Enqueue(ctx, "flaky", nil, MaxAttempts(2))
+
+	job, _ := q.Lease(ctx, "w1", time.Minute)
+	q.Fail(ctx, job, errors.New("boom"))
+	stored := q.jobs[job.ID]
+	if stored.Status != StatusPending || stored.LastError != "boom" || time.Until(stored.RunAt) < 9*time.Second {
+		t.Fatalf("after the first failure: %+v", stored)
+	}
+
+	stored.RunAt = time.Now()
+	job, _ = q.Lease(ctx, "w1", time.Minute)
+	q.Fail(ctx, job, errors.New("boom again"))
+	if stored.Status != StatusDead || stored.DeadAt.IsZero() {
+		t.Fatalf("after the last attempt: %+v", stored)
+	}
+	if next, _ := q.Lease(ctx, "w1", time.Minute); next != nil {
+		t.Fatal("dead jobs should not run")
+	}
+}
+
+func TestMemoryQueueFailNeedsLease(t *testing.T) {
+	ctx := context.Background()
+	q := NewMemoryQueue()
+	q.Enqueue(ctx, "job", nil)
+
+	job, _ := q.Lease(ctx, "w1", time.Minute)
+	job.LockedBy = "w2"
+	if err := q.Fail(ctx, job, errors.New("boom")); err == nil {
+		t.Fatal("a worker that lost the lease should not record failures")
+	}
+}
+
+func TestMemoryQueuePurgesDeadJobs(t *testing.T) {
+	ctx := context.Background()
+	q := NewMemoryQueue()
+	q.Enqueue(ctx, "job", nil, MaxAttempts(1))
+
+	job, _ := q.Lease(ctx, "w1", time.Minute)
+	q.Fail(ctx, job, errors.New("boom"))
+
+	q.Lease(ctx, "w1", time.Minute)
+	if _, ok := q.jobs[job.ID]; !ok {
+		t.Fatal("dead jobs are kept for inspection")
+	}
+
+	q.jobs[job.ID].DeadAt = time.Now().Add(-DeadRetention - time.Minute)
+	q.Lease(ctx, "w1", time.Minute)
+	if _, ok := q.jobs[job.ID]; ok {
+		t.Fatal("dead jobs should be purged after DeadRetention")
+	}
+}
+
+func TestPoolRunsHandlers(t *testing.T) {
+	ctx := context.Background()
+	q := NewMemoryQueue()
+	pool := NewPool(q, 2)
+	pool.Poll = 10 * time.Millisecond
+
+	var ran atomic.Int32
+	pool.Handle("ok", func(ctx context.Context, job *Job) error {
+		ran.Add(1)
+		return nil
+	})
+	pool.Handle("panics", func(ctx context.Context, job *Job) error {
+		panic("boom")
+	})
+
+	for i := 0; i < 3; i++ {
+		q.Enqueue(ctx, "ok", i)
+	}
+	q.Enqueue(ctx, "panics", nil)
+	q.Enqueue(ctx, "unknown", nil)
+
+	pool.Start()
+	// the successful jobs are removed, the failed ones wait for a retry
+	settled := func() bool {
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		if len(q.jobs) != 2 {
+			return false
+		}
+		for _, job := range q.jobs {
+			if job.LastError == "" || job.LockedBy != "" {
+				return false
+			}
+		}
+		return true
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for !settled() {
+		if time.Now().After(deadline) {
+			t.Fatal("jobs did not settle")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	shutdown, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	if err := pool.Shutdown(shutdown); err != nil {
+		t.Fatal(err)
+	}
+	if ran.Load() != 3 {
+		t.Fatalf("ran %d jobs, want 3", ran.Load())
+	}
+}
+
+func TestPoolDrain(t *testing.T) {
+	ctx := context.Background()
+	q := NewMemoryQueue()
+	q.Enqueue(ctx, "ok", nil)
+	q.Enqueue(ctx, "ok", nil)
+	q.Enqueue(ctx, "flaky", nil)
+	q.Enqueue(ctx, "ok", nil, Delay(time.Hour))
+
+	var ran atomic.Int32
+	pool := NewPool(q, 1)
+	pool.Handle("ok", func(ctx context.Context, job *Job) error {
+		ran.Add(1)
+		return nil
+	})
+	pool.Handle("flaky", func(ctx context.Context, job *Job) error {
+		return errors.New("boom")
+	})
+
+	// the failed job waits for its retry and the delayed one isn't due, so draining stops
+	n, err := pool.Drain(ctx)
+	if err != nil || n != 3 || ran.Load() != 2 {
+		t.Fatalf("Drain = %d, %v after running %d, want 3 jobs run and 2 succeeded", n, err, ran.Load())
+	}
+	if len(q.jobs) != 2 {
+		t.Fatalf("%d jobs left, want the failed and the delayed one", len(q.jobs))
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	q.Enqueue(ctx, "ok", nil)
+	if n, err := pool.Drain(cancelled); n != 0 || !errors.Is(err, context.Canceled) {
+		t.Fatalf("Drain after cancel = %d, %v", n, err)
+	}
+}
@@ -0,0 +1,95 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// MemoryQueue keeps jobs in process memory, it is meant for development and
+// single instance deployments since jobs are lost on restart
+type MemoryQueue struct {
+	mu   sync.Mutex
+	seq  int
+	jobs map[string]*Job
+}
+
+func NewMemoryQueue() *MemoryQueue {
+	return &MemoryQueue{jobs: map[string]*Job{}}
+}
+
+func (q *MemoryQueue) Enqueue(ctx context.Context, jobType string, payload interface{}, opts ...Option) error {
+	job, err := newJob(jobType, payload, opts)
+	if err != nil {
+		return err
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.seq++
+	job.ID = strconv.Itoa(q.seq)
+	q.jobs[job.ID] = job
+	return nil
+}
+
+func (q *MemoryQueue) Lease(ctx context.Context, worker string, lease time.Duration) (*Job, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := time.Now()
+	var next *Job
+	for id, job := range q.jobs {
+		if job.Status == StatusDead && now.Sub(job.DeadAt) > DeadRetention {
+			delete(q.jobs, id)
+			continue
+		}
+		if job.Status != StatusPending || job.RunAt.After(now) || job.LockedUntil.After(now) {
+			continue
+		}
+		if next == nil || job.RunAt.Before(next.RunAt) {
+			next = job
+		}
+	}
+	if next == nil {
+		return nil, nil
+	}
+
+	next.Attempts++
+	next.LockedBy = worker
+	next.LockedUntil = now.Add(lease)
+	leased := *next
+	return &leased, nil
+}
+
+func (q *MemoryQueue) Complete(ctx context.Context, job *Job) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if stored, ok := q.jobs[job.ID]; ok && stored.LockedBy == job.LockedBy {
+		delete(q.jobs, job.ID)
+	}
+	return nil
+}
+
+func (q *MemoryQueue) Fail(ctx context.Context, job *Job, cause error) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	stored, ok := q.jobs[job.ID]
+	if !ok || stored.LockedBy != job.LockedBy {
+		return errors.New("job lease lost")
+	}
+
+	stored.LastError = cause.Error()
+	stored.LockedBy = ""
+	stored.LockedUntil = time.Time{}
+	if stored.Attempts >= stored.MaxAttempts {
+		stored.Status = StatusDead
+		stored.DeadAt = time.Now()
+	} else {
+		stored.RunAt = time.Now().Add(Backoff(stored.Attempts))
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoQueue keeps jobs in a collection, completed jobs are removed and
+// dead jobs stay with status "dead" for inspection until DeadRetention passes
+type MongoQueue struct {
+	collection *mongo.Collection
+}
+
+func NewMongoQueue(collection *mongo.Collection) *MongoQueue {
+	return &MongoQueue{collection: collection}
+}
+
+// EnsureIndexes creates the index used to find due jobs and the ttl index that purges dead ones
+func (q *MongoQueue) EnsureIndexes(ctx context.Context) error {
+	_, err := q.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "runAt", Value: 1}}},
+		{Keys: bson.D{{Key: "deadAt", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(int32(DeadRetention.Seconds()))},
+	})
+	if err != nil {
+		return err
+	}
+
+	// jobs that died before deadAt was recorded would otherwise be kept forever
+	_, err = q.collection.UpdateMany(ctx, bson.M{"status": StatusDead, "deadAt": bson.M{"$exists": false}}, bson.M{"$set": bson.M{"deadAt": time.Now()}})
+	return err
+}
+
+func (q *MongoQueue) Enqueue(ctx context.Context, jobType string, payload interface{}, opts ...Option) error {
+	job, err := newJob(jobType, payload, opts)
+	if err != nil {
+		return err
+	}
+
+	doc := bson.M{
+		"_id":         primitive.NewObjectID(),
+		"type":        job.Type,
+		"payload":     []byte(job.Payload),
+		"status":      job.Status,
+		"attempts":    0,
+		"maxAttempts": job.MaxAttempts,
+		"runAt":       job.RunAt,
+		"createdAt":   job.CreatedAt,
+	}
+	_, err = q.collection.InsertOne(ctx, doc)
+	return err
+}
+
+func (q *MongoQueue) Lease(ctx context.Context, worker string, lease time.Duration) (*Job, error) {
+	now := time.Now()
+	filter := bson.M{
+		"status": StatusPending,
+		"runAt":  bson.M{"$lte": now},
+		"$or": bson.A{
+			bson.M{"lockedUntil": bson.M{"$exists": false}},
+			bson.M{"lockedUntil": bson.M{"$lt": now}},
+		},
+	}
+	update := bson.M{
+		"$set": bson.M{"lockedBy": worker, "lockedUntil": now.Add(lease)},
+		"$inc": bson.M{"attempts": 1},
+	}
+	opts := options.FindOneAndUpdate().SetSort(bson.M{"runAt": 1}).SetReturnDocument(options.After)
+
+	var raw struct {
+		ID          primitive.ObjectID `bson:"_id"`
+		Type        string             `bson:"type"`
+		Payload     []byte             `bson:"payload"`
+		Status      string             `bson:"status"`
+		Attempts    int                `bson:"attempts"`
+		MaxAttempts int                `bson:"maxAttempts"`
+		RunAt       time.Time          `bson:"runAt"`
+		LockedBy    string             `bson:"lockedBy"`
+		LockedUntil time.Time          `bson:"lockedUntil"`
+		LastError   string             `bson:"lastError"`
+		CreatedAt   time.Time          `bson:"createdAt"`
+	}
+	err := q.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&raw)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &Job{
+		ID:          raw.ID.Hex(),
+		Type:        raw.Type,
+		Payload:     raw.Payload,
+		Status:      raw.Status,
+		Attempts:    raw.Attempts,
+		MaxAttempts: raw.MaxAttempts,
+		RunAt:       raw.RunAt,
+		LockedBy:    raw.LockedBy,
+		LockedUntil: raw.LockedUntil,
+		LastError:   raw.LastError,
+		CreatedAt:   raw.CreatedAt,
+	}, nil
+}
+
+func (q *MongoQueue) Complete(ctx context.Context, job *Job) error {
+	id, err := primitive.ObjectIDFromHex(job.ID)
+	if err != nil {
+		return err
+	}
+
+	_, err = q.collection.DeleteOne(ctx, bson.M{"_id": id, "lockedBy": job.LockedBy})
+	return err
+}
+
+func (q *MongoQueue) Fail(ctx context.Context, job *Job, cause error) error {
+	id, err := primitive.ObjectIDFromHex(job.ID)
+	if err != nil {
+		return err
+	}
+
+	set := bson.M{"lastError": cause.Error()}
+	if job.Attempts >= job.MaxAttempts {
+		set["status"] = StatusDead
+		set["deadAt"] = time.Now()
+	} else {
+		set["runAt"] = time.Now().Add(Backoff(job.Attempts))
+	}
+
+	_, err = q.collection.UpdateOne(ctx, bson.M{"_id": id, "lockedBy": job.LockedBy}, bson.M{"$set": set, "$unset": bson.M{"lockedBy": "", "lockedUntil": ""}})
+	return err
+}
@@ -0,0 +1,154 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type HandlerFunc func(ctx context.Context, job *Job) error
+
+// Pool runs jobs from a queue on a fixed number of workers
+type Pool struct {
+	Queue   Queue
+	Workers int
+	// Lease is how long a worker owns a job before another instance may retry it
+	Lease time.Duration
+	// Poll is the wait between lease attempts when the queue is empty
+	Poll time.Duration
+
+	handlers  map[string]HandlerFunc
+	stop      chan struct{}
+	wg        sync.WaitGroup
+	runCtx    context.Context
+	cancelRun context.CancelFunc
+}
+
+func NewPool(queue Queue, workers int) *Pool {
+	return &Pool{
+		Queue:    queue,
+		Workers:  workers,
+		Lease:    5 * time.Minute,
+		Poll:     time.Second,
+		handlers: map[string]HandlerFunc{},
+	}
+}
+
+// Handle registers the handler for a job type, it must be called before Start
+func (p *Pool) Handle(jobType string, fn HandlerFunc) {
+	p.handlers[jobType] = fn
+}
+
+func (p *Pool) Start() {
+	p.stop = make(chan struct{})
+	p.runCtx, p.cancelRun = context.WithCancel(context.Background())
+
+	for i := 0; i < p.Workers; i++ {
+		p.wg.Add(1)
+		go p.work(workerName(strconv.Itoa(i)))
+	}
+}
+
+// Drain runs the due jobs one at a time until none are left or ctx is done and returns how
+// many it ran. It is for deployments without a long-running process to Start the pool in.
+func (p *Pool) Drain(ctx context.Context) (int, error) {
+	worker := workerName("drain")
+	ran := 0
+	for ctx.Err() == nil {
+		job, err := p.Queue.Lease(ctx, worker, p.Lease)
+		if err != nil || job == nil {
+			return ran, err
+		}
+		p.run(ctx, job)
+		ran++
+	}
+	return ran, ctx.Err()
+}
+
+func workerName(id string) string {
+	host, _ := os.Hostname()
+	return host + ":" + strconv.Itoa(os.Getpid()) + ":" + id
+}
+
+// Shutdown stops leasing new jobs and waits for running ones to finish.
+// If ctx ends first the running jobs are cancelled and their leases expire.
+func (p *Pool) Shutdown(ctx context.Context) error {
+	close(p.stop)
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		p.cancelRun()
+		return nil
+	case <-ctx.Done():
+		p.cancelRun()
+		return ctx.Err()
+	}
+}
+
+func (p *Pool) work(worker string) {
+	defer p.wg.Done()
+
+	for {
+		select {
+		case <-p.stop:
+			return
+		default:
+		}
+
+		job, err := p.Queue.Lease(p.runCtx, worker, p.Lease)
+		if err != nil {
+			fmt.Printf("failed to lease job: %v\n", err)
+		}
+		if job == nil {
+			select {
+			case <-p.stop:
+				return
+			case <-time.After(p.Poll):
+			}
+			continue
+		}
+
+		p.run(p.runCtx, job)
+	}
+}
+
+func (p *Pool) run(ctx context.Context, job *Job) {
+	fn, ok := p.handlers[job.Type]
+	if !ok {
+		p.fail(ctx, job, fmt.Errorf("no handler for job type %q", job.Type))
+		return
+	}
+
+	err := func() (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("panic: %v", r)
+			}
+		}()
+		return fn(ctx, job)
+	}()
+	if err != nil {
+		p.fail(ctx, job, err)
+		return
+	}
+
+	if err := p.Queue.Complete(ctx, job); err != nil {
+		fmt.Printf("failed to complete job %s: %v\n", job.ID, err)
+	}
+}
+
+func (p *Pool) fail(ctx context.Context, job *Job, cause error) {
+	fmt.Printf("job %s (%s) attempt %d failed: %v\n", job.ID, job.Type, job.Attempts, cause)
+	if err := p.Queue.Fail(ctx, job, cause); err != nil {
+		fmt.Printf("failed to record job failure %s: %v\n", job.ID, err)
+	}
+}
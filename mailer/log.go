@@ -0,0 +1,41 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Log writes messages to a directory (one file per message) or to the standard
+// logger when no directory is set, for local development
+type Log struct {
+	Dir string
+}
+
+func (l *Log) Send(ctx context.Context, msg Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	content := fmt.Sprintf("To: %s\nSubject: %s\n\n%s\n", strings.Join(msg.To, ", "), msg.Subject, msg.Text)
+
+	if l.Dir == "" {
+		log.Printf("mail:\n%s", content)
+		return nil
+	}
+
+	if err := os.MkdirAll(l.Dir, 0o755); err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%d.eml", time.Now().UnixNano())
+	if msg.HTML != "" {
+		content += "\n--- html ---\n" + msg.HTML + "\n"
+	}
+
+	return os.WriteFile(filepath.Join(l.Dir, name), []byte(content), 0o644)
+}
@@ -0,0 +1,16 @@
+package mailer
+
+import "context"
+
+// Message is a single outgoing email
+type Message struct {
+	To      []string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// Mailer delivers messages, implementations must be safe for concurrent use
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
@@ -0,0 +1,40 @@
+package mailer
+
+import (
+	"bytes"
+	"embed"
+	htmltemplate "html/template"
+	texttemplate "text/template"
+)
+
+//go:embed templates
+var templateFS embed.FS
+
+var (
+	textTemplates = texttemplate.Must(texttemplate.ParseFS(templateFS, "templates/*.txt"))
+	htmlTemplates = htmltemplate.Must(htmltemplate.ParseFS(templateFS, "templates/*.html"))
+)
+
+// Render builds a message from the named template pair, e.g. "password_reset"
+// renders templates/password_reset.txt and templates/password_reset.html.
+// The text template must define a "<name>_subject" block.
+func Render(name string, to string, data any) (Message, error) {
+	var subject, text, html bytes.Buffer
+
+	if err := textTemplates.ExecuteTemplate(&subject, name+"_subject", data); err != nil {
+		return Message{}, err
+	}
+	if err := textTemplates.ExecuteTemplate(&text, name+".txt", data); err != nil {
+		return Message{}, err
+	}
+	if err := htmlTemplates.ExecuteTemplate(&html, name+".html", data); err != nil {
+		return Message{}, err
+	}
+
+	return Message{
+		To:      []string{to},
+		Subject: subject.String(),
+		Text:    text.String(),
+		HTML:    html.String(),
+	}, nil
+}
@@ -1,21 +1,40 @@
-package main
-
-import (
-	"context"
-
-	application "github.com/zillalikestocode/community-api/app"
-	"github.com/zillalikestocode/community-api/configs"
-)
-
-func main() {
-
-	client := configs.ConnectDB()
-	defer func() {
-		if err := client.Disconnect(context.TODO()); err != nil {
-			panic(err)
-		}
-	}()
-
-	app := application.New()
-	app.Start(context.TODO())
-}
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	application "github.com/zillalikestocode/community-api/app"
+	"github.com/zillalikestocode/community-api/configs"
+	"github.com/zillalikestocode/community-api/handler"
+)
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	client := configs.ConnectDB()
+	defer func() {
+		if err := client.Disconnect(context.TODO()); err != nil {
+			panic(err)
+		}
+	}()
+
+	// the unique indexes back checks the handlers rely on, so don't serve without them
+	if err := handler.EnsureIndexes(context.TODO()); err != nil {
+		fmt.Printf("failed to create indexes: %v\n", err)
+		client.Disconnect(context.TODO())
+		os.Exit(1)
+	}
+	if err := handler.Backfill(context.TODO()); err != nil {
+		fmt.Printf("failed to backfill: %v\n", err)
+	}
+
+	go handler.RunReminderScheduler(ctx)
+
+	app := application.New()
+	app.Start(ctx)
+}
@@ -0,0 +1,47 @@
+package models
+
+import (
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	AuditCreate  = "create"
+	AuditUpdate  = "update"
+	AuditDelete  = "delete"
+	AuditPublish = "publish"
+	AuditPin     = "pin"
+	AuditUnpin   = "unpin"
+	AuditReorder = "reorder"
+	AuditClose   = "close"
+	AuditHide    = "hide"
+	AuditUnhide  = "unhide"
+	AuditEnable  = "enable"
+)
+
+const (
+	AuditCommunity    = "community"
+	AuditAnnouncement = "announcement"
+	AuditEvent        = "event"
+	AuditPoll         = "poll"
+	AuditComment      = "comment"
+	AuditWebhook      = "webhook"
+	AuditChannel      = "channel"
+	AuditMember       = "member"
+)
+
+// AuditEntry is one administrative action on a community resource. Entries are never edited,
+// they only go away once they are older than AUDIT_RETENTION.
+type AuditEntry struct {
+	ID           primitive.ObjectID `json:"_id,omitempty" bson:"_id,omitempty"`
+	CommunityID  primitive.ObjectID `json:"communityId" bson:"communityId"`
+	ActorID      primitive.ObjectID `json:"actorId" bson:"actorId"`
+	ActorName    string             `json:"actorName,omitempty" bson:"-"`
+	ActorAvatar  *Image             `json:"actorAvatar,omitempty" bson:"-"`
+	Action       string             `json:"action" bson:"action"`
+	ResourceType string             `json:"resourceType" bson:"resourceType"`
+	ResourceID   primitive.ObjectID `json:"resourceId" bson:"resourceId"`
+	Before       bson.M             `json:"before,omitempty" bson:"before,omitempty"`
+	After        bson.M             `json:"after,omitempty" bson:"after,omitempty"`
+	CreatedAt    primitive.DateTime `json:"createdAt" bson:"createdAt"`
+}
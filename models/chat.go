@@ -0,0 +1,26 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+type Channel struct {
+	ID          primitive.ObjectID `json:"_id,omitempty" bson:"_id,omitempty"`
+	CommunityID primitive.ObjectID `json:"communityId" bson:"communityId"`
+	Name        string             `json:"name" bson:"name"`
+	Description string             `json:"description,omitempty" bson:"description,omitempty"`
+	// only community admins may post, everyone can read
+	AdminsOnly bool               `json:"adminsOnly" bson:"adminsOnly"`
+	CreatedBy  primitive.ObjectID `json:"createdBy" bson:"createdBy"`
+	CreatedAt  primitive.DateTime `json:"createdAt" bson:"createdAt"`
+}
+
+type ChatMessage struct {
+	ID          primitive.ObjectID  `json:"_id,omitempty" bson:"_id,omitempty"`
+	ChannelID   primitive.ObjectID  `json:"channelId" bson:"channelId"`
+	CommunityID primitive.ObjectID  `json:"communityId" bson:"communityId"`
+	Author      Author              `json:"author" bson:"author"`
+	Body        string              `json:"body" bson:"body"`
+	Mentions    []Mention           `json:"mentions,omitempty" bson:"mentionRefs,omitempty"`
+	CreatedAt   primitive.DateTime  `json:"createdAt" bson:"createdAt"`
+	EditedAt    *primitive.DateTime `json:"editedAt,omitempty" bson:"editedAt,omitempty"`
+	Deleted     bool                `json:"deleted,omitempty" bson:"deleted,omitempty"`
+}
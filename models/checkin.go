@@ -0,0 +1,13 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+// CheckIn records a member's attendance at an event, scanned by an admin
+type CheckIn struct {
+	ID          primitive.ObjectID `json:"_id,omitempty" bson:"_id,omitempty"`
+	CommunityID primitive.ObjectID `json:"communityId" bson:"communityId"`
+	EventID     primitive.ObjectID `json:"eventId" bson:"eventId"`
+	UserID      primitive.ObjectID `json:"userId" bson:"userId"`
+	CheckedInBy primitive.ObjectID `json:"checkedInBy" bson:"checkedInBy"`
+	CheckedInAt primitive.DateTime `json:"checkedInAt" bson:"checkedInAt"`
+}
@@ -0,0 +1,42 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+// things members can comment on or react to
+const (
+	TargetAnnouncement = "announcement"
+	TargetEvent        = "event"
+	TargetComment      = "comment"
+)
+
+type Comment struct {
+	ID          primitive.ObjectID `json:"_id,omitempty" bson:"_id,omitempty"`
+	CommunityID primitive.ObjectID `json:"communityId" bson:"communityId"`
+	TargetType  string             `json:"targetType" bson:"targetType"`
+	TargetID    primitive.ObjectID `json:"targetId" bson:"targetId"`
+	// set on replies, top level comments have no parent
+	ParentID   *primitive.ObjectID `json:"parentId,omitempty" bson:"parentId,omitempty"`
+	Author     Author              `json:"author" bson:"author"`
+	Body       string              `json:"body" bson:"body"`
+	BodyHTML   string              `json:"bodyHtml" bson:"bodyHtml,omitempty"`
+	Mentions   []Mention           `json:"mentions,omitempty" bson:"mentionRefs,omitempty"`
+	ReplyCount int                 `json:"replyCount" bson:"replyCount"`
+	Reactions  map[string]int      `json:"reactions,omitempty" bson:"reactions,omitempty"`
+	CreatedAt  primitive.DateTime  `json:"createdAt" bson:"createdAt"`
+	EditedAt   *primitive.DateTime `json:"editedAt,omitempty" bson:"editedAt,omitempty"`
+	Deleted    bool                `json:"deleted,omitempty" bson:"deleted,omitempty"`
+	// hidden by a moderator, only moderators and the author still see the body
+	Hidden   bool                `json:"hidden,omitempty" bson:"hidden,omitempty"`
+	HiddenBy *primitive.ObjectID `json:"hiddenBy,omitempty" bson:"hiddenBy,omitempty"`
+}
+
+// Reaction is one member's emoji on an announcement, event or comment
+type Reaction struct {
+	ID          primitive.ObjectID `json:"_id,omitempty" bson:"_id,omitempty"`
+	CommunityID primitive.ObjectID `json:"communityId" bson:"communityId"`
+	TargetType  string             `json:"targetType" bson:"targetType"`
+	TargetID    primitive.ObjectID `json:"targetId" bson:"targetId"`
+	UserID      primitive.ObjectID `json:"userId" bson:"userId"`
+	Emoji       string             `json:"emoji" bson:"emoji"`
+	CreatedAt   primitive.DateTime `json:"createdAt" bson:"createdAt"`
+}
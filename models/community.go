@@ -1,37 +1,102 @@
-package models
-
-import "go.mongodb.org/mongo-driver/bson/primitive"
-
-type Member struct {
-	ID    primitive.ObjectID `json:"id" bson:"id"`
-	Admin bool               `json:"admin" bson:"admin"`
-}
-
-type Announcement struct {
-	ID      primitive.ObjectID `json:"id" bson:"id"`
-	Creator struct {
-		Name string             `json:"name" bson:"name"`
-		ID   primitive.ObjectID `json:"id" bson:"id"`
-	}
-	Date    primitive.DateTime `json:"date" bson:"date"`
-	Message string             `json:"message" bson:"message"`
-}
-
-type Event struct {
-	ID          primitive.ObjectID `json:"id" bson:"id"`
-	Name        string             `json:"name" bson:"name"`
-	Description string             `json:"description" bson:"description"`
-	Date        primitive.DateTime `json:"date" bson:"date"`
-	Time        string             `json:"time" bson:"time"`
-	Address     string             `json:"address" bson:"address"`
-}
-
-type Community struct {
-	ID            primitive.ObjectID `json:"_id,omitempty" bson:"_id,omitempty"`
-	Name          string             `json:"name,omitempty" bson:"name,omitempty" validator:"required"`
-	Description   string             `json:"description,omitempty" bson:"description,omitempty" validator:"required"`
-	Owner         primitive.ObjectID `json:"owner,omitempty" bson:"owner,omitempty" validator:"required"`
-	Members       []Member           `json:"members,omitempty" bson:"members,omitempty"`
-	Announcements []Announcement     `json:"announcements,omitempty" bson:"announcements,omitempty"`
-	Events        []Event            `json:"events,omitempty" bson:"events,omitempty"`
-}
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+type Member struct {
+	ID    primitive.ObjectID `json:"id" bson:"id"`
+	Admin bool               `json:"admin" bson:"admin"`
+	// unset for members who joined before it was recorded
+	JoinedAt *primitive.DateTime `json:"joinedAt,omitempty" bson:"joinedAt,omitempty"`
+}
+
+type Announcement struct {
+	ID      primitive.ObjectID `json:"id" bson:"id"`
+	Creator Author             `json:"creator" bson:"creator"`
+	// when the announcement is, or will be, published
+	Date     primitive.DateTime  `json:"date" bson:"date"`
+	ExpireAt *primitive.DateTime `json:"expireAt,omitempty" bson:"expireAt,omitempty"`
+	// Markdown source, MessageHTML is the sanitized rendering of it
+	Message     string    `json:"message" bson:"message"`
+	MessageHTML string    `json:"messageHtml" bson:"messageHtml,omitempty"`
+	Mentions    []Mention `json:"mentions,omitempty" bson:"mentionRefs,omitempty"`
+	Hashtags    []string  `json:"hashtags,omitempty" bson:"hashtags,omitempty"`
+	// drafts are only visible to admins until published
+	Draft bool `json:"draft,omitempty" bson:"draft,omitempty"`
+	// set until the publisher has sent the announcement.created notifications
+	Scheduled bool                `json:"scheduled,omitempty" bson:"scheduled,omitempty"`
+	EditedAt  *primitive.DateTime `json:"editedAt,omitempty" bson:"editedAt,omitempty"`
+	Pinned    bool                `json:"pinned,omitempty" bson:"-"`
+	// kept up to date as comments and reactions are added and removed
+	CommentCount int                  `json:"commentCount" bson:"commentCount,omitempty"`
+	Reactions    map[string]int       `json:"reactions,omitempty" bson:"reactions,omitempty"`
+	Attachments  []primitive.ObjectID `json:"attachments,omitempty" bson:"attachments,omitempty"`
+}
+
+// AnnouncementEdit records one change to an announcement
+type AnnouncementEdit struct {
+	ID             primitive.ObjectID `json:"id" bson:"_id"`
+	CommunityID    primitive.ObjectID `json:"communityId" bson:"communityId"`
+	AnnouncementID primitive.ObjectID `json:"announcementId" bson:"announcementId"`
+	EditedBy       primitive.ObjectID `json:"editedBy" bson:"editedBy"`
+	EditedAt       primitive.DateTime `json:"editedAt" bson:"editedAt"`
+	Changes        []FieldChange      `json:"changes" bson:"changes"`
+}
+
+type FieldChange struct {
+	Field string      `json:"field" bson:"field"`
+	From  interface{} `json:"from" bson:"from"`
+	To    interface{} `json:"to" bson:"to"`
+}
+
+type Event struct {
+	ID               primitive.ObjectID   `json:"id" bson:"id"`
+	Name             string               `json:"name" bson:"name"`
+	Description      string               `json:"description" bson:"description"`
+	DescriptionHTML  string               `json:"descriptionHtml" bson:"descriptionHtml,omitempty"`
+	Hashtags         []string             `json:"hashtags,omitempty" bson:"hashtags,omitempty"`
+	Date             primitive.DateTime   `json:"date" bson:"date"`
+	Time             string               `json:"time" bson:"time"`
+	Address          string               `json:"address" bson:"address"`
+	Location         *Location            `json:"location,omitempty" bson:"location,omitempty"`
+	Attendees        []primitive.ObjectID `json:"attendees,omitempty" bson:"attendees,omitempty"`
+	ReminderAudience string               `json:"reminderAudience,omitempty" bson:"reminderAudience,omitempty"`
+	CommentCount     int                  `json:"commentCount" bson:"commentCount,omitempty"`
+	Reactions        map[string]int       `json:"reactions,omitempty" bson:"reactions,omitempty"`
+	Attachments      []primitive.ObjectID `json:"attachments,omitempty" bson:"attachments,omitempty"`
+}
+
+type Community struct {
+	ID              primitive.ObjectID `json:"_id,omitempty" bson:"_id,omitempty"`
+	Name            string             `json:"name,omitempty" bson:"name,omitempty" validator:"required"`
+	Description     string             `json:"description,omitempty" bson:"description,omitempty" validator:"required"`
+	DescriptionHTML string             `json:"descriptionHtml,omitempty" bson:"descriptionHtml,omitempty"`
+	Category        string             `json:"category,omitempty" bson:"category,omitempty"`
+	Tags            []string           `json:"tags,omitempty" bson:"tags,omitempty"`
+	Avatar          *Image             `json:"avatar,omitempty" bson:"avatar,omitempty"`
+	Banner          *Image             `json:"banner,omitempty" bson:"banner,omitempty"`
+	Owner           primitive.ObjectID `json:"owner,omitempty" bson:"owner,omitempty" validator:"required"`
+	Members         []Member           `json:"members,omitempty" bson:"members,omitempty"`
+	Announcements   []Announcement     `json:"announcements,omitempty" bson:"announcements,omitempty"`
+	// pinned announcement ids, in the order they are listed
+	PinnedAnnouncements []primitive.ObjectID `json:"pinnedAnnouncements,omitempty" bson:"pinnedAnnouncements,omitempty"`
+	Events              []Event              `json:"events,omitempty" bson:"events,omitempty"`
+	// bytes of uploaded files, limited by the storage quota
+	StorageUsed int64 `json:"storageUsed,omitempty" bson:"storageUsed,omitempty"`
+}
+
+// GeoPoint is a GeoJSON point, Coordinates are [longitude, latitude]
+type GeoPoint struct {
+	Type        string    `json:"type" bson:"type"`
+	Coordinates []float64 `json:"coordinates" bson:"coordinates"`
+}
+
+// Location is where an event happens, in person, online or both
+type Location struct {
+	Street     string    `json:"street,omitempty" bson:"street,omitempty"`
+	City       string    `json:"city,omitempty" bson:"city,omitempty"`
+	Region     string    `json:"region,omitempty" bson:"region,omitempty"`
+	PostalCode string    `json:"postalCode,omitempty" bson:"postalCode,omitempty"`
+	Country    string    `json:"country,omitempty" bson:"country,omitempty"`
+	Point      *GeoPoint `json:"point,omitempty" bson:"point,omitempty"`
+	OnlineURL  string    `json:"onlineUrl,omitempty" bson:"onlineUrl,omitempty"`
+}
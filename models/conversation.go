@@ -0,0 +1,28 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+type Participant struct {
+	ID         primitive.ObjectID  `json:"id" bson:"id"`
+	LastReadAt *primitive.DateTime `json:"lastReadAt,omitempty" bson:"lastReadAt,omitempty"`
+}
+
+type Conversation struct {
+	ID            primitive.ObjectID  `json:"_id,omitempty" bson:"_id,omitempty"`
+	Participants  []Participant       `json:"participants" bson:"participants"`
+	CreatedBy     primitive.ObjectID  `json:"createdBy" bson:"createdBy"`
+	CreatedAt     primitive.DateTime  `json:"createdAt" bson:"createdAt"`
+	LastMessageAt *primitive.DateTime `json:"lastMessageAt,omitempty" bson:"lastMessageAt,omitempty"`
+	// messages sent from now on are deleted after this many days, 0 keeps them forever.
+	// Changing it doesn't touch messages that were already sent.
+	RetentionDays int `json:"retentionDays" bson:"retentionDays"`
+}
+
+type DirectMessage struct {
+	ID             primitive.ObjectID  `json:"_id,omitempty" bson:"_id,omitempty"`
+	ConversationID primitive.ObjectID  `json:"conversationId" bson:"conversationId"`
+	SenderID       primitive.ObjectID  `json:"senderId" bson:"senderId"`
+	Body           string              `json:"body" bson:"body"`
+	CreatedAt      primitive.DateTime  `json:"createdAt" bson:"createdAt"`
+	ExpiresAt      *primitive.DateTime `json:"-" bson:"expiresAt,omitempty"`
+}
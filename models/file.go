@@ -0,0 +1,19 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+// File is an upload kept in the blob store, optionally attached to an announcement or event
+type File struct {
+	ID          primitive.ObjectID  `json:"_id,omitempty" bson:"_id,omitempty"`
+	CommunityID primitive.ObjectID  `json:"communityId" bson:"communityId"`
+	UploadedBy  primitive.ObjectID  `json:"uploadedBy" bson:"uploadedBy"`
+	Name        string              `json:"name" bson:"name"`
+	ContentType string              `json:"contentType" bson:"contentType"`
+	Size        int64               `json:"size" bson:"size"`
+	Key         string              `json:"-" bson:"key"`
+	TargetType  string              `json:"targetType,omitempty" bson:"targetType,omitempty"`
+	TargetID    *primitive.ObjectID `json:"targetId,omitempty" bson:"targetId,omitempty"`
+	CreatedAt   primitive.DateTime  `json:"createdAt" bson:"createdAt"`
+	// signed download link, filled in when the file is returned
+	URL string `json:"url,omitempty" bson:"-"`
+}
@@ -0,0 +1,13 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+// Image is an uploaded avatar or banner, stored resized to each of Widths
+type Image struct {
+	// changes on every upload so the public links can be cached forever
+	Version primitive.ObjectID `json:"-" bson:"version"`
+	Format  string             `json:"-" bson:"format"`
+	Widths  []int              `json:"-" bson:"widths"`
+	// public links keyed by width, filled in when the owner is returned
+	URLs map[string]string `json:"urls,omitempty" bson:"-"`
+}
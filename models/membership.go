@@ -0,0 +1,17 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+const (
+	MembershipJoined = "joined"
+	MembershipLeft   = "left"
+)
+
+// MembershipChange records a member joining or leaving a community, for analytics
+type MembershipChange struct {
+	ID          primitive.ObjectID `json:"_id,omitempty" bson:"_id,omitempty"`
+	CommunityID primitive.ObjectID `json:"communityId" bson:"communityId"`
+	UserID      primitive.ObjectID `json:"userId" bson:"userId"`
+	Type        string             `json:"type" bson:"type"`
+	At          primitive.DateTime `json:"at" bson:"at"`
+}
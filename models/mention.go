@@ -0,0 +1,16 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+const (
+	MentionUser     = "user"
+	MentionEveryone = "everyone"
+	MentionAdmins   = "admins"
+)
+
+// Mention is a resolved @mention, either of one member or a broadcast to a group of them
+type Mention struct {
+	Type     string              `json:"type" bson:"type"`
+	UserID   *primitive.ObjectID `json:"userId,omitempty" bson:"userId,omitempty"`
+	Username string              `json:"username,omitempty" bson:"username,omitempty"`
+}
@@ -0,0 +1,24 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+type Notification struct {
+	ID          primitive.ObjectID     `json:"_id,omitempty" bson:"_id,omitempty"`
+	UserID      primitive.ObjectID     `json:"userId" bson:"userId"`
+	CommunityID primitive.ObjectID     `json:"communityId,omitempty" bson:"communityId,omitempty"`
+	Type        string                 `json:"type" bson:"type"`
+	Title       string                 `json:"title" bson:"title"`
+	Body        string                 `json:"body,omitempty" bson:"body,omitempty"`
+	Data        map[string]interface{} `json:"data,omitempty" bson:"data,omitempty"`
+	Read        bool                   `json:"read" bson:"read"`
+	CreatedAt   primitive.DateTime     `json:"createdAt" bson:"createdAt"`
+	ReadAt      *primitive.DateTime    `json:"readAt,omitempty" bson:"readAt,omitempty"`
+}
+
+// NotificationPreference lists the notification types a user has muted in a community
+type NotificationPreference struct {
+	ID          primitive.ObjectID `json:"_id,omitempty" bson:"_id,omitempty"`
+	UserID      primitive.ObjectID `json:"userId" bson:"userId"`
+	CommunityID primitive.ObjectID `json:"communityId" bson:"communityId"`
+	Muted       []string           `json:"muted" bson:"muted"`
+}
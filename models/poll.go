@@ -0,0 +1,45 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+type PollOption struct {
+	ID    int    `json:"id" bson:"id"`
+	Text  string `json:"text" bson:"text"`
+	Votes int    `json:"votes" bson:"votes"`
+}
+
+type Poll struct {
+	ID          primitive.ObjectID `json:"_id,omitempty" bson:"_id,omitempty"`
+	CommunityID primitive.ObjectID `json:"communityId" bson:"communityId"`
+	Creator     Author             `json:"creator" bson:"creator"`
+	Question    string             `json:"question" bson:"question"`
+	Options     []PollOption       `json:"options" bson:"options"`
+	// members may pick more than one option
+	Multiple bool `json:"multiple" bson:"multiple"`
+	// who voted for what is never shown, only the totals
+	Anonymous bool `json:"anonymous" bson:"anonymous"`
+	// totals are only shown once the poll has closed
+	HideResults bool                `json:"hideResults" bson:"hideResults"`
+	ClosesAt    *primitive.DateTime `json:"closesAt,omitempty" bson:"closesAt,omitempty"`
+	VoterCount  int                 `json:"voterCount" bson:"voterCount"`
+	CreatedAt   primitive.DateTime  `json:"createdAt" bson:"createdAt"`
+	// set once the poll.closed event has been sent
+	Finalized bool `json:"-" bson:"finalized,omitempty"`
+	// filled in when the poll is returned
+	Closed        bool  `json:"closed" bson:"-"`
+	ResultsHidden bool  `json:"resultsHidden,omitempty" bson:"-"`
+	MyVote        []int `json:"myVote,omitempty" bson:"-"`
+}
+
+// PollVote is one member's current choice in a poll
+type PollVote struct {
+	ID          primitive.ObjectID `json:"_id,omitempty" bson:"_id,omitempty"`
+	PollID      primitive.ObjectID `json:"pollId" bson:"pollId"`
+	CommunityID primitive.ObjectID `json:"communityId" bson:"communityId"`
+	UserID      primitive.ObjectID `json:"userId" bson:"userId"`
+	Options     []int              `json:"options" bson:"options"`
+	// a copy of the poll's closesAt, the vote can only be changed before it
+	ClosesAt  *primitive.DateTime `json:"-" bson:"closesAt,omitempty"`
+	CreatedAt primitive.DateTime  `json:"createdAt" bson:"createdAt"`
+	UpdatedAt primitive.DateTime  `json:"updatedAt" bson:"updatedAt"`
+}
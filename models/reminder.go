@@ -0,0 +1,27 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+const (
+	// who gets an event's reminders, every member or only those who rsvp'd
+	ReminderAudienceAll  = "all"
+	ReminderAudienceRSVP = "rsvp"
+
+	ReminderPending = "pending"
+	ReminderSent    = "sent"
+	ReminderSkipped = "skipped"
+)
+
+// Reminder is a scheduled reminder for one event at one offset before it starts
+type Reminder struct {
+	ID          primitive.ObjectID `json:"_id,omitempty" bson:"_id,omitempty"`
+	CommunityID primitive.ObjectID `json:"communityId" bson:"communityId"`
+	EventID     primitive.ObjectID `json:"eventId" bson:"eventId"`
+	Offset      string             `json:"offset" bson:"offset"`
+	// the event start the reminder was scheduled for
+	StartsAt    primitive.DateTime  `json:"startsAt" bson:"startsAt"`
+	SendAt      primitive.DateTime  `json:"sendAt" bson:"sendAt"`
+	Status      string              `json:"status" bson:"status"`
+	LockedUntil *primitive.DateTime `json:"-" bson:"lockedUntil,omitempty"`
+	SentAt      *primitive.DateTime `json:"sentAt,omitempty" bson:"sentAt,omitempty"`
+}
@@ -0,0 +1,19 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+const (
+	TokenPasswordReset     = "password_reset"
+	TokenEmailVerification = "email_verification"
+)
+
+// UserToken is a single-use secret sent to a user, only its hash is stored
+type UserToken struct {
+	ID        primitive.ObjectID  `json:"_id,omitempty" bson:"_id,omitempty"`
+	UserID    primitive.ObjectID  `json:"userId" bson:"userId"`
+	Purpose   string              `json:"purpose" bson:"purpose"`
+	Hash      string              `json:"-" bson:"hash"`
+	CreatedAt primitive.DateTime  `json:"createdAt" bson:"createdAt"`
+	ExpiresAt primitive.DateTime  `json:"expiresAt" bson:"expiresAt"`
+	UsedAt    *primitive.DateTime `json:"usedAt,omitempty" bson:"usedAt,omitempty"`
+}
@@ -1,10 +1,31 @@
-package models
-
-import "go.mongodb.org/mongo-driver/bson/primitive"
-
-type User struct {
-	ID       primitive.ObjectID `json:"_id,omitempty" bson:"_id,omitempty"`
-	Name     string             `json:"name,omitempty" bson:"name,omitempty" validator:"required"`
-	Email    string             `json:"email,omitempty" bson:"email,omitempty" validator:"required"`
-	Password string             `json:"password,omitempty" bson:"password,omitempty" validator:"required"`
-}
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+// Author is the user shown on something they wrote. The avatar isn't stored with it but
+// looked up when it is read, so a new one shows everywhere.
+type Author struct {
+	ID     primitive.ObjectID `json:"id" bson:"id"`
+	Name   string             `json:"name" bson:"name"`
+	Avatar *Image             `json:"avatar,omitempty" bson:"-"`
+}
+
+type User struct {
+	ID                primitive.ObjectID   `json:"_id,omitempty" bson:"_id,omitempty"`
+	Name              string               `json:"name,omitempty" bson:"name,omitempty" validator:"required"`
+	Username          string               `json:"username,omitempty" bson:"username,omitempty"`
+	Avatar            *Image               `json:"avatar,omitempty" bson:"avatar,omitempty"`
+	Banner            *Image               `json:"banner,omitempty" bson:"banner,omitempty"`
+	Email             string               `json:"email,omitempty" bson:"email,omitempty" validator:"required"`
+	Password          string               `json:"password,omitempty" bson:"password,omitempty" validator:"required"`
+	Verified          bool                 `json:"verified" bson:"verified"`
+	VerifiedAt        *primitive.DateTime  `json:"verifiedAt,omitempty" bson:"verifiedAt,omitempty"`
+	TwoFactorEnabled  bool                 `json:"twoFactorEnabled" bson:"twoFactorEnabled"`
+	TwoFactorSecret   string               `json:"-" bson:"twoFactorSecret,omitempty"`
+	TwoFactorPending  string               `json:"-" bson:"twoFactorPending,omitempty"`
+	TwoFactorLastStep int64                `json:"-" bson:"twoFactorLastStep,omitempty"`
+	RecoveryCodes     []string             `json:"-" bson:"recoveryCodes,omitempty"`
+	Blocked           []primitive.ObjectID `json:"-" bson:"blocked,omitempty"`
+	SessionVersion    int                  `json:"-" bson:"sessionVersion,omitempty"`
+	PasswordChangedAt *primitive.DateTime  `json:"passwordChangedAt,omitempty" bson:"passwordChangedAt,omitempty"`
+}
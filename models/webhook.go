@@ -0,0 +1,37 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+type Webhook struct {
+	ID                  primitive.ObjectID  `json:"_id,omitempty" bson:"_id,omitempty"`
+	CommunityID         primitive.ObjectID  `json:"communityId" bson:"communityId"`
+	URL                 string              `json:"url" bson:"url"`
+	Secret              string              `json:"-" bson:"secret"`
+	Events              []string            `json:"events" bson:"events"`
+	Active              bool                `json:"active" bson:"active"`
+	ConsecutiveFailures int                 `json:"consecutiveFailures" bson:"consecutiveFailures"`
+	DisabledAt          *primitive.DateTime `json:"disabledAt,omitempty" bson:"disabledAt,omitempty"`
+	CreatedBy           primitive.ObjectID  `json:"createdBy" bson:"createdBy"`
+	CreatedAt           primitive.DateTime  `json:"createdAt" bson:"createdAt"`
+}
+
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	DeliveryFailed    = "failed"
+)
+
+type WebhookDelivery struct {
+	ID             primitive.ObjectID  `json:"_id,omitempty" bson:"_id,omitempty"`
+	WebhookID      primitive.ObjectID  `json:"webhookId" bson:"webhookId"`
+	CommunityID    primitive.ObjectID  `json:"communityId" bson:"communityId"`
+	Event          string              `json:"event" bson:"event"`
+	Payload        string              `json:"payload" bson:"payload"`
+	Status         string              `json:"status" bson:"status"`
+	Attempts       int                 `json:"attempts" bson:"attempts"`
+	ResponseStatus int                 `json:"responseStatus,omitempty" bson:"responseStatus,omitempty"`
+	Error          string              `json:"error,omitempty" bson:"error,omitempty"`
+	CreatedAt      primitive.DateTime  `json:"createdAt" bson:"createdAt"`
+	LastAttemptAt  *primitive.DateTime `json:"lastAttemptAt,omitempty" bson:"lastAttemptAt,omitempty"`
+	NextAttemptAt  *primitive.DateTime `json:"nextAttemptAt,omitempty" bson:"nextAttemptAt,omitempty"`
+}
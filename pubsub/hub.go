@@ -0,0 +1,210 @@
+package pubsub
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultHistoryAge is how long a Hub keeps messages for Last-Event-ID resume
+const DefaultHistoryAge = 2 * time.Minute
+
+const (
+	// messages kept per topic for Last-Event-ID resume
+	historySize = 100
+	bufferSize  = 64
+)
+
+type subscriber struct {
+	topics map[string]bool
+	ch     chan Message
+}
+
+// Hub is an in-process Broker. Messages are kept for resuming for HistoryAge, and only
+// while a topic has subscribers or had one within HistoryAge, so a client can reconnect.
+type Hub struct {
+	HistoryAge time.Duration
+	// Ephemeral reports messages that are only delivered live and never kept, such as
+	// typing indicators
+	Ephemeral func(topic string, eventType string) bool
+
+	mu          sync.Mutex
+	seq         uint64
+	history     map[string][]Message
+	subscribers map[*subscriber]struct{}
+	// subscriber counts per topic, and when topics without any lost their last one
+	counts    map[string]int
+	idleSince map[string]time.Time
+	swept     time.Time
+	now       func() time.Time
+}
+
+func NewHub() *Hub {
+	return &Hub{HistoryAge: DefaultHistoryAge}
+}
+
+// init sets up the maps on first use so a zero Hub works, called with the lock held
+func (h *Hub) init() {
+	if h.subscribers == nil {
+		h.history = map[string][]Message{}
+		h.subscribers = map[*subscriber]struct{}{}
+		h.counts = map[string]int{}
+		h.idleSince = map[string]time.Time{}
+	}
+	if h.now == nil {
+		h.now = time.Now
+	}
+}
+
+func (h *Hub) Publish(ctx context.Context, topic string, eventType string, data interface{}) (Message, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.init()
+
+	now := h.now()
+	h.seq++
+	msg := Message{
+		ID:    strconv.FormatUint(h.seq, 10),
+		Topic: topic,
+		Type:  eventType,
+		Data:  data,
+		Time:  now,
+	}
+
+	h.sweep(now)
+	if h.retained(topic, now) && (h.Ephemeral == nil || !h.Ephemeral(topic, eventType)) {
+		history := append(h.fresh(topic, now), msg)
+		if len(history) > historySize {
+			history = history[len(history)-historySize:]
+		}
+		h.history[topic] = history
+	}
+
+	for sub := range h.subscribers {
+		if !sub.topics[topic] {
+			continue
+		}
+		select {
+		case sub.ch <- msg:
+		default:
+			// slow subscriber, drop it so it reconnects and resumes from history
+			h.remove(sub)
+		}
+	}
+
+	return msg, nil
+}
+
+func (h *Hub) Subscribe(ctx context.Context, topics []string, lastID string) (<-chan Message, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.init()
+
+	now := h.now()
+	sub := &subscriber{topics: map[string]bool{}, ch: make(chan Message, bufferSize+historySize)}
+	for _, topic := range topics {
+		sub.topics[topic] = true
+	}
+
+	if lastID != "" {
+		if after, err := strconv.ParseUint(lastID, 10, 64); err == nil {
+			var missed []Message
+			for topic := range sub.topics {
+				for _, msg := range h.fresh(topic, now) {
+					if id, _ := strconv.ParseUint(msg.ID, 10, 64); id > after {
+						missed = append(missed, msg)
+					}
+				}
+			}
+			sort.Slice(missed, func(i, j int) bool {
+				a, _ := strconv.ParseUint(missed[i].ID, 10, 64)
+				b, _ := strconv.ParseUint(missed[j].ID, 10, 64)
+				return a < b
+			})
+			if len(missed) > cap(sub.ch) {
+				missed = missed[len(missed)-cap(sub.ch):]
+			}
+			for _, msg := range missed {
+				sub.ch <- msg
+			}
+		}
+	}
+
+	h.subscribers[sub] = struct{}{}
+	for topic := range sub.topics {
+		h.counts[topic]++
+		delete(h.idleSince, topic)
+	}
+
+	go func() {
+		<-ctx.Done()
+		h.mu.Lock()
+		h.remove(sub)
+		h.mu.Unlock()
+	}()
+
+	return sub.ch, nil
+}
+
+// remove closes the subscriber channel, called with the lock held
+func (h *Hub) remove(sub *subscriber) {
+	if _, ok := h.subscribers[sub]; !ok {
+		return
+	}
+	delete(h.subscribers, sub)
+	close(sub.ch)
+
+	for topic := range sub.topics {
+		if h.counts[topic]--; h.counts[topic] <= 0 {
+			delete(h.counts, topic)
+			h.idleSince[topic] = h.now()
+		}
+	}
+}
+
+// retained reports whether messages on the topic are kept, called with the lock held
+func (h *Hub) retained(topic string, now time.Time) bool {
+	if h.counts[topic] > 0 {
+		return true
+	}
+	idle, ok := h.idleSince[topic]
+	return ok && now.Sub(idle) < h.HistoryAge
+}
+
+// fresh drops the topic's messages older than HistoryAge and returns the rest, called
+// with the lock held
+func (h *Hub) fresh(topic string, now time.Time) []Message {
+	history := h.history[topic]
+	i := 0
+	for i < len(history) && now.Sub(history[i].Time) >= h.HistoryAge {
+		i++
+	}
+	if i == len(history) {
+		delete(h.history, topic)
+		return nil
+	}
+	history = history[i:]
+	h.history[topic] = history
+	return history
+}
+
+// sweep drops the history of topics nobody has subscribed to for HistoryAge and expired
+// messages everywhere else, at most once per HistoryAge. Called with the lock held.
+func (h *Hub) sweep(now time.Time) {
+	if now.Sub(h.swept) < h.HistoryAge {
+		return
+	}
+	h.swept = now
+
+	for topic, idle := range h.idleSince {
+		if now.Sub(idle) >= h.HistoryAge {
+			delete(h.idleSince, topic)
+			delete(h.history, topic)
+		}
+	}
+	for topic := range h.history {
+		h.fresh(topic, now)
+	}
+}
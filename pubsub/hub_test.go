@@ -0,0 +1,221 @@
+package pubsub
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// a hub on a clock the test moves by hand
+func testHub() (*Hub, *time.Time) {
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	hub := NewHub()
+	hub.now = func() time.Time { return now }
+	return hub, &now
+}
+
+// receive returns the IDs waiting on ch without blocking
+func receive(ch <-chan Message) []string {
+	var ids []string
+	for {
+		select {
+		case msg, ok := <-ch:
+			if !ok {
+				return ids
+			}
+			ids = append(ids, msg.ID)
+		default:
+			return ids
+		}
+	}
+}
+
+func equal(a []string, b ...string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// waitClosed waits for the hub to notice a cancelled subscription
+func waitClosed(t *testing.T, ch <-chan Message) {
+	t.Helper()
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case _, ok := <-ch:
+			if !ok {
+				return
+			}
+		case <-timeout:
+			t.Fatal("subscription was not closed")
+		}
+	}
+}
+
+func TestPublishSubscribe(t *testing.T) {
+	hub, _ := testHub()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ch, _ := hub.Subscribe(ctx, []string{"community:a", "community:b"}, "")
+	hub.Publish(ctx, "community:a", "post", 1)
+	hub.Publish(ctx, "community:c", "post", 2)
+	msg, _ := hub.Publish(ctx, "community:b", "post", 3)
+
+	if got := receive(ch); !equal(got, "1", "3") {
+		t.Errorf("received %v, want [1 3]", got)
+	}
+	if msg.Topic != "community:b" || msg.Type != "post" || msg.Data != 3 {
+		t.Errorf("Publish = %+v", msg)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	hub, now := testHub()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// only topics someone listens to keep history
+	hub.Publish(ctx, "community:a", "post", nil)
+	hub.Subscribe(ctx, []string{"community:a", "community:b"}, "")
+	hub.Publish(ctx, "community:a", "post", nil)
+	hub.Publish(ctx, "community:b", "post", nil)
+	hub.Publish(ctx, "community:a", "post", nil)
+
+	ch, _ := hub.Subscribe(ctx, []string{"community:b", "community:a"}, "2")
+	if got := receive(ch); !equal(got, "3", "4") {
+		t.Errorf("replayed %v, want [3 4]", got)
+	}
+	ch, _ = hub.Subscribe(ctx, []string{"community:a"}, "0")
+	if got := receive(ch); !equal(got, "2", "4") {
+		t.Errorf("replayed %v, want [2 4]", got)
+	}
+	ch, _ = hub.Subscribe(ctx, []string{"community:a"}, "not-an-id")
+	if got := receive(ch); len(got) != 0 {
+		t.Errorf("replayed %v for an invalid id", got)
+	}
+
+	// messages older than HistoryAge aren't replayed
+	*now = now.Add(time.Minute)
+	hub.Publish(ctx, "community:a", "post", nil)
+	*now = now.Add(DefaultHistoryAge - time.Second)
+	ch, _ = hub.Subscribe(ctx, []string{"community:a"}, "0")
+	if got := receive(ch); !equal(got, "5") {
+		t.Errorf("replayed %v after expiry, want [5]", got)
+	}
+}
+
+func TestHistoryIsCapped(t *testing.T) {
+	hub, _ := testHub()
+	ctx := context.Background()
+	hub.Subscribe(ctx, []string{"community:a"}, "")
+
+	for i := 0; i < historySize+10; i++ {
+		hub.Publish(ctx, "community:a", "post", nil)
+	}
+	if got := len(hub.history["community:a"]); got != historySize {
+		t.Errorf("%d messages kept, want %d", got, historySize)
+	}
+}
+
+func TestEphemeral(t *testing.T) {
+	hub, _ := testHub()
+	hub.Ephemeral = func(topic string, eventType string) bool {
+		return topic == "user:a" || eventType == "typing"
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	live, _ := hub.Subscribe(ctx, []string{"user:a", "channel:a"}, "")
+	hub.Publish(ctx, "user:a", "notification", nil)
+	hub.Publish(ctx, "channel:a", "typing", nil)
+	hub.Publish(ctx, "channel:a", "message", nil)
+
+	// ephemeral messages are still delivered live
+	if got := receive(live); !equal(got, "1", "2", "3") {
+		t.Errorf("received %v, want [1 2 3]", got)
+	}
+	ch, _ := hub.Subscribe(ctx, []string{"user:a", "channel:a"}, "0")
+	if got := receive(ch); !equal(got, "3") {
+		t.Errorf("replayed %v, want [3]", got)
+	}
+	if _, ok := hub.history["user:a"]; ok {
+		t.Error("history kept for an ephemeral topic")
+	}
+}
+
+func TestUnsubscribe(t *testing.T) {
+	hub, now := testHub()
+	ctx, cancel := context.WithCancel(context.Background())
+	other, cancelOther := context.WithCancel(context.Background())
+	defer cancelOther()
+
+	ch, _ := hub.Subscribe(ctx, []string{"community:a"}, "")
+	stays, _ := hub.Subscribe(other, []string{"community:b"}, "")
+	hub.Publish(ctx, "community:a", "post", nil)
+	receive(ch)
+
+	cancel()
+	waitClosed(t, ch)
+	hub.mu.Lock()
+	subscribers, count := len(hub.subscribers), hub.counts["community:a"]
+	hub.mu.Unlock()
+	if subscribers != 1 || count != 0 {
+		t.Errorf("%d subscribers and %d on the topic after unsubscribing, want 1 and 0", subscribers, count)
+	}
+
+	// a client reconnecting shortly after doesn't miss anything
+	*now = now.Add(time.Second)
+	hub.Publish(context.Background(), "community:a", "post", nil)
+	resumed, _ := hub.Subscribe(other, []string{"community:a"}, "1")
+	if got := receive(resumed); !equal(got, "2") {
+		t.Errorf("resumed with %v, want [2]", got)
+	}
+
+	// nobody came back to community:c, so its history goes once HistoryAge has passed
+	gone, cancelGone := context.WithCancel(context.Background())
+	hub.Subscribe(gone, []string{"community:c"}, "")
+	hub.Publish(context.Background(), "community:c", "post", nil)
+	cancelGone()
+	hub.mu.Lock()
+	for hub.counts["community:c"] > 0 {
+		hub.mu.Unlock()
+		time.Sleep(time.Millisecond)
+		hub.mu.Lock()
+	}
+	hub.mu.Unlock()
+
+	*now = now.Add(DefaultHistoryAge)
+	hub.Publish(context.Background(), "community:c", "post", nil)
+	hub.Publish(context.Background(), "community:b", "post", nil)
+	if _, ok := hub.history["community:c"]; ok {
+		t.Error("history kept for a topic without subscribers")
+	}
+	if got := receive(stays); !equal(got, "5") {
+		t.Errorf("other subscriber received %v, want [5]", got)
+	}
+}
+
+func TestSlowSubscriberIsDropped(t *testing.T) {
+	hub, _ := testHub()
+	ch, _ := hub.Subscribe(context.Background(), []string{"community:a"}, "")
+
+	for i := 0; i < cap(ch)+1; i++ {
+		hub.Publish(context.Background(), "community:a", "post", nil)
+	}
+	if got := len(receive(ch)); got != cap(ch) {
+		t.Errorf("received %d messages, want %d", got, cap(ch))
+	}
+	if _, ok := <-ch; ok {
+		t.Error("channel still open")
+	}
+	if len(hub.subscribers) != 0 {
+		t.Errorf("%d subscribers left", len(hub.subscribers))
+	}
+}
@@ -0,0 +1,27 @@
+// Package pubsub fans out domain events to in-process subscribers such as SSE streams.
+package pubsub
+
+import (
+	"context"
+	"time"
+)
+
+// Message is one event published on a topic, IDs increase over time so clients can resume
+type Message struct {
+	ID    string      `json:"id"`
+	Topic string      `json:"topic"`
+	Type  string      `json:"type"`
+	Data  interface{} `json:"data"`
+	Time  time.Time   `json:"time"`
+}
+
+// Broker publishes messages and delivers them to subscribers. The in-process Hub can be
+// replaced by an implementation backed by a distributed broker (redis, nats) when running
+// several instances.
+type Broker interface {
+	Publish(ctx context.Context, topic string, eventType string, data interface{}) (Message, error)
+	// Subscribe replays retained messages after lastID (when set) and then delivers new ones
+	// until ctx is done. The channel is closed when the subscription ends, including when the
+	// subscriber falls too far behind, clients should reconnect with the last ID they saw.
+	Subscribe(ctx context.Context, topics []string, lastID string) (<-chan Message, error)
+}
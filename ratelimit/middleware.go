@@ -0,0 +1,90 @@
+// Package ratelimit provides token bucket rate limiting middleware
+// keyed by authenticated user or client ip.
+package ratelimit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/jwtauth/v5"
+	"github.com/zillalikestocode/community-api/responses"
+)
+
+// KeyFunc identifies who a request is counted against
+type KeyFunc func(r *http.Request) string
+
+type Limiter struct {
+	Store Store
+	Key   KeyFunc
+}
+
+// Handler limits requests in the given scope, each scope has its own buckets
+// so a route override is counted separately from the global limit
+func (l *Limiter) Handler(scope string, limit Limit) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			result, err := l.Store.Take(r.Context(), scope+":"+l.Key(r), limit)
+			if err != nil {
+				// fail open, an unavailable store shouldn't take the api down
+				fmt.Printf("rate limit store failed: %v\n", err)
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Set("RateLimit-Limit", fmt.Sprint(result.Limit))
+			w.Header().Set("RateLimit-Remaining", fmt.Sprint(result.Remaining))
+			w.Header().Set("RateLimit-Reset", fmt.Sprint(ceilSeconds(result.Reset)))
+
+			if !result.Allowed {
+				w.Header().Set("Retry-After", fmt.Sprint(ceilSeconds(result.RetryAfter)))
+				w.WriteHeader(http.StatusTooManyRequests)
+				json.NewEncoder(w).Encode(responses.UserResponse{Status: http.StatusTooManyRequests, Message: "Rate limit exceeded, please slow down"})
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// SessionFunc reports whether verified claims belong to a signed in session that
+// hasn't been revoked
+type SessionFunc func(ctx context.Context, claims map[string]interface{}) bool
+
+// KeyByUserOrIP counts requests with a live session against the user id in the jwt
+// claims and everything else, including 2fa challenge and revoked tokens, against the
+// client ip so minting tokens doesn't buy fresh buckets. The token is verified here as
+// well since the limiter usually runs before jwtauth.Verifier.
+func KeyByUserOrIP(ja *jwtauth.JWTAuth, active SessionFunc) KeyFunc {
+	return func(r *http.Request) string {
+		_, claims, err := jwtauth.FromContext(r.Context())
+		if _, ok := claims["id"]; !ok || err != nil {
+			claims = nil
+			if token, err := jwtauth.VerifyRequest(ja, r, jwtauth.TokenFromHeader, jwtauth.TokenFromQuery); err == nil {
+				claims = token.PrivateClaims()
+			}
+		}
+		if id, ok := claims["id"].(string); ok && id != "" && active(r.Context(), claims) {
+			return "user:" + id
+		}
+
+		return "ip:" + clientIP(r)
+	}
+}
+
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
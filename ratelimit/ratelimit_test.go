@@ -0,0 +1,112 @@
+package ratelimit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/jwtauth/v5"
+)
+
+func TestKeyByUserOrIP(t *testing.T) {
+	ja := jwtauth.New("HS256", []byte("test-secret"), nil)
+	other := jwtauth.New("HS256", []byte("other-secret"), nil)
+	_, session, _ := ja.Encode(map[string]interface{}{"id": "user1", "sv": 0})
+	_, challenge, _ := ja.Encode(map[string]interface{}{"id": "user1", "purpose": "2fa"})
+	_, revoked, _ := ja.Encode(map[string]interface{}{"id": "user1", "sv": 1})
+	_, forged, _ := other.Encode(map[string]interface{}{"id": "user1", "sv": 0})
+
+	// stands in for the session lookup, version 0 is the live one
+	active := func(ctx context.Context, claims map[string]interface{}) bool {
+		_, pending := claims["purpose"]
+		version, _ := claims["sv"].(float64)
+		return !pending && version == 0
+	}
+	key := KeyByUserOrIP(ja, active)
+
+	tests := []struct {
+		name  string
+		token string
+		want  string
+	}{
+		{"live session", session, "user:user1"},
+		{"2fa challenge", challenge, "ip:10.0.0.1"},
+		{"revoked session", revoked, "ip:10.0.0.1"},
+		{"bad signature", forged, "ip:10.0.0.1"},
+		{"garbage", "not-a-jwt", "ip:10.0.0.1"},
+		{"anonymous", "", "ip:10.0.0.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = "10.0.0.1:5000"
+			if tt.token != "" {
+				r.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			if got := key(r); got != tt.want {
+				t.Errorf("key = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMemoryStoreTake(t *testing.T) {
+	store := NewMemoryStore()
+	limit := Limit{Requests: 3, Period: time.Minute}
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		result, _ := store.Take(ctx, "k", limit)
+		if !result.Allowed || result.Remaining != 2-i {
+			t.Fatalf("request %d: %+v", i+1, result)
+		}
+	}
+
+	result, _ := store.Take(ctx, "k", limit)
+	if result.Allowed {
+		t.Fatal("the fourth request should be limited")
+	}
+	// one token comes back every 20 seconds
+	if result.RetryAfter <= 19*time.Second || result.RetryAfter > 20*time.Second {
+		t.Fatalf("RetryAfter = %s, want about 20s", result.RetryAfter)
+	}
+
+	if result, _ := store.Take(ctx, "other", limit); !result.Allowed {
+		t.Fatal("keys should have their own buckets")
+	}
+}
+
+func TestMemoryStoreRefills(t *testing.T) {
+	store := NewMemoryStore()
+	limit := Limit{Requests: 1, Period: time.Minute}
+	ctx := context.Background()
+
+	store.Take(ctx, "k", limit)
+	store.buckets["k"].updated = time.Now().Add(-time.Minute)
+
+	if result, _ := store.Take(ctx, "k", limit); !result.Allowed {
+		t.Fatalf("bucket should have refilled: %+v", result)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	limiter := &Limiter{Store: NewMemoryStore(), Key: func(r *http.Request) string { return "k" }}
+	handler := limiter.Handler("test", Limit{Requests: 1, Period: time.Minute})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	first := httptest.NewRecorder()
+	handler.ServeHTTP(first, httptest.NewRequest(http.MethodGet, "/", nil))
+	if first.Code != http.StatusNoContent || first.Header().Get("RateLimit-Remaining") != "0" {
+		t.Fatalf("first request: %d %v", first.Code, first.Header())
+	}
+
+	second := httptest.NewRecorder()
+	handler.ServeHTTP(second, httptest.NewRequest(http.MethodGet, "/", nil))
+	if second.Code != http.StatusTooManyRequests || second.Header().Get("Retry-After") != "60" {
+		t.Fatalf("second request: %d %v", second.Code, second.Header())
+	}
+}
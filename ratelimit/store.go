@@ -0,0 +1,93 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// Limit allows Requests per Period with bursts up to Requests
+type Limit struct {
+	Requests int
+	Period   time.Duration
+}
+
+// Result describes the bucket after taking a token
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// time until the bucket is full again
+	Reset time.Duration
+	// time until the next token is available, zero when Allowed
+	RetryAfter time.Duration
+}
+
+// Store holds token buckets, Take must be atomic per key.
+// A shared implementation (redis, mongo) lets several instances enforce one quota.
+type Store interface {
+	Take(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// MemoryStore keeps buckets in process
+type MemoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: map[string]*bucket{}}
+}
+
+func (m *MemoryStore) Take(ctx context.Context, key string, limit Limit) (Result, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	capacity := float64(limit.Requests)
+	rate := capacity / limit.Period.Seconds()
+
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: capacity, updated: now}
+		m.buckets[key] = b
+		m.sweep(now, limit)
+	}
+
+	b.tokens = math.Min(capacity, b.tokens+now.Sub(b.updated).Seconds()*rate)
+	b.updated = now
+
+	result := Result{Limit: limit.Requests}
+	if b.tokens >= 1 {
+		b.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = seconds((1 - b.tokens) / rate)
+	}
+	result.Remaining = int(b.tokens)
+	result.Reset = seconds((capacity - b.tokens) / rate)
+
+	return result, nil
+}
+
+// drop buckets that have refilled, called with the lock held
+func (m *MemoryStore) sweep(now time.Time, limit Limit) {
+	if len(m.buckets) < 10000 {
+		return
+	}
+	for key, b := range m.buckets {
+		if now.Sub(b.updated) > limit.Period {
+			delete(m.buckets, key)
+		}
+	}
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
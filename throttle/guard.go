@@ -0,0 +1,101 @@
+// Package throttle slows down repeated failures (logins, signups, 2fa codes)
+// with exponential backoff and a temporary lockout.
+package throttle
+
+import (
+	"context"
+	"time"
+)
+
+// Guard applies one policy to a set of keys such as "ip:1.2.3.4" or "account:a@b.c"
+type Guard struct {
+	Store Store
+	// failures allowed before any delay is applied
+	FreeAttempts int
+	// delay after the first failure past FreeAttempts, doubled for every further failure
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// failures that trigger a lockout for Lockout
+	MaxFailures int
+	Lockout     time.Duration
+	// failures older than Window are forgotten
+	Window time.Duration
+}
+
+// Check returns how long the caller must wait before the next attempt, zero when allowed
+func (g *Guard) Check(ctx context.Context, keys ...string) (time.Duration, error) {
+	now := time.Now()
+	var wait time.Duration
+
+	for _, key := range keys {
+		attempts, err := g.Store.Get(ctx, key)
+		if err != nil {
+			return 0, err
+		}
+
+		until := attempts.LockedUntil
+		if next := attempts.LastFailure.Add(g.delay(attempts.Failures)); next.After(until) {
+			until = next
+		}
+		if d := until.Sub(now); d > wait {
+			wait = d
+		}
+	}
+
+	return wait, nil
+}
+
+// Fail records a failed attempt against every key
+func (g *Guard) Fail(ctx context.Context, keys ...string) error {
+	now := time.Now()
+	ttl := g.Window
+	if g.Lockout > ttl {
+		ttl = g.Lockout
+	}
+
+	for _, key := range keys {
+		_, err := g.Store.Update(ctx, key, ttl, func(a *Attempts) {
+			if now.Sub(a.LastFailure) > g.Window {
+				a.Failures = 0
+			}
+			a.Failures++
+			a.LastFailure = now
+			if g.MaxFailures > 0 && a.Failures >= g.MaxFailures {
+				a.LockedUntil = now.Add(g.Lockout)
+				a.Failures = 0
+			}
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Reset clears the history for the keys after a successful attempt
+func (g *Guard) Reset(ctx context.Context, keys ...string) error {
+	for _, key := range keys {
+		if err := g.Store.Delete(ctx, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (g *Guard) delay(failures int) time.Duration {
+	over := failures - g.FreeAttempts
+	if over <= 0 || g.BaseDelay <= 0 {
+		return 0
+	}
+
+	delay := g.BaseDelay
+	for i := 1; i < over && delay < g.MaxDelay; i++ {
+		delay *= 2
+	}
+	if g.MaxDelay > 0 && delay > g.MaxDelay {
+		delay = g.MaxDelay
+	}
+
+	return delay
+}
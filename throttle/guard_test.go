@@ -0,0 +1,150 @@
+package throttle
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestDelay(t *testing.T) {
+	g := &Guard{FreeAttempts: 3, BaseDelay: time.Second, MaxDelay: 10 * time.Second}
+
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{0, 0},
+		{3, 0},
+		{4, time.Second},
+		{5, 2 * time.Second},
+		{6, 4 * time.Second},
+		{7, 8 * time.Second},
+		{8, 10 * time.Second},
+		{100, 10 * time.Second},
+	}
+
+	for _, tt := range tests {
+		if got := g.delay(tt.failures); got != tt.want {
+			t.Errorf("delay(%d) = %s, want %s", tt.failures, got, tt.want)
+		}
+	}
+}
+
+func TestDelayWithoutBaseDelay(t *testing.T) {
+	g := &Guard{MaxFailures: 10, Lockout: time.Hour}
+	if got := g.delay(9); got != 0 {
+		t.Fatalf("delay = %s, want 0", got)
+	}
+}
+
+func TestCheckAppliesBackoff(t *testing.T) {
+	ctx := context.Background()
+	g := &Guard{Store: NewMemoryStore(), FreeAttempts: 1, BaseDelay: time.Minute, MaxDelay: time.Hour, Window: time.Hour}
+
+	g.Fail(ctx, "account:a")
+	if wait := mustCheck(t, g, "account:a"); wait != 0 {
+		t.Fatalf("free attempt should not wait, got %s", wait)
+	}
+
+	g.Fail(ctx, "account:a")
+	if wait := mustCheck(t, g, "account:a"); wait <= 50*time.Second || wait > time.Minute {
+		t.Fatalf("wait = %s, want about a minute", wait)
+	}
+
+	g.Fail(ctx, "account:a")
+	if wait := mustCheck(t, g, "account:a"); wait <= 110*time.Second || wait > 2*time.Minute {
+		t.Fatalf("wait = %s, want about two minutes", wait)
+	}
+}
+
+func TestFailLocksOut(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	g := &Guard{Store: store, MaxFailures: 3, Lockout: 15 * time.Minute, Window: time.Hour}
+
+	for i := 0; i < 2; i++ {
+		g.Fail(ctx, "ip:1.2.3.4")
+		if wait := mustCheck(t, g, "ip:1.2.3.4"); wait != 0 {
+			t.Fatalf("failure %d: wait = %s before the lockout", i+1, wait)
+		}
+	}
+
+	g.Fail(ctx, "ip:1.2.3.4")
+	if wait := mustCheck(t, g, "ip:1.2.3.4"); wait <= 14*time.Minute || wait > 15*time.Minute {
+		t.Fatalf("wait = %s, want the 15 minute lockout", wait)
+	}
+
+	attempts, _ := store.Get(ctx, "ip:1.2.3.4")
+	if attempts.Failures != 0 {
+		t.Fatalf("failures = %d, the count should restart after a lockout", attempts.Failures)
+	}
+}
+
+func TestFailForgetsOldFailures(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	g := &Guard{Store: store, MaxFailures: 3, Lockout: time.Hour, Window: time.Minute}
+
+	store.Update(ctx, "k", time.Hour, func(a *Attempts) {
+		a.Failures = 2
+		a.LastFailure = time.Now().Add(-2 * time.Minute)
+	})
+	g.Fail(ctx, "k")
+
+	attempts, _ := store.Get(ctx, "k")
+	if attempts.Failures != 1 || !attempts.LockedUntil.IsZero() {
+		t.Fatalf("got %+v, failures outside the window should not count", attempts)
+	}
+}
+
+func TestCheckUsesLongestWait(t *testing.T) {
+	ctx := context.Background()
+	g := &Guard{Store: NewMemoryStore(), MaxFailures: 1, Lockout: time.Hour, Window: time.Hour}
+
+	g.Fail(ctx, "account:a")
+	if wait := mustCheck(t, g, "ip:1.2.3.4", "account:a"); wait <= 59*time.Minute {
+		t.Fatalf("wait = %s, a locked key should block the attempt", wait)
+	}
+	if wait := mustCheck(t, g, "ip:1.2.3.4"); wait != 0 {
+		t.Fatalf("wait = %s, other keys should not be affected", wait)
+	}
+}
+
+func TestReset(t *testing.T) {
+	ctx := context.Background()
+	g := &Guard{Store: NewMemoryStore(), MaxFailures: 1, Lockout: time.Hour, Window: time.Hour}
+
+	g.Fail(ctx, "a", "b")
+	if err := g.Reset(ctx, "a", "b"); err != nil {
+		t.Fatal(err)
+	}
+	if wait := mustCheck(t, g, "a", "b"); wait != 0 {
+		t.Fatalf("wait = %s after a reset", wait)
+	}
+}
+
+func TestMemoryStoreExpires(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+
+	store.Update(ctx, "k", -time.Second, func(a *Attempts) { a.Failures = 5 })
+	attempts, err := store.Get(ctx, "k")
+	if err != nil || attempts.Failures != 0 {
+		t.Fatalf("got %+v, %v, expired entries should be dropped", attempts, err)
+	}
+
+	store.Update(ctx, "k", time.Minute, func(a *Attempts) { a.Failures++ })
+	store.Update(ctx, "k", time.Minute, func(a *Attempts) { a.Failures++ })
+	if attempts, _ := store.Get(ctx, "k"); attempts.Failures != 2 {
+		t.Fatalf("failures = %d, want 2", attempts.Failures)
+	}
+}
+
+func mustCheck(t *testing.T, g *Guard, keys ...string) time.Duration {
+	t.Helper()
+	wait, err := g.Check(context.Background(), keys...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return wait
+}
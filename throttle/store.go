@@ -0,0 +1,88 @@
+package throttle
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Attempts is the failure history tracked for one key
+type Attempts struct {
+	Failures    int
+	LastFailure time.Time
+	LockedUntil time.Time
+}
+
+// Store persists attempts per key. Update must apply fn atomically so that
+// concurrent failures for the same key are all counted, a shared store
+// (redis, mongo) can implement it with a transaction or compare-and-swap.
+type Store interface {
+	Get(ctx context.Context, key string) (Attempts, error)
+	Update(ctx context.Context, key string, ttl time.Duration, fn func(*Attempts)) (Attempts, error)
+	Delete(ctx context.Context, key string) error
+}
+
+type entry struct {
+	attempts  Attempts
+	expiresAt time.Time
+}
+
+// MemoryStore keeps attempts in process, it is only suitable for a single instance
+type MemoryStore struct {
+	mu      sync.Mutex
+	entries map[string]entry
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: map[string]entry{}}
+}
+
+func (m *MemoryStore) Get(ctx context.Context, key string) (Attempts, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, ok := m.entries[key]
+	if !ok || time.Now().After(e.expiresAt) {
+		delete(m.entries, key)
+		return Attempts{}, nil
+	}
+
+	return e.attempts, nil
+}
+
+func (m *MemoryStore) Update(ctx context.Context, key string, ttl time.Duration, fn func(*Attempts)) (Attempts, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	e, ok := m.entries[key]
+	if !ok || now.After(e.expiresAt) {
+		e = entry{}
+	}
+	fn(&e.attempts)
+	e.expiresAt = now.Add(ttl)
+	m.entries[key] = e
+
+	m.sweep(now)
+	return e.attempts, nil
+}
+
+func (m *MemoryStore) Delete(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.entries, key)
+	return nil
+}
+
+// drop expired entries once the map grows, called with the lock held
+func (m *MemoryStore) sweep(now time.Time) {
+	if len(m.entries) < 10000 {
+		return
+	}
+	for key, e := range m.entries {
+		if now.After(e.expiresAt) {
+			delete(m.entries, key)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+// Package ticket signs and verifies event check-in tickets. A ticket is
+// "<event id>.<user id>.<expiry unix seconds>.<hex HMAC-SHA256 of the rest>".
+package ticket
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrInvalid    = errors.New("ticket: invalid")
+	ErrWrongEvent = errors.New("ticket: for a different event")
+	ErrExpired    = errors.New("ticket: expired")
+)
+
+type Ticket struct {
+	EventID primitive.ObjectID
+	UserID  primitive.ObjectID
+	Expires time.Time
+}
+
+// Sign returns the token for a ticket
+func Sign(secret []byte, t Ticket) string {
+	payload := t.EventID.Hex() + "." + t.UserID.Hex() + "." + strconv.FormatInt(t.Expires.Unix(), 10)
+	return payload + "." + signature(secret, payload)
+}
+
+// Verify checks the token's signature and that it is for eventId and hasn't expired at now.
+// The ticket is returned with ErrWrongEvent and ErrExpired so callers can say which event
+// or when.
+func Verify(secret []byte, token string, eventId primitive.ObjectID, now time.Time) (Ticket, error) {
+	token = strings.TrimSpace(token)
+	i := strings.LastIndexByte(token, '.')
+	if i < 0 || !hmac.Equal([]byte(token[i+1:]), []byte(signature(secret, token[:i]))) {
+		return Ticket{}, ErrInvalid
+	}
+
+	parts := strings.Split(token[:i], ".")
+	if len(parts) != 3 {
+		return Ticket{}, ErrInvalid
+	}
+	var t Ticket
+	var err error
+	if t.EventID, err = primitive.ObjectIDFromHex(parts[0]); err != nil {
+		return Ticket{}, ErrInvalid
+	}
+	if t.UserID, err = primitive.ObjectIDFromHex(parts[1]); err != nil {
+		return Ticket{}, ErrInvalid
+	}
+	expires, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return Ticket{}, ErrInvalid
+	}
+	t.Expires = time.Unix(expires, 0)
+
+	if t.EventID != eventId {
+		return t, ErrWrongEvent
+	}
+	if !now.Before(t.Expires) {
+		return t, ErrExpired
+	}
+	return t, nil
+}
+
+func signature(secret []byte, payload string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,70 @@
+package ticket
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestVerify(t *testing.T) {
+	secret := []byte("secret")
+	now := time.Date(2026, 5, 1, 18, 0, 0, 0, time.UTC)
+	event, other, user := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+	valid := Ticket{EventID: event, UserID: user, Expires: now.Add(time.Hour)}
+	token := Sign(secret, valid)
+
+	// swapping in another event or a later expiry breaks the signature
+	parts := strings.Split(token, ".")
+	otherEvent := strings.Join([]string{other.Hex(), parts[1], parts[2], parts[3]}, ".")
+	extended := strings.Join([]string{parts[0], parts[1], "9999999999", parts[3]}, ".")
+
+	tests := []struct {
+		name  string
+		token string
+		event primitive.ObjectID
+		now   time.Time
+		err   error
+	}{
+		{"valid", token, event, now, nil},
+		{"surrounding space", " " + token + "\n", event, now, nil},
+		{"other event", token, other, now, ErrWrongEvent},
+		{"at expiry", token, event, valid.Expires, ErrExpired},
+		{"after expiry", token, event, now.Add(2 * time.Hour), ErrExpired},
+		{"other secret", Sign([]byte("other"), valid), event, now, ErrInvalid},
+		{"event swapped", otherEvent, other, now, ErrInvalid},
+		{"expiry extended", extended, event, now, ErrInvalid},
+		{"old format", parts[0] + "." + parts[1] + "." + parts[3], event, now, ErrInvalid},
+		{"no signature", parts[0] + "." + parts[1] + "." + parts[2], event, now, ErrInvalid},
+		{"empty", "", event, now, ErrInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Verify(secret, tt.token, tt.event, tt.now)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Verify error = %v, want %v", err, tt.err)
+			}
+			if err == nil || err == ErrWrongEvent || err == ErrExpired {
+				if got.EventID != event || got.UserID != user || !got.Expires.Equal(valid.Expires) {
+					t.Errorf("Verify = %+v, want %+v", got, valid)
+				}
+			}
+		})
+	}
+}
+
+func TestSignIsStable(t *testing.T) {
+	event, _ := primitive.ObjectIDFromHex("65f1a2b3c4d5e6f708192a3b")
+	user, _ := primitive.ObjectIDFromHex("65f1a2b3c4d5e6f708192a3c")
+	ticket := Ticket{EventID: event, UserID: user, Expires: time.Unix(1777665600, 0)}
+
+	token := Sign([]byte("secret"), ticket)
+	if !strings.HasPrefix(token, "65f1a2b3c4d5e6f708192a3b.65f1a2b3c4d5e6f708192a3c.1777665600.") {
+		t.Errorf("token = %s", token)
+	}
+	if again := Sign([]byte("secret"), ticket); again != token {
+		t.Errorf("signing twice gave %s and %s", token, again)
+	}
+}
@@ -0,0 +1,128 @@
+package totp
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// the SHA1 seed from RFC 6238 appendix B, "12345678901234567890" in base32
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestCodeRFC6238Vectors(t *testing.T) {
+	// the RFC lists 8 digit codes, ours are the last 6 digits of the same value
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, tt := range tests {
+		code, err := Code(rfcSecret, Step(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatalf("Code(%d): %v", tt.unix, err)
+		}
+		if code != tt.code {
+			t.Errorf("Code(%d) = %s, want %s", tt.unix, code, tt.code)
+		}
+	}
+}
+
+func TestCodeAcceptsLowercaseSecret(t *testing.T) {
+	code, err := Code(" "+strings.ToLower(rfcSecret)+" ", Step(time.Unix(59, 0)))
+	if err != nil || code != "287082" {
+		t.Fatalf("Code = %q, %v, want 287082", code, err)
+	}
+}
+
+func TestCodeRejectsInvalidSecret(t *testing.T) {
+	if _, err := Code("not base32!", 1); err == nil {
+		t.Fatal("expected an error for an invalid secret")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current := Step(now)
+
+	tests := []struct {
+		name string
+		code string
+		step int64
+		ok   bool
+	}{
+		{"current step", mustCode(t, current), current, true},
+		{"previous step within skew", mustCode(t, current-1), current - 1, true},
+		{"next step within skew", mustCode(t, current+1), current + 1, true},
+		{"two steps behind", mustCode(t, current-2), 0, false},
+		{"two steps ahead", mustCode(t, current+2), 0, false},
+		{"surrounding whitespace", " " + mustCode(t, current) + "\n", current, true},
+		{"too short", "12345", 0, false},
+		{"too long", "1234567", 0, false},
+		{"empty", "", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := Validate(rfcSecret, tt.code, now)
+			if ok != tt.ok || step != tt.step {
+				t.Errorf("Validate(%q) = %d, %v, want %d, %v", tt.code, step, ok, tt.step, tt.ok)
+			}
+		})
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	first, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, _ := GenerateSecret()
+	if first == second {
+		t.Fatal("secrets should be random")
+	}
+
+	key, err := encoding.DecodeString(first)
+	if err != nil || len(key) != 20 {
+		t.Fatalf("secret %q decodes to %d bytes, %v", first, len(key), err)
+	}
+	if _, err := Code(first, 1); err != nil {
+		t.Fatalf("generated secret is not usable: %v", err)
+	}
+}
+
+func TestURI(t *testing.T) {
+	uri, err := url.Parse(URI("Community API", "ada@example.com", rfcSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if uri.Scheme != "otpauth" || uri.Host != "totp" {
+		t.Errorf("unexpected uri %s", uri)
+	}
+	if uri.Path != "/Community API:ada@example.com" {
+		t.Errorf("label = %q", uri.Path)
+	}
+	query := uri.Query()
+	for key, want := range map[string]string{"secret": rfcSecret, "issuer": "Community API", "algorithm": "SHA1", "digits": "6", "period": "30"} {
+		if got := query.Get(key); got != want {
+			t.Errorf("%s = %q, want %q", key, got, want)
+		}
+	}
+}
+
+func mustCode(t *testing.T, step int64) string {
+	t.Helper()
+	code, err := Code(rfcSecret, step)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code
+}
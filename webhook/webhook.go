@@ -0,0 +1,193 @@
+// Package webhook signs and delivers outbound webhook payloads.
+//
+// Receivers verify a delivery by computing HMAC-SHA256 over "<timestamp>.<body>"
+// with the webhook secret and comparing it to the X-Webhook-Signature header.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+const (
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderDelivery  = "X-Webhook-Delivery"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderSignature = "X-Webhook-Signature"
+
+	// attempts made for a delivery before it is marked failed
+	MaxAttempts = 6
+)
+
+// ErrForbiddenAddress is returned for destinations on loopback, private, link-local
+// or otherwise internal addresses
+var ErrForbiddenAddress = errors.New("webhook: destination address is not allowed")
+
+// shared and reserved ranges that IsPrivate doesn't cover
+var internalNets = []*net.IPNet{
+	mustCIDR("0.0.0.0/8"),
+	mustCIDR("100.64.0.0/10"),
+	mustCIDR("192.0.0.0/24"),
+	mustCIDR("198.18.0.0/15"),
+}
+
+// Sign returns the signature header value for a payload
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks a signature produced by Sign, rejecting timestamps older than tolerance
+func Verify(secret string, signature string, timestamp int64, body []byte, tolerance time.Duration) bool {
+	if tolerance > 0 && time.Since(time.Unix(timestamp, 0)).Abs() > tolerance {
+		return false
+	}
+	return hmac.Equal([]byte(signature), []byte(Sign(secret, timestamp, body)))
+}
+
+// Deliver posts a signed payload and returns the response status,
+// any status outside 2xx is returned as an error
+func Deliver(ctx context.Context, client *http.Client, url string, secret string, deliveryId string, eventType string, body []byte) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "community-api-webhooks/1.0")
+	req.Header.Set(HeaderEvent, eventType)
+	req.Header.Set(HeaderDelivery, deliveryId)
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(secret, timestamp, body))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("receiver responded with %d", resp.StatusCode)
+	}
+
+	return resp.StatusCode, nil
+}
+
+// Backoff returns the wait before the given retry attempt (1 based): 30s, 1m, 2m ... up to 1h
+func Backoff(attempt int) time.Duration {
+	delay := 30 * time.Second
+	for i := 1; i < attempt && delay < time.Hour; i++ {
+		delay *= 2
+	}
+	if delay > time.Hour {
+		delay = time.Hour
+	}
+	return delay
+}
+
+// Retry reports whether a delivery that has failed attempts times should be tried
+// again and how long to wait first
+func Retry(attempts int) (time.Duration, bool) {
+	if attempts >= MaxAttempts {
+		return 0, false
+	}
+	return Backoff(attempts), true
+}
+
+// ValidateURL checks a receiver url when it is registered: http(s) only (https when
+// requireHTTPS is set) and a host that doesn't resolve to an internal address.
+// Deliveries are checked again when connecting, see NewClient.
+func ValidateURL(ctx context.Context, raw string, requireHTTPS bool) error {
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		return err
+	}
+	if parsed.Scheme != "https" && (requireHTTPS || parsed.Scheme != "http") {
+		return fmt.Errorf("webhook: unsupported scheme %q", parsed.Scheme)
+	}
+	if parsed.Hostname() == "" || parsed.User != nil {
+		return errors.New("webhook: the url needs a host and no credentials")
+	}
+
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, parsed.Hostname())
+	if err != nil {
+		return err
+	}
+	for _, addr := range addrs {
+		if !Public(addr.IP) {
+			return ErrForbiddenAddress
+		}
+	}
+	return nil
+}
+
+// Public reports whether ip is a routable public address
+func Public(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return false
+	}
+	for _, n := range internalNets {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// PublicOnly is a net.Dialer Control function that refuses connections to internal
+// addresses. It sees the address actually being dialled, so a host that passed
+// ValidateURL and later resolves somewhere else (dns rebinding) is still refused.
+func PublicOnly(network string, address string, c syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !Public(ip) {
+		return ErrForbiddenAddress
+	}
+	return nil
+}
+
+// NewClient returns the client deliveries are sent with. It only connects to public
+// addresses, ignores proxy settings and doesn't follow redirects.
+func NewClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{Timeout: 5 * time.Second, Control: PublicOnly}
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: 5 * time.Second,
+			MaxIdleConns:        10,
+			IdleConnTimeout:     90 * time.Second,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+func mustCIDR(cidr string) *net.IPNet {
+	_, n, err := net.ParseCIDR(cidr)
+	if err != nil {
+		panic(err)
+	}
+	return n
+}